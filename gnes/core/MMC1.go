@@ -44,6 +44,18 @@ const (
 	CHR_ROM_MODE_4K = 1
 )
 
+// MMC1 submappers
+const (
+	// SEROM, SHROM and SH1ROM wire 32K of PRG ROM straight to $8000, so the PRG
+	// bank has no effect
+	submapper_MMC1_SEROM = 5
+)
+
+const (
+	size_CHR_BANK_4K = 0x1000
+	size_CHR_RAM     = 0x2000
+)
+
 const (
 	RESET_MASK             = 0x80
 	NEW_WRITE_MASK         = 0x10
@@ -53,6 +65,9 @@ const (
 	MIRRORING_MASK         = 0x3
 	PRG_ROM_BANK_MODE_MASK = 0xC
 	CHR_ROM_BANK_MODE_MASK = 0x10
+	PRG_BANK_MASK          = 0xF
+	PRG_RAM_DISABLE_MASK   = 0x10
+	SNROM_RAM_DISABLE_MASK = 0x10
 )
 
 type mapper_MMC1 struct {
@@ -61,6 +76,9 @@ type mapper_MMC1 struct {
 	prgRam []byte
 	prgRom [][]byte
 
+	chr    []byte
+	chrRam bool // If chrRam, the cartridge has CHR RAM instead of CHR ROM
+
 	prgRomBank uint8 // Select 16 KB PRG ROM bank (low bit ignored in PRG_ROM_MODE_32K)
 
 	chrBank1, // Select 4 KB or 8 KB CHR bank at PPU $0000 (low bit ignored in CHR_ROM_MODE_8K)
@@ -71,6 +89,11 @@ type mapper_MMC1 struct {
 
 	prgRamEnable bool
 
+	// fixedPrg is set on SEROM boards. snrom is set on SNROM boards, which also
+	// disable PRG RAM with bit 4 of the CHR bank.
+	fixedPrg,
+	snrom bool
+
 	shiftReg uint8 // Internal shift register, used for holding temporary state
 	ppu      *ppu
 }
@@ -80,7 +103,6 @@ func (mmu *mapper_MMC1) write(val uint8, addr uint16) error {
 		if (val & RESET_MASK) != 0 {
 			// If bit 7 of the value is 1, we just reset the shift register's contents
 			mmu.shiftReg = NEW_WRITE_MASK
-			fmt.Println("Reset MMC1 shift register")
 		} else {
 			// otherwise, write to the shift register and if full, update state
 			newVal := ((val & DATA_BIT_MASK) << 4) | (mmu.shiftReg >> 1)
@@ -95,7 +117,6 @@ func (mmu *mapper_MMC1) write(val uint8, addr uint16) error {
 
 				switch register {
 				case region_REG_CONTROL:
-					fmt.Println("Updating control register (MMC1)")
 					prgRomMode, err := mmu.getPrgRomBankMode((newVal & PRG_ROM_BANK_MODE_MASK) >> 2)
 
 					if err != nil {
@@ -116,23 +137,41 @@ func (mmu *mapper_MMC1) write(val uint8, addr uint16) error {
 					}
 
 				case region_REG_CHR_BANK0:
-
+					mmu.chrBank1 = newVal
 				case region_REG_CHR_BANK1:
+					mmu.chrBank2 = newVal
 				case region_REG_PRG_BANK:
+					mmu.prgRomBank = newVal & PRG_BANK_MASK
+					mmu.prgRamEnable = (newVal & PRG_RAM_DISABLE_MASK) == 0
 				}
+				mmu.shiftReg = NEW_WRITE_MASK
 
 			} else {
 				// otherwise, keep pushing data into shift reg
-				fmt.Printf("New MMC1 shift register value: %0#8b\n", newVal)
 				mmu.shiftReg = newVal
 			}
 		}
 		return nil
 	}
 
+	if addr >= addr_PRG_RAM {
+		// Writes to disabled PRG RAM are lost
+		if mmu.prgRamEnabled() {
+			mmu.prgRam[uint32(addr-addr_PRG_RAM)%uint32(len(mmu.prgRam))] = val
+		}
+		return nil
+	}
 	return &gError{err_ADDR_OUT_OF_BOUNDS}
 }
 
+// prgRamEnabled returns whether PRG RAM is present and enabled
+func (mmu *mapper_MMC1) prgRamEnabled() bool {
+	if mmu.snrom && (mmu.chrBank1&SNROM_RAM_DISABLE_MASK) != 0 {
+		return false
+	}
+	return mmu.prgRamEnable && len(mmu.prgRam) > 0
+}
+
 func (*mapper_MMC1) getPrgRomBankMode(val uint8) (int, error) {
 	if val == 0x0 || val == 0x1 {
 		return PRG_ROM_MODE_32K, nil
@@ -164,26 +203,32 @@ func (mmu *mapper_MMC1) getAddrPointer(addr uint16) (*uint8, error) {
 
 	switch region {
 	case region_PRG_RAM:
-		if mmu.prgRamEnable {
-			return &mmu.prgRam[addr-addr_PRG_RAM], nil
+		if mmu.prgRamEnabled() {
+			return &mmu.prgRam[uint32(addr-addr_PRG_RAM)%uint32(len(mmu.prgRam))], nil
 		} else {
 			return nil, &gError{err_MMC1_PRG_RAM_DISABLED}
 		}
 	case region_PRG_ROM1:
+		if mmu.fixedPrg {
+			return &mmu.prgRom[0][addr-addr_PRG_ROM1], nil
+		}
 		switch mmu.prgRomMode {
 		case PRG_ROM_MODE_32K:
-			return &mmu.prgRom[mmu.prgRomBank][addr-addr_PRG_ROM1], nil
+			return &mmu.prgRom[mmu.prgRomBank32()][addr-addr_PRG_ROM1], nil
 		case PRG_ROM_MODE_FIX_LO:
 			return &mmu.prgRom[0][addr-addr_PRG_ROM1], nil
 		case PRG_ROM_MODE_FIX_HI:
-			return &mmu.prgRom[mmu.prgRomBank][addr-addr_PRG_ROM1], nil
+			return &mmu.prgRom[mmu.prgRomBank16()][addr-addr_PRG_ROM1], nil
 		}
 	case region_PRG_ROM2:
+		if mmu.fixedPrg {
+			return &mmu.prgRom[1%mmu.prgRomSize][addr-addr_PRG_ROM2], nil
+		}
 		switch mmu.prgRomMode {
 		case PRG_ROM_MODE_32K:
-			return &mmu.prgRom[mmu.prgRomBank+1][addr-addr_PRG_ROM2], nil
+			return &mmu.prgRom[(mmu.prgRomBank32()+1)%mmu.prgRomSize][addr-addr_PRG_ROM2], nil
 		case PRG_ROM_MODE_FIX_LO:
-			return &mmu.prgRom[mmu.prgRomBank][addr-addr_PRG_ROM2], nil
+			return &mmu.prgRom[mmu.prgRomBank16()][addr-addr_PRG_ROM2], nil
 		case PRG_ROM_MODE_FIX_HI:
 			return &mmu.prgRom[mmu.prgRomSize-1][addr-addr_PRG_ROM2], nil
 		}
@@ -191,12 +236,50 @@ func (mmu *mapper_MMC1) getAddrPointer(addr uint16) (*uint8, error) {
 	return nil, errors.New(fmt.Sprintf("Address %#x out of bounds during MMC1 read", addr))
 }
 
+// prgRomBank16 returns the switchable 16K bank, wrapped to the PRG ROM there is
+func (mmu *mapper_MMC1) prgRomBank16() uint32 {
+	return uint32(mmu.prgRomBank) % mmu.prgRomSize
+}
+
+// prgRomBank32 returns the first 16K bank of the switchable 32K bank, which
+// ignores the low bit of the bank number
+func (mmu *mapper_MMC1) prgRomBank32() uint32 {
+	return uint32(mmu.prgRomBank&^0x1) % mmu.prgRomSize
+}
+
+// chrIndex returns the offset into CHR memory for a pattern table address,
+// according to the current CHR banking mode.
+func (mmu *mapper_MMC1) chrIndex(addr uint16) uint32 {
+	var index uint32
+	if mmu.chrRomMode == CHR_ROM_MODE_8K {
+		index = uint32(mmu.chrBank1&^0x1)*size_CHR_BANK_4K + uint32(addr)
+	} else if addr < size_CHR_BANK_4K {
+		index = uint32(mmu.chrBank1)*size_CHR_BANK_4K + uint32(addr)
+	} else {
+		index = uint32(mmu.chrBank2)*size_CHR_BANK_4K + uint32(addr-size_CHR_BANK_4K)
+	}
+	return index % uint32(len(mmu.chr))
+}
+
+func (mmu *mapper_MMC1) readChr(addr uint16) (uint8, error) {
+	return mmu.chr[mmu.chrIndex(addr)], nil
+}
+
+func (mmu *mapper_MMC1) writeChr(val uint8, addr uint16) error {
+	if mmu.chrRam {
+		mmu.chr[mmu.chrIndex(addr)] = val
+	}
+	return nil
+}
+
 func (*mapper_MMC1) addrToRegister(addr uint16) (int, error) {
 	if addr_REG_CONTROL <= addr && addr < addr_REG_CHR_BANK0 {
 		return region_REG_CONTROL, nil
 	} else if addr_REG_CHR_BANK0 <= addr && addr < addr_REG_CHR_BANK1 {
 		return region_REG_CHR_BANK0, nil
-	} else if addr_REG_CHR_BANK1 <= addr {
+	} else if addr_REG_CHR_BANK1 <= addr && addr < addr_REG_PRG_BANK {
+		return region_REG_CHR_BANK1, nil
+	} else if addr_REG_PRG_BANK <= addr {
 		return region_REG_PRG_BANK, nil
 	} else {
 		return 0, &gError{err_ADDR_OUT_OF_BOUNDS}
@@ -219,7 +302,7 @@ func (*mapper_MMC1) addrToRegion(addr uint16) (int, error) {
 func newMapper_MMC1(info *cartInfo, ppu *ppu) (mapper, error) {
 	mapper := &mapper_MMC1{}
 
-	if uint32(len(info.data.prgRom))/PRG_ROM_SIZE != info.prgRomSize {
+	if uint32(len(info.data.prgRom))/PRG_ROM_SIZE != info.prgRomSize || info.prgRomSize == 0 {
 		return nil, &gError{err_INCONSISTENT_PRG_ROM_SIZE}
 	}
 	mapper.prgRomSize = info.prgRomSize
@@ -236,13 +319,30 @@ func newMapper_MMC1(info *cartInfo, ppu *ppu) (mapper, error) {
 	mapper.chrBank1 = 0
 	mapper.chrBank2 = 0
 
-	if info.prgRamSize > 1 {
+	if info.chrRomSize == 0 {
+		mapper.chr = make([]byte, size_CHR_RAM)
+		mapper.chrRam = true
+	} else {
+		mapper.chr = info.data.chrRom
+	}
+
+	// iNES headers often leave the PRG RAM size as 0, which means 8K
+	prgRamSize := info.prgRamSize + info.prgNvramSize
+	if prgRamSize == 0 && !info.nes2 {
+		prgRamSize = PRG_RAM_SIZE
+	}
+	if prgRamSize > PRG_RAM_SIZE {
 		return nil, &gError{err_INCONSISTENT_PRG_RAM_SIZE}
 	}
-	mapper.prgRam = make([]byte, info.prgRamSize*PRG_RAM_SIZE)
+	mapper.prgRam = make([]byte, prgRamSize)
 	mapper.prgRamEnable = true
 
-	mapper.shiftReg = 0
+	mapper.fixedPrg = info.submapper == submapper_MMC1_SEROM
+	// SNROM is the only board with 8K of CHR RAM and PRG RAM, and no more than
+	// 256K of PRG ROM. SUROM and SXROM use the same bit to switch PRG ROM.
+	mapper.snrom = mapper.chrRam && prgRamSize == PRG_RAM_SIZE && mapper.prgRomSize <= 16
+
+	mapper.shiftReg = NEW_WRITE_MASK
 
 	mapper.ppu = ppu
 	return mapper, nil
@@ -0,0 +1,153 @@
+package gnes
+
+import "testing"
+
+// testMMC1Info describes an MMC1 cartridge with 'banks' 16K PRG ROM banks,
+// each filled with its bank number, and CHR RAM
+func testMMC1Info(banks int, submapper uint32) *cartInfo {
+	info := newCartInfo()
+	info.mapper = 1
+	info.submapper = submapper
+	info.prgRomSize = uint32(banks)
+	info.data.prgRom = make([]byte, banks*PRG_ROM_SIZE)
+	for i := range info.data.prgRom {
+		info.data.prgRom[i] = uint8(i / PRG_ROM_SIZE)
+	}
+	return info
+}
+
+func newTestMMC1(t *testing.T, info *cartInfo) *mapper_MMC1 {
+	ppu, err := newPpu()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper, err := newMapper_MMC1(info, ppu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mapper.(*mapper_MMC1)
+}
+
+func testMMC1(t *testing.T, banks int, submapper uint32) *mapper_MMC1 {
+	return newTestMMC1(t, testMMC1Info(banks, submapper))
+}
+
+// writeMMC1 writes a register through the serial port, low bit first
+func writeMMC1(t *testing.T, mmu *mapper_MMC1, addr uint16, val uint8) {
+	for i := uint(0); i < 5; i++ {
+		if err := mmu.write((val>>i)&1, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readMMC1Banks returns the banks mapped at $8000 and $C000
+func readMMC1Banks(t *testing.T, mmu *mapper_MMC1) (uint8, uint8) {
+	lo, err := mmu.read(addr_PRG_ROM1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hi, err := mmu.read(addr_PRG_ROM2 + 0x100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lo, hi
+}
+
+func TestMMC1PrgBanking(t *testing.T) {
+	// Control register values for each PRG ROM mode, with 8K CHR banks
+	const (
+		control32K   = 0x00
+		controlFixLo = 0x08
+		controlFixHi = 0x0C
+	)
+	tests := []struct {
+		control, bank uint8
+		lo, hi        uint8
+	}{
+		// The low bit is ignored in 32K mode
+		{control32K, 2, 2, 3},
+		{control32K, 3, 2, 3},
+		{control32K, 1, 0, 1},
+		// Banks past the end of the 64K of PRG ROM wrap
+		{control32K, 6, 2, 3},
+		{control32K, 15, 2, 3},
+		{controlFixLo, 3, 0, 3},
+		{controlFixLo, 6, 0, 2},
+		{controlFixLo, 13, 0, 1},
+		{controlFixHi, 3, 3, 3},
+		{controlFixHi, 1, 1, 3},
+		{controlFixHi, 9, 1, 3},
+		{controlFixHi, 14, 2, 3},
+	}
+	for _, test := range tests {
+		mmu := testMMC1(t, 4, 0)
+		writeMMC1(t, mmu, addr_REG_CONTROL, test.control)
+		writeMMC1(t, mmu, addr_REG_PRG_BANK, test.bank)
+		lo, hi := readMMC1Banks(t, mmu)
+		if lo != test.lo || hi != test.hi {
+			t.Errorf("control $%02X, bank %d: banks %d and %d mapped, want %d and %d",
+				test.control, test.bank, lo, hi, test.lo, test.hi)
+		}
+	}
+}
+
+func TestMMC1SEROM(t *testing.T) {
+	for _, control := range []uint8{0x00, 0x08, 0x0C} {
+		mmu := testMMC1(t, 2, submapper_MMC1_SEROM)
+		writeMMC1(t, mmu, addr_REG_CONTROL, control)
+		for _, bank := range []uint8{0, 1, 2, 3} {
+			writeMMC1(t, mmu, addr_REG_PRG_BANK, bank)
+			if lo, hi := readMMC1Banks(t, mmu); lo != 0 || hi != 1 {
+				t.Errorf("control $%02X, bank %d: banks %d and %d mapped, want 0 and 1", control, bank, lo, hi)
+			}
+		}
+	}
+
+	// Without the submapper, the same writes switch banks
+	mmu := testMMC1(t, 2, 0)
+	writeMMC1(t, mmu, addr_REG_PRG_BANK, 1)
+	if lo, _ := readMMC1Banks(t, mmu); lo != 1 {
+		t.Errorf("bank %d mapped at $8000 without SEROM, want 1", lo)
+	}
+}
+
+func TestMMC1SNROM(t *testing.T) {
+	tests := []struct {
+		name    string
+		chrRom  bool
+		chrBank uint8
+		enabled bool
+	}{
+		{"SNROM", false, 0x00, true},
+		{"SNROM with CHR bit 4", false, 0x10, false},
+		{"SNROM with other CHR bits", false, 0x0F, true},
+		{"CHR ROM board with CHR bit 4", true, 0x10, true},
+	}
+	for _, test := range tests {
+		info := testMMC1Info(2, 0)
+		if test.chrRom {
+			info.chrRomSize = 1
+			info.data.chrRom = make([]byte, CHR_ROM_SIZE)
+		}
+		mmu := newTestMMC1(t, info)
+		writeMMC1(t, mmu, addr_REG_CHR_BANK0, test.chrBank)
+		if err := mmu.write(0x42, addr_PRG_RAM); err != nil {
+			t.Fatal(err)
+		}
+		val, err := mmu.read(addr_PRG_RAM)
+		if test.enabled && (err != nil || val != 0x42) {
+			t.Errorf("%s: PRG RAM read $%02X, %v, want $42", test.name, val, err)
+		}
+		if !test.enabled && err == nil {
+			t.Errorf("%s: PRG RAM is enabled", test.name)
+		}
+		if !test.enabled {
+			// Enabling it again shows the write was lost
+			writeMMC1(t, mmu, addr_REG_CHR_BANK0, 0)
+			if val, _ := mmu.read(addr_PRG_RAM); val != 0 {
+				t.Errorf("%s: write to disabled PRG RAM landed", test.name)
+			}
+		}
+	}
+}
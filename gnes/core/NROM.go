@@ -4,27 +4,54 @@ type mapper_NROM struct {
 	prgRom [][]byte
 	prgRam []byte
 	chrRom []byte
+	chrRam bool // If chrRam, the cartridge has CHR RAM instead of CHR ROM
 
 	prgRomSize uint32
 	ppu        *ppu
 }
 
 func (mmu *mapper_NROM) write(val uint8, addr uint16) error {
+	if addr >= addr_PRG_RAM && addr < addr_PRG_ROM1 {
+		mmu.prgRam[uint32(addr-addr_PRG_RAM)%uint32(len(mmu.prgRam))] = val
+	}
 	return nil
 }
 
 func (mmu *mapper_NROM) read(addr uint16) (uint8, error) {
-	return 0, nil
+	ptr, err := mmu.getAddrPointer(addr)
+	if err != nil {
+		return 0, err
+	}
+	return *ptr, nil
 }
 
 func (mmu *mapper_NROM) getAddrPointer(addr uint16) (*uint8, error) {
-	return nil, nil
+	if addr >= addr_PRG_RAM && addr < addr_PRG_ROM1 {
+		return &mmu.prgRam[uint32(addr-addr_PRG_RAM)%uint32(len(mmu.prgRam))], nil
+	}
+	if addr < addr_PRG_ROM1 {
+		return nil, &gError{err_ADDR_OUT_OF_BOUNDS}
+	}
+	// NROM-128 mirrors its single bank at $C000
+	bank := uint32(addr-addr_PRG_ROM1) / PRG_ROM_SIZE % mmu.prgRomSize
+	return &mmu.prgRom[bank][addr%PRG_ROM_SIZE], nil
+}
+
+func (mmu *mapper_NROM) readChr(addr uint16) (uint8, error) {
+	return mmu.chrRom[addr%CHR_ROM_SIZE], nil
+}
+
+func (mmu *mapper_NROM) writeChr(val uint8, addr uint16) error {
+	if mmu.chrRam {
+		mmu.chrRom[addr%CHR_ROM_SIZE] = val
+	}
+	return nil
 }
 
 func newMapper_NROM(info *cartInfo, ppu *ppu) (mapper, error) {
 	mapper := &mapper_NROM{}
 
-	if uint32(len(info.data.prgRom))/PRG_ROM_SIZE != info.prgRomSize {
+	if uint32(len(info.data.prgRom))/PRG_ROM_SIZE != info.prgRomSize || info.prgRomSize == 0 {
 		return nil, &gError{err_INCONSISTENT_PRG_ROM_SIZE}
 	}
 
@@ -34,6 +61,30 @@ func newMapper_NROM(info *cartInfo, ppu *ppu) (mapper, error) {
 	for i := uint32(0); i < mapper.prgRomSize; i++ {
 		mapper.prgRom[i] = info.data.prgRom[i*PRG_ROM_SIZE : (i+1)*PRG_ROM_SIZE]
 	}
+
+	// Family BASIC has PRG RAM at $6000. iNES headers often leave its size as
+	// 0, which means 8K.
+	prgRamSize := info.prgRamSize + info.prgNvramSize
+	if prgRamSize == 0 {
+		prgRamSize = PRG_RAM_SIZE
+	}
+	mapper.prgRam = make([]byte, prgRamSize)
+
+	if info.chrRomSize == 0 {
+		mapper.chrRom = make([]byte, CHR_ROM_SIZE)
+		mapper.chrRam = true
+	} else {
+		mapper.chrRom = info.data.chrRom
+	}
+
+	mirroring := uint8(MIRROR_MODE_HORIZONTAL)
+	if info.mirror {
+		mirroring = MIRROR_MODE_VERITCAL
+	}
+	if err := ppu.setMirroring(mirroring); err != nil {
+		return nil, err
+	}
+
 	mapper.ppu = ppu
-	return nil, nil
+	return mapper, nil
 }
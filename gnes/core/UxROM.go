@@ -0,0 +1,110 @@
+package gnes
+
+// UxROM submappers
+const (
+	submapper_UXROM_NO_BUS_CONFLICTS = 1
+	submapper_UXROM_BUS_CONFLICTS    = 2
+)
+
+// mapper_UxROM switches a 16K PRG ROM bank at $8000, with the last bank fixed
+// at $C000. Any write to $8000-$FFFF selects the bank.
+type mapper_UxROM struct {
+	prgRom [][]byte
+	chrRom []byte
+	chrRam bool // If chrRam, the cartridge has CHR RAM instead of CHR ROM
+
+	prgRomSize,
+	prgRomBank uint32
+
+	// With bus conflicts, the ROM drives the data bus along with the CPU
+	// during writes, so the bank written is ANDed with the byte at the address
+	busConflicts bool
+
+	ppu *ppu
+}
+
+func (mmu *mapper_UxROM) write(val uint8, addr uint16) error {
+	if addr < addr_PRG_ROM1 {
+		return &gError{err_ADDR_OUT_OF_BOUNDS}
+	}
+	if mmu.busConflicts {
+		rom, err := mmu.read(addr)
+		if err != nil {
+			return err
+		}
+		val &= rom
+	}
+	mmu.prgRomBank = uint32(val) % mmu.prgRomSize
+	return nil
+}
+
+func (mmu *mapper_UxROM) read(addr uint16) (uint8, error) {
+	ptr, err := mmu.getAddrPointer(addr)
+	if err != nil {
+		return 0, err
+	}
+	return *ptr, nil
+}
+
+func (mmu *mapper_UxROM) getAddrPointer(addr uint16) (*uint8, error) {
+	if addr < addr_PRG_ROM1 {
+		return nil, &gError{err_ADDR_OUT_OF_BOUNDS}
+	}
+	if addr < addr_PRG_ROM2 {
+		return &mmu.prgRom[mmu.prgRomBank][addr-addr_PRG_ROM1], nil
+	}
+	return &mmu.prgRom[mmu.prgRomSize-1][addr-addr_PRG_ROM2], nil
+}
+
+func (mmu *mapper_UxROM) readChr(addr uint16) (uint8, error) {
+	return mmu.chrRom[addr%CHR_ROM_SIZE], nil
+}
+
+func (mmu *mapper_UxROM) writeChr(val uint8, addr uint16) error {
+	if mmu.chrRam {
+		mmu.chrRom[addr%CHR_ROM_SIZE] = val
+	}
+	return nil
+}
+
+func newMapper_UxROM(info *cartInfo, ppu *ppu) (mapper, error) {
+	mapper := &mapper_UxROM{}
+
+	if uint32(len(info.data.prgRom))/PRG_ROM_SIZE != info.prgRomSize || info.prgRomSize == 0 {
+		return nil, &gError{err_INCONSISTENT_PRG_ROM_SIZE}
+	}
+	mapper.prgRomSize = info.prgRomSize
+	mapper.prgRom = make([][]byte, mapper.prgRomSize)
+	for i := uint32(0); i < mapper.prgRomSize; i++ {
+		mapper.prgRom[i] = info.data.prgRom[i*PRG_ROM_SIZE : (i+1)*PRG_ROM_SIZE]
+	}
+
+	if info.chrRomSize == 0 {
+		mapper.chrRom = make([]byte, CHR_ROM_SIZE)
+		mapper.chrRam = true
+	} else {
+		mapper.chrRom = info.data.chrRom
+	}
+
+	// Without a submapper, only the iNES bus conflict flag says whether the
+	// board has them
+	switch info.submapper {
+	case submapper_UXROM_NO_BUS_CONFLICTS:
+		mapper.busConflicts = false
+	case submapper_UXROM_BUS_CONFLICTS:
+		mapper.busConflicts = true
+	default:
+		mapper.busConflicts = info.busConflict
+	}
+
+	mirroring := uint8(MIRROR_MODE_HORIZONTAL)
+	if info.mirror {
+		mirroring = MIRROR_MODE_VERITCAL
+	}
+	if err := ppu.setMirroring(mirroring); err != nil {
+		return nil, err
+	}
+
+	mapper.ppu = ppu
+	return mapper, nil
+}
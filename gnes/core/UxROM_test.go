@@ -0,0 +1,58 @@
+package gnes
+
+import "testing"
+
+func TestUxROMBusConflicts(t *testing.T) {
+	const (
+		// The last bank holds $01 here, so writing 2 with a bus conflict
+		// selects bank 0
+		conflictAddr = 0xC010
+		conflictRom  = 0x01
+	)
+	tests := []struct {
+		submapper    uint32
+		inesFlag     bool
+		wantConflict bool
+	}{
+		{0, false, false},
+		{0, true, true},
+		{submapper_UXROM_NO_BUS_CONFLICTS, false, false},
+		{submapper_UXROM_NO_BUS_CONFLICTS, true, false},
+		{submapper_UXROM_BUS_CONFLICTS, false, true},
+		{submapper_UXROM_BUS_CONFLICTS, true, true},
+	}
+	for _, test := range tests {
+		info := newCartInfo()
+		info.mapper = 2
+		info.submapper = test.submapper
+		info.busConflict = test.inesFlag
+		info.prgRomSize = 4
+		info.data.prgRom = make([]byte, 4*PRG_ROM_SIZE)
+		for i := range info.data.prgRom {
+			info.data.prgRom[i] = uint8(i / PRG_ROM_SIZE)
+		}
+		info.data.prgRom[3*PRG_ROM_SIZE+conflictAddr-addr_PRG_ROM2] = conflictRom
+		ppu, err := newPpu()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mmu, err := newMapper_UxROM(info, ppu)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mmu.write(2, conflictAddr); err != nil {
+			t.Fatal(err)
+		}
+		want := uint8(2)
+		if test.wantConflict {
+			want = 2 & conflictRom
+		}
+		if bank, _ := mmu.read(addr_PRG_ROM1); bank != want {
+			t.Errorf("submapper %d, iNES flag %t: bank %d mapped, want %d", test.submapper, test.inesFlag, bank, want)
+		}
+		if bank, _ := mmu.read(addr_PRG_ROM2); bank != 3 {
+			t.Errorf("submapper %d, iNES flag %t: bank %d fixed at $C000, want 3", test.submapper, test.inesFlag, bank)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package gnes
+
+// More controller slots, for the four player adapters
+const (
+	PORT_3 = 2
+	PORT_4 = 3
+)
+
+// DeviceType selects what's plugged into a controller port through Options.
+type DeviceType int
+
+const (
+	DEVICE_STANDARD DeviceType = iota
+	DEVICE_NONE
+	DEVICE_ZAPPER
+	DEVICE_PADDLE
+	DEVICE_POWER_PAD
+	DEVICE_KEYBOARD
+)
+
+// Adapter selects a four player adapter through Options.
+type Adapter int
+
+const (
+	ADAPTER_NONE Adapter = iota
+
+	// ADAPTER_FOUR_SCORE is the NES Four Score. Each port returns two
+	// controllers one after the other on D0, followed by a signature.
+	ADAPTER_FOUR_SCORE
+
+	// ADAPTER_FAMICOM_4P is a Famicom four player adapter in the expansion
+	// port. Controllers 3 and 4 are returned on D1 of JOY1 and JOY2.
+	ADAPTER_FAMICOM_4P
+)
+
+// Four Score signatures, read after the two controllers of each port. They're
+// in the order they're read, first bit lowest; games that shift each bit in
+// from the bottom see $10 for JOY1 and $20 for JOY2.
+const (
+	fourscore_SIGNATURE_1 uint8 = 0x08
+	fourscore_SIGNATURE_2 uint8 = 0x04
+
+	fourscore_BITS = 24
+)
+
+// fourScorePort is one port of a Four Score, which reads like a 24-bit shift
+// register: the first controller, the second, then the port's signature.
+type fourScorePort struct {
+	first,
+	second *StandardController
+	signature uint8
+
+	shift  uint32
+	strobe bool
+}
+
+func (fs *fourScorePort) load() {
+	fs.shift = uint32(fs.first.Buttons()) | uint32(fs.second.Buttons())<<8 | uint32(fs.signature)<<16
+}
+
+func (fs *fourScorePort) Strobe(high bool) {
+	fs.strobe = high
+	if high {
+		fs.load()
+	}
+}
+
+// Read returns the next bit. Like a standard controller, it returns 1 once
+// every bit has been read.
+func (fs *fourScorePort) Read() uint8 {
+	if fs.strobe {
+		fs.load()
+		return uint8(fs.shift & 1)
+	}
+	bit := uint8(fs.shift & 1)
+	fs.shift = (fs.shift >> 1) | (1 << (fourscore_BITS - 1))
+	return bit
+}
+
+// famicomAdapterPort is one port with a Famicom four player adapter attached.
+// The built in controller is on D0, and the adapter's on D1.
+type famicomAdapterPort struct {
+	builtIn,
+	expansion *StandardController
+}
+
+func (fc *famicomAdapterPort) Strobe(high bool) {
+	fc.builtIn.Strobe(high)
+	fc.expansion.Strobe(high)
+}
+
+func (fc *famicomAdapterPort) Read() uint8 {
+	return fc.builtIn.Read() | fc.expansion.Read()<<1
+}
+
+// applyInputOptions plugs in the devices the options ask for
+func (emu *Emulator) applyInputOptions() {
+	emu.adapterControllers = nil
+	switch emu.options.Adapter {
+	case ADAPTER_FOUR_SCORE, ADAPTER_FAMICOM_4P:
+		var ctrls [4]*StandardController
+		for i := range ctrls {
+			ctrls[i] = NewStandardController()
+		}
+		if emu.options.Adapter == ADAPTER_FOUR_SCORE {
+			emu.mmu.ports[PORT_1] = &fourScorePort{first: ctrls[0], second: ctrls[2], signature: fourscore_SIGNATURE_1}
+			emu.mmu.ports[PORT_2] = &fourScorePort{first: ctrls[1], second: ctrls[3], signature: fourscore_SIGNATURE_2}
+		} else {
+			emu.mmu.ports[PORT_1] = &famicomAdapterPort{ctrls[0], ctrls[2]}
+			emu.mmu.ports[PORT_2] = &famicomAdapterPort{ctrls[1], ctrls[3]}
+		}
+		emu.adapterControllers = ctrls[:]
+	default:
+		for port, deviceType := range emu.options.Ports {
+			emu.mmu.ports[port] = emu.newInputDevice(deviceType)
+		}
+	}
+	emu.input.apply(emu)
+}
+
+// newInputDevice creates a device of the given type
+func (emu *Emulator) newInputDevice(deviceType DeviceType) InputDevice {
+	switch deviceType {
+	case DEVICE_NONE:
+		return nil
+	case DEVICE_ZAPPER:
+		return emu.NewZapper()
+	case DEVICE_PADDLE:
+		return NewPaddle()
+	case DEVICE_POWER_PAD:
+		return NewPowerPad()
+	case DEVICE_KEYBOARD:
+		return NewKeyboard()
+	default:
+		return NewStandardController()
+	}
+}
+
+// inputDeviceType returns the type of a device, if it's one newInputDevice
+// creates
+func inputDeviceType(device InputDevice) (DeviceType, bool) {
+	switch device.(type) {
+	case nil:
+		return DEVICE_NONE, true
+	case *StandardController:
+		return DEVICE_STANDARD, true
+	case *Zapper:
+		return DEVICE_ZAPPER, true
+	case *Paddle:
+		return DEVICE_PADDLE, true
+	case *PowerPad:
+		return DEVICE_POWER_PAD, true
+	case *Keyboard:
+		return DEVICE_KEYBOARD, true
+	}
+	return 0, false
+}
@@ -0,0 +1,138 @@
+package gnes
+
+import "testing"
+
+// testNrom builds a 16K NROM cartridge filled with zeros
+func testNrom() []byte {
+	rom := make([]byte, HEADER_SIZE+PRG_ROM_SIZE+CHR_ROM_SIZE)
+	copy(rom, "NES\x1A\x01\x01")
+	return rom
+}
+
+func testEmulator(t *testing.T) *Emulator {
+	emu, err := NewEmulatorFromBytes(testNrom(), "test.nes", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return emu
+}
+
+// readJoyBits strobes the controllers, then reads 'addr' 'count' times the way
+// LDA abs would, with the high byte of the address left on the bus.
+func readJoyBits(t *testing.T, emu *Emulator, addr uint16, count int) []uint8 {
+	if err := emu.mmu.write(1, JOY1_ADDR); err != nil {
+		t.Fatal(err)
+	}
+	if err := emu.mmu.write(0, JOY1_ADDR); err != nil {
+		t.Fatal(err)
+	}
+	vals := make([]uint8, count)
+	for i := range vals {
+		emu.mmu.openBus = uint8(addr >> 8)
+		val, err := emu.mmu.read(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vals[i] = val
+	}
+	return vals
+}
+
+var testAdapterButtons = [4]Buttons{
+	BUTTON_A | BUTTON_START,
+	BUTTON_B | BUTTON_UP,
+	BUTTON_SELECT | BUTTON_RIGHT,
+	BUTTON_A | BUTTON_LEFT | BUTTON_DOWN,
+}
+
+func setAdapter(t *testing.T, emu *Emulator, adapter Adapter) {
+	options := emu.GetOptions()
+	options.Adapter = adapter
+	emu.SetOptions(options)
+	for port, buttons := range testAdapterButtons {
+		if err := emu.SetButtons(port, buttons); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFourScore(t *testing.T) {
+	emu := testEmulator(t)
+	setAdapter(t, emu, ADAPTER_FOUR_SCORE)
+
+	tests := []struct {
+		addr          uint16
+		first, second Buttons
+		signatureRead int
+	}{
+		{JOY1_ADDR, testAdapterButtons[PORT_1], testAdapterButtons[PORT_3], 20},
+		{JOY2_ADDR, testAdapterButtons[PORT_2], testAdapterButtons[PORT_4], 19},
+	}
+	for _, test := range tests {
+		vals := readJoyBits(t, emu, test.addr, 24)
+		for i, val := range vals {
+			read := i + 1
+			var want uint8
+			switch {
+			case i < 8:
+				want = uint8(test.first>>uint(i)) & 1
+			case i < 16:
+				want = uint8(test.second>>uint(i-8)) & 1
+			case read == test.signatureRead:
+				want = 1
+			}
+			if val&JOY_DATA_MASK != want {
+				t.Errorf("$%04X read %d: D0-D4 = %d, want %d", test.addr, read, val&JOY_DATA_MASK, want)
+			}
+			if val&^JOY_DATA_MASK != 0x40 {
+				t.Errorf("$%04X read %d: open bus bits = $%02X, want $40", test.addr, read, val&^JOY_DATA_MASK)
+			}
+		}
+
+		// Past the signature, the port returns 1s like a standard controller
+		vals = readJoyBits(t, emu, test.addr, 25)
+		if vals[24]&JOY_DATA_MASK != 1 {
+			t.Errorf("$%04X read 25: D0 = %d, want 1", test.addr, vals[24]&JOY_DATA_MASK)
+		}
+	}
+}
+
+func TestFamicomAdapter(t *testing.T) {
+	emu := testEmulator(t)
+	setAdapter(t, emu, ADAPTER_FAMICOM_4P)
+
+	tests := []struct {
+		addr         uint16
+		builtIn, ext Buttons
+	}{
+		{JOY1_ADDR, testAdapterButtons[PORT_1], testAdapterButtons[PORT_3]},
+		{JOY2_ADDR, testAdapterButtons[PORT_2], testAdapterButtons[PORT_4]},
+	}
+	for _, test := range tests {
+		vals := readJoyBits(t, emu, test.addr, 8)
+		for i, val := range vals {
+			want := uint8(test.builtIn>>uint(i))&1 | (uint8(test.ext>>uint(i))&1)<<1
+			if val&JOY_DATA_MASK != want {
+				t.Errorf("$%04X read %d: D0-D4 = %d, want %d", test.addr, i+1, val&JOY_DATA_MASK, want)
+			}
+			if val&^JOY_DATA_MASK != 0x40 {
+				t.Errorf("$%04X read %d: open bus bits = $%02X, want $40", test.addr, i+1, val&^JOY_DATA_MASK)
+			}
+		}
+	}
+}
+
+func TestSetInputDeviceDropsAdapter(t *testing.T) {
+	emu := testEmulator(t)
+	setAdapter(t, emu, ADAPTER_FOUR_SCORE)
+	if err := emu.SetInputDevice(PORT_2, emu.NewZapper()); err != nil {
+		t.Fatal(err)
+	}
+	options := emu.GetOptions()
+	if options.Adapter != ADAPTER_NONE || options.Ports != [2]DeviceType{DEVICE_STANDARD, DEVICE_ZAPPER} {
+		t.Errorf("options have adapter %d and ports %v after dropping the adapter", options.Adapter, options.Ports)
+	}
+	if err := emu.SetButtons(PORT_3, BUTTON_A); err == nil {
+		t.Error("PORT_3 still takes buttons")
+	}
+}
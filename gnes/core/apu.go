@@ -0,0 +1,276 @@
+package gnes
+
+// APU register addresses
+const (
+	SQ1_VOL_ADDR    = 0x4000
+	SQ1_SWEEP_ADDR  = 0x4001
+	SQ1_LO_ADDR     = 0x4002
+	SQ1_HI_ADDR     = 0x4003
+	SQ2_VOL_ADDR    = 0x4004
+	SQ2_SWEEP_ADDR  = 0x4005
+	SQ2_LO_ADDR     = 0x4006
+	SQ2_HI_ADDR     = 0x4007
+	TRI_LINEAR_ADDR = 0x4008
+	TRI_HI_ADDR     = 0x400B
+	NOISE_VOL_ADDR  = 0x400C
+	NOISE_HI_ADDR   = 0x400F
+	DMC_FREQ_ADDR   = 0x4010
+	DMC_LEN_ADDR    = 0x4013
+	SND_CHN_ADDR    = 0x4015
+)
+
+// SND_CHN bit masks
+const (
+	SND_CHN_PULSE1_MASK   uint8 = 0x01
+	SND_CHN_PULSE2_MASK   uint8 = 0x02
+	SND_CHN_TRIANGLE_MASK uint8 = 0x04
+	SND_CHN_NOISE_MASK    uint8 = 0x08
+	SND_CHN_DMC_MASK      uint8 = 0x10
+	SND_CHN_DMC_IRQ_MASK  uint8 = 0x80
+)
+
+// Channel register bit masks
+const (
+	apu_DUTY_MASK          uint8 = 0xC0
+	apu_LENGTH_HALT_MASK   uint8 = 0x20
+	apu_CONSTANT_VOL_MASK  uint8 = 0x10
+	apu_VOLUME_MASK        uint8 = 0x0F
+	apu_SWEEP_ENABLE_MASK  uint8 = 0x80
+	apu_SWEEP_PERIOD_MASK  uint8 = 0x70
+	apu_SWEEP_NEGATE_MASK  uint8 = 0x08
+	apu_SWEEP_SHIFT_MASK   uint8 = 0x07
+	apu_TIMER_HI_MASK      uint8 = 0x07
+	apu_LENGTH_INDEX_SHIFT       = 3
+)
+
+// lengthTable maps the 5-bit length index written to a channel's length
+// register onto the length counter value it loads.
+var lengthTable = [32]uint8{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+// apu is the audio processing unit of the 2A03. It's clocked by the CPU, and each
+// of its channels produces a 4-bit output that's mixed into the final signal.
+type apu struct {
+	pulse1,
+	pulse2 *pulse
+	triangle *triangle
+	noise    *noise
+	dmc      *dmc
+
+	frameCounter *frameCounter
+	mixer        *mixer
+
+	// cycles is the number of CPU cycles since power on
+	cycles uint64
+}
+
+// The APU's channels have different timers depending on the system, so it needs to
+// know which system the cartridge is for.
+func newApu(system uint32) (*apu, error) {
+	apu := &apu{}
+	apu.pulse1 = newPulse(true)
+	apu.pulse2 = newPulse(false)
+	apu.triangle = newTriangle()
+	apu.noise = newNoise(system)
+	apu.dmc = newDmc(system)
+	apu.frameCounter = newFrameCounter(system)
+	if system == SYS_PAL {
+		apu.mixer = newMixer(CPU_CLOCK_PAL)
+	} else {
+		apu.mixer = newMixer(CPU_CLOCK_NTSC)
+	}
+	return apu, nil
+}
+
+// reset puts the APU in its state after the console's reset button is pressed.
+// All channels are silenced, and the frame counter restarts in its last mode.
+func (apu *apu) reset() error {
+	err := apu.writeCPU(0, SND_CHN_ADDR)
+	if err != nil {
+		return err
+	}
+	apu.dmc.level &= 1
+	apu.frameCounter.irq = false
+	return apu.writeCPU(apu.frameCounter.value, FRAME_CNT_ADDR)
+}
+
+// setMmu connects the APU to the CPU's memory, which the DMC reads samples from
+func (apu *apu) setMmu(mmu *mmu) {
+	apu.dmc.mmu = mmu
+}
+
+// step clocks the APU for the given number of CPU cycles
+func (apu *apu) step(cycles uint64) error {
+	for i := uint64(0); i < cycles; i++ {
+		// The pulse timers are clocked every other CPU cycle
+		if apu.cycles%2 == 1 {
+			apu.pulse1.clockTimer()
+			apu.pulse2.clockTimer()
+		}
+		apu.triangle.clockTimer()
+		apu.noise.clockTimer()
+		err := apu.dmc.clockTimer()
+		if err != nil {
+			return err
+		}
+		apu.clockFrameCounter()
+		apu.mixer.clock(apu)
+		apu.cycles++
+	}
+	apu.mixer.flush()
+	return nil
+}
+
+// irqAsserted returns whether the APU is holding the CPU's IRQ line
+func (apu *apu) irqAsserted() bool {
+	return apu.dmc.irq || apu.frameCounter.irq
+}
+
+// clockQuarterFrame clocks the envelopes and the triangle's linear counter
+func (apu *apu) clockQuarterFrame() {
+	apu.pulse1.env.clock()
+	apu.pulse2.env.clock()
+	apu.triangle.clockLinearCounter()
+	apu.noise.env.clock()
+}
+
+// clockHalfFrame clocks the length counters and sweep units
+func (apu *apu) clockHalfFrame() {
+	apu.pulse1.clockHalfFrame()
+	apu.pulse2.clockHalfFrame()
+	apu.triangle.length.clock()
+	apu.noise.length.clock()
+}
+
+// writeCPU writes to an APU register available on the CPU's memory map
+func (apu *apu) writeCPU(val uint8, addr uint16) error {
+	switch {
+	case addr >= SQ1_VOL_ADDR && addr <= SQ1_HI_ADDR:
+		apu.pulse1.write(val, addr-SQ1_VOL_ADDR)
+	case addr >= SQ2_VOL_ADDR && addr <= SQ2_HI_ADDR:
+		apu.pulse2.write(val, addr-SQ2_VOL_ADDR)
+	case addr >= TRI_LINEAR_ADDR && addr <= TRI_HI_ADDR:
+		apu.triangle.write(val, addr-TRI_LINEAR_ADDR)
+	case addr >= NOISE_VOL_ADDR && addr <= NOISE_HI_ADDR:
+		apu.noise.write(val, addr-NOISE_VOL_ADDR)
+	case addr >= DMC_FREQ_ADDR && addr <= DMC_LEN_ADDR:
+		apu.dmc.write(val, addr-DMC_FREQ_ADDR)
+	case addr == SND_CHN_ADDR:
+		apu.pulse1.length.setEnabled((val & SND_CHN_PULSE1_MASK) != 0)
+		apu.pulse2.length.setEnabled((val & SND_CHN_PULSE2_MASK) != 0)
+		apu.triangle.length.setEnabled((val & SND_CHN_TRIANGLE_MASK) != 0)
+		apu.noise.length.setEnabled((val & SND_CHN_NOISE_MASK) != 0)
+		return apu.dmc.setEnabled((val & SND_CHN_DMC_MASK) != 0)
+	case addr == FRAME_CNT_ADDR:
+		apu.frameCounter.write(val, apu.cycles)
+	}
+	return nil
+}
+
+// readStatus reads SND_CHN, which reports which channels are still playing,
+// and the pending interrupts. Reading it acknowledges the frame IRQ.
+func (apu *apu) readStatus() uint8 {
+	var val uint8
+	if apu.pulse1.length.counter > 0 {
+		val |= SND_CHN_PULSE1_MASK
+	}
+	if apu.pulse2.length.counter > 0 {
+		val |= SND_CHN_PULSE2_MASK
+	}
+	if apu.triangle.length.counter > 0 {
+		val |= SND_CHN_TRIANGLE_MASK
+	}
+	if apu.noise.length.counter > 0 {
+		val |= SND_CHN_NOISE_MASK
+	}
+	if apu.dmc.bytesRemaining > 0 {
+		val |= SND_CHN_DMC_MASK
+	}
+	if apu.frameCounter.irq {
+		val |= SND_CHN_FRAME_IRQ_MASK
+	}
+	if apu.dmc.irq {
+		val |= SND_CHN_DMC_IRQ_MASK
+	}
+	apu.frameCounter.irq = false
+	return val
+}
+
+/***********************************************/
+/*               Shared units                  */
+/***********************************************/
+
+// envelope generates a decaying volume, or a constant one
+type envelope struct {
+	start,
+	loop,
+	constant bool
+
+	period,
+	divider,
+	decay uint8
+}
+
+// write sets the envelope from the low 6 bits of a channel's volume register
+func (env *envelope) write(val uint8) {
+	env.loop = (val & apu_LENGTH_HALT_MASK) != 0
+	env.constant = (val & apu_CONSTANT_VOL_MASK) != 0
+	env.period = val & apu_VOLUME_MASK
+}
+
+func (env *envelope) clock() {
+	if env.start {
+		env.start = false
+		env.decay = 15
+		env.divider = env.period
+		return
+	}
+	if env.divider > 0 {
+		env.divider--
+		return
+	}
+	env.divider = env.period
+	if env.decay > 0 {
+		env.decay--
+	} else if env.loop {
+		env.decay = 15
+	}
+}
+
+func (env *envelope) volume() uint8 {
+	if env.constant {
+		return env.period
+	}
+	return env.decay
+}
+
+// lengthCounter silences a channel after a set number of half frames
+type lengthCounter struct {
+	enabled,
+	halt bool
+	counter uint8
+}
+
+// load reloads the counter from the length table, if the channel is enabled
+func (length *lengthCounter) load(index uint8) {
+	if length.enabled {
+		length.counter = lengthTable[index&0x1F]
+	}
+}
+
+// setEnabled enables or disables the channel through SND_CHN. Disabling a
+// channel clears its counter immediately.
+func (length *lengthCounter) setEnabled(enabled bool) {
+	length.enabled = enabled
+	if !enabled {
+		length.counter = 0
+	}
+}
+
+func (length *lengthCounter) clock() {
+	if !length.halt && length.counter > 0 {
+		length.counter--
+	}
+}
@@ -0,0 +1,176 @@
+package gnes
+
+const (
+	dmc_IRQ_ENABLE_MASK uint8 = 0x80
+	dmc_LOOP_MASK       uint8 = 0x40
+	dmc_RATE_MASK       uint8 = 0x0F
+	dmc_LEVEL_MASK      uint8 = 0x7F
+
+	dmc_SAMPLE_BASE_ADDR = 0xC000
+	dmc_ADDR_UNIT        = 64
+	dmc_LENGTH_UNIT      = 16
+
+	// Cycles the CPU is halted for while the DMC fetches a sample byte. The
+	// real number depends on what the CPU is doing, and varies from 1 to 4.
+	dmc_FETCH_CYCLES = 4
+)
+
+// DMC timer periods, in CPU cycles
+var dmcRatesNTSC = [16]uint16{
+	428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54,
+}
+var dmcRatesPAL = [16]uint16{
+	398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50,
+}
+
+// dmc is the delta modulation channel. It plays 1-bit delta encoded samples
+// that it fetches from CPU memory by DMA, or a level written directly to it.
+type dmc struct {
+	mmu   *mmu
+	rates *[16]uint16
+
+	irqEnabled,
+	loop,
+	irq bool
+
+	timer,
+	rate uint16
+
+	// Memory reader
+	sampleAddr,
+	sampleLength,
+	currentAddr,
+	bytesRemaining uint16
+	sampleBuffer uint8
+	bufferFull   bool
+
+	// Output unit
+	shift         uint8
+	bitsRemaining uint8
+	silence       bool
+	level         uint8
+}
+
+func newDmc(system uint32) *dmc {
+	dmc := &dmc{}
+	dmc.rates = &dmcRatesNTSC
+	if system == SYS_PAL {
+		dmc.rates = &dmcRatesPAL
+	}
+	dmc.rate = dmc.rates[0]
+	dmc.bitsRemaining = 8
+	dmc.silence = true
+	return dmc
+}
+
+// write writes to register 'reg' (0-3) of the channel
+func (dmc *dmc) write(val uint8, reg uint16) {
+	switch reg {
+	case 0:
+		dmc.irqEnabled = (val & dmc_IRQ_ENABLE_MASK) != 0
+		if !dmc.irqEnabled {
+			dmc.irq = false
+		}
+		dmc.loop = (val & dmc_LOOP_MASK) != 0
+		dmc.rate = dmc.rates[val&dmc_RATE_MASK]
+	case 1:
+		dmc.level = val & dmc_LEVEL_MASK
+	case 2:
+		dmc.sampleAddr = dmc_SAMPLE_BASE_ADDR + uint16(val)*dmc_ADDR_UNIT
+	case 3:
+		dmc.sampleLength = uint16(val)*dmc_LENGTH_UNIT + 1
+	}
+}
+
+// setEnabled starts or stops sample playback through SND_CHN. Starting only
+// restarts the sample if the previous one has finished.
+func (dmc *dmc) setEnabled(enabled bool) error {
+	dmc.irq = false
+	if !enabled {
+		dmc.bytesRemaining = 0
+		return nil
+	}
+	if dmc.bytesRemaining == 0 {
+		dmc.restart()
+		return dmc.fetch()
+	}
+	return nil
+}
+
+func (dmc *dmc) restart() {
+	dmc.currentAddr = dmc.sampleAddr
+	dmc.bytesRemaining = dmc.sampleLength
+}
+
+// clockTimer clocks the timer once per CPU cycle. At the end of each period,
+// the output level moves up or down by 2 according to the next sample bit.
+func (dmc *dmc) clockTimer() error {
+	if dmc.timer > 0 {
+		dmc.timer--
+		return nil
+	}
+	dmc.timer = dmc.rate - 1
+
+	if !dmc.silence {
+		if (dmc.shift & 1) != 0 {
+			if dmc.level <= 125 {
+				dmc.level += 2
+			}
+		} else if dmc.level >= 2 {
+			dmc.level -= 2
+		}
+	}
+	dmc.shift >>= 1
+
+	dmc.bitsRemaining--
+	if dmc.bitsRemaining == 0 {
+		dmc.bitsRemaining = 8
+		dmc.silence = !dmc.bufferFull
+		if dmc.bufferFull {
+			dmc.shift = dmc.sampleBuffer
+			dmc.bufferFull = false
+		}
+		return dmc.fetch()
+	}
+	return nil
+}
+
+// fetch refills the sample buffer from memory, if it's empty and there's
+// still sample data left. The CPU is halted while the DMC reads.
+func (dmc *dmc) fetch() error {
+	if dmc.bufferFull || dmc.bytesRemaining == 0 {
+		return nil
+	}
+
+	err := dmc.mmu.dmcConflict()
+	if err != nil {
+		return err
+	}
+	val, err := dmc.mmu.read(dmc.currentAddr)
+	if err != nil {
+		return err
+	}
+	dmc.mmu.stallCycles += dmc_FETCH_CYCLES
+	dmc.sampleBuffer = val
+	dmc.bufferFull = true
+
+	// The address wraps around to $8000 rather than $0000
+	dmc.currentAddr++
+	if dmc.currentAddr == 0 {
+		dmc.currentAddr = 0x8000
+	}
+	dmc.bytesRemaining--
+	if dmc.bytesRemaining == 0 {
+		if dmc.loop {
+			dmc.restart()
+		} else if dmc.irqEnabled {
+			dmc.irq = true
+		}
+	}
+	return nil
+}
+
+// output returns the current 7-bit output of the channel
+func (dmc *dmc) output() uint8 {
+	return dmc.level
+}
@@ -0,0 +1,150 @@
+package gnes
+
+const (
+	FRAME_CNT_ADDR = 0x4017
+
+	SND_CHN_FRAME_IRQ_MASK uint8 = 0x40
+)
+
+// FRAME_CNT bit masks
+const (
+	frame_MODE_MASK    uint8 = 0x80
+	frame_INHIBIT_MASK uint8 = 0x40
+)
+
+// frameStep is a step of the frame sequencer, which happens 'cycle' CPU cycles
+// into the sequence.
+type frameStep struct {
+	cycle uint64
+
+	quarter,
+	half,
+	irq bool
+}
+
+// frameSequence is one of the two modes of the frame sequencer. The sequence
+// restarts once it's 'length' cycles long.
+type frameSequence struct {
+	steps  []frameStep
+	length uint64
+}
+
+// The frame sequences of each region. In 4-step mode, the IRQ flag is set on
+// three consecutive cycles, and 5-step mode never sets it.
+var (
+	frameSequence4NTSC = frameSequence{[]frameStep{
+		{7457, true, false, false},
+		{14913, true, true, false},
+		{22371, true, false, false},
+		{29828, false, false, true},
+		{29829, true, true, true},
+		{29830, false, false, true},
+	}, 29830}
+	frameSequence5NTSC = frameSequence{[]frameStep{
+		{7457, true, false, false},
+		{14913, true, true, false},
+		{22371, true, false, false},
+		{37281, true, true, false},
+	}, 37282}
+	frameSequence4PAL = frameSequence{[]frameStep{
+		{8313, true, false, false},
+		{16627, true, true, false},
+		{24939, true, false, false},
+		{33252, false, false, true},
+		{33253, true, true, true},
+		{33254, false, false, true},
+	}, 33254}
+	frameSequence5PAL = frameSequence{[]frameStep{
+		{8313, true, false, false},
+		{16627, true, true, false},
+		{24939, true, false, false},
+		{41565, true, true, false},
+	}, 41566}
+)
+
+// frameCounter drives the envelopes, sweeps, length counters and linear
+// counter, and raises the frame IRQ in 4-step mode.
+type frameCounter struct {
+	sequence4,
+	sequence5,
+	sequence *frameSequence
+
+	// cycles is the position in the current sequence, in CPU cycles
+	cycles uint64
+
+	inhibit,
+	irq bool
+
+	// The last value written to FRAME_CNT, which takes effect after a short
+	// delay, and is written again on reset
+	value        uint8
+	writePending bool
+	writeDelay   uint8
+}
+
+func newFrameCounter(system uint32) *frameCounter {
+	fc := &frameCounter{}
+	fc.sequence4 = &frameSequence4NTSC
+	fc.sequence5 = &frameSequence5NTSC
+	if system == SYS_PAL {
+		fc.sequence4 = &frameSequence4PAL
+		fc.sequence5 = &frameSequence5PAL
+	}
+	fc.sequence = fc.sequence4
+	return fc
+}
+
+// write writes FRAME_CNT. The IRQ inhibit flag takes effect immediately, but
+// the sequencer is only reset 3 or 4 CPU cycles later, depending on whether the
+// write lands on an APU cycle.
+func (fc *frameCounter) write(val uint8, cpuCycle uint64) {
+	fc.value = val
+	fc.inhibit = (val & frame_INHIBIT_MASK) != 0
+	if fc.inhibit {
+		fc.irq = false
+	}
+	fc.writePending = true
+	fc.writeDelay = 3
+	if cpuCycle%2 == 1 {
+		fc.writeDelay = 4
+	}
+}
+
+// clockFrameCounter advances the frame sequencer by one CPU cycle
+func (apu *apu) clockFrameCounter() {
+	fc := apu.frameCounter
+	if fc.writePending {
+		fc.writeDelay--
+		if fc.writeDelay == 0 {
+			fc.writePending = false
+			fc.cycles = 0
+			fc.sequence = fc.sequence4
+			if (fc.value & frame_MODE_MASK) != 0 {
+				// Switching to 5-step mode clocks everything straight away
+				fc.sequence = fc.sequence5
+				apu.clockQuarterFrame()
+				apu.clockHalfFrame()
+			}
+			return
+		}
+	}
+
+	fc.cycles++
+	for _, step := range fc.sequence.steps {
+		if step.cycle != fc.cycles {
+			continue
+		}
+		if step.quarter {
+			apu.clockQuarterFrame()
+		}
+		if step.half {
+			apu.clockHalfFrame()
+		}
+		if step.irq && !fc.inhibit {
+			fc.irq = true
+		}
+	}
+	if fc.cycles == fc.sequence.length {
+		fc.cycles = 0
+	}
+}
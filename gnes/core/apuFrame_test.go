@@ -0,0 +1,169 @@
+package gnes
+
+import "testing"
+
+// frameEvents clocks the APU one CPU cycle at a time, and returns the cycles,
+// counting from 1, on which quarter and half frame clocks happened. They're
+// seen through the triangle's linear and length counters.
+func frameEvents(t *testing.T, apu *apu, cycles int) (quarters, halves []int) {
+	apu.writeCPU(SND_CHN_TRIANGLE_MASK, SND_CHN_ADDR)
+	apu.writeCPU(0x7F, TRI_LINEAR_ADDR)
+	apu.writeCPU(0x08, TRI_HI_ADDR)
+	tri := apu.triangle
+	for i := 1; i <= cycles; i++ {
+		linear, length := tri.linearCounter, tri.length.counter
+		if err := apu.step(1); err != nil {
+			t.Fatal(err)
+		}
+		if tri.linearCounter != linear {
+			quarters = append(quarters, i)
+		}
+		if tri.length.counter != length {
+			halves = append(halves, i)
+		}
+	}
+	return quarters, halves
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFrameSequenceTiming(t *testing.T) {
+	tests := []struct {
+		name     string
+		system   uint32
+		fiveStep bool
+		cycles   int
+		quarters,
+		halves []int
+	}{
+		{"NTSC 4-step", SYS_NTSC, false, 29830 + 7457,
+			[]int{7457, 14913, 22371, 29829, 29830 + 7457},
+			[]int{14913, 29829}},
+		{"PAL 4-step", SYS_PAL, false, 33254 + 8313,
+			[]int{8313, 16627, 24939, 33253, 33254 + 8313},
+			[]int{16627, 33253}},
+		// The write to FRAME_CNT lands on cycle 0, so it takes effect on the
+		// third cycle, which clocks everything at once
+		{"NTSC 5-step", SYS_NTSC, true, 3 + 37282 + 7457,
+			[]int{3, 3 + 7457, 3 + 14913, 3 + 22371, 3 + 37281, 3 + 37282 + 7457},
+			[]int{3, 3 + 14913, 3 + 37281}},
+		{"PAL 5-step", SYS_PAL, true, 3 + 41566 + 8313,
+			[]int{3, 3 + 8313, 3 + 16627, 3 + 24939, 3 + 41565, 3 + 41566 + 8313},
+			[]int{3, 3 + 16627, 3 + 41565}},
+	}
+	for _, test := range tests {
+		apu, err := newApu(test.system)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.fiveStep {
+			apu.writeCPU(frame_MODE_MASK, FRAME_CNT_ADDR)
+		}
+		quarters, halves := frameEvents(t, apu, test.cycles)
+		if !equalInts(quarters, test.quarters) {
+			t.Errorf("%s: quarter frames on %v, want %v", test.name, quarters, test.quarters)
+		}
+		if !equalInts(halves, test.halves) {
+			t.Errorf("%s: half frames on %v, want %v", test.name, halves, test.halves)
+		}
+	}
+}
+
+func TestFrameIRQ(t *testing.T) {
+	tests := []struct {
+		name    string
+		system  uint32
+		last    uint64 // the cycle of the last step of the 4-step sequence
+		control uint8  // written to FRAME_CNT first, if not 0
+		irq     bool
+	}{
+		{"NTSC", SYS_NTSC, 29830, 0, true},
+		{"PAL", SYS_PAL, 33254, 0, true},
+		{"NTSC inhibited", SYS_NTSC, 29830, frame_INHIBIT_MASK, false},
+		{"PAL 5-step", SYS_PAL, 33254, frame_MODE_MASK, false},
+	}
+	for _, test := range tests {
+		apu, _ := newApu(test.system)
+		start := uint64(0)
+		if test.control != 0 {
+			apu.writeCPU(test.control, FRAME_CNT_ADDR)
+			apu.step(3)
+			start = 3
+		}
+		apu.step(test.last - 3 - start)
+		if apu.irqAsserted() {
+			t.Errorf("%s: IRQ raised early", test.name)
+		}
+		// The flag is set on the last three cycles of the sequence, so it's
+		// set again after being acknowledged
+		for i := 0; i < 3; i++ {
+			apu.step(1)
+			if apu.irqAsserted() != test.irq {
+				t.Errorf("%s: IRQ %t on cycle %d of 3, want %t", test.name, apu.irqAsserted(), i+1, test.irq)
+			}
+			status := apu.readStatus()
+			if ((status & SND_CHN_FRAME_IRQ_MASK) != 0) != test.irq {
+				t.Errorf("%s: SND_CHN %#02x on cycle %d of 3", test.name, status, i+1)
+			}
+			if apu.irqAsserted() {
+				t.Errorf("%s: reading SND_CHN didn't acknowledge the IRQ", test.name)
+			}
+		}
+		apu.step(1)
+		if apu.irqAsserted() {
+			t.Errorf("%s: IRQ raised after the sequence restarted", test.name)
+		}
+	}
+}
+
+func TestFrameIRQInhibitClearsFlag(t *testing.T) {
+	apu, _ := newApu(SYS_NTSC)
+	apu.step(29828)
+	if !apu.irqAsserted() {
+		t.Fatal("IRQ not raised")
+	}
+	apu.writeCPU(frame_INHIBIT_MASK, FRAME_CNT_ADDR)
+	if apu.irqAsserted() {
+		t.Error("setting the inhibit flag didn't clear the IRQ flag")
+	}
+}
+
+func TestFrameCounterWriteDelay(t *testing.T) {
+	tests := []struct {
+		before uint64 // cycles run before the write
+		delay  int
+	}{
+		{0, 3},
+		{1, 4},
+		{2, 3},
+		{7, 4},
+	}
+	for _, test := range tests {
+		apu, _ := newApu(SYS_NTSC)
+		apu.step(test.before)
+		apu.writeCPU(SND_CHN_TRIANGLE_MASK, SND_CHN_ADDR)
+		apu.writeCPU(0x08, TRI_HI_ADDR)
+		apu.writeCPU(frame_MODE_MASK, FRAME_CNT_ADDR)
+		// Switching to 5-step mode clocks a half frame as the write takes effect
+		delay := 0
+		for i := 1; i <= 10 && delay == 0; i++ {
+			apu.step(1)
+			if apu.triangle.length.counter != lengthTable[1] {
+				delay = i
+			}
+		}
+		if delay != test.delay {
+			t.Errorf("write after %d cycles took effect after %d cycles, want %d", test.before, delay, test.delay)
+		}
+	}
+}
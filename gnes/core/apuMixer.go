@@ -0,0 +1,272 @@
+package gnes
+
+// CPU clock rates, in Hz
+const (
+	CPU_CLOCK_NTSC = 236250000.0 / 132 // ~1789773
+	CPU_CLOCK_PAL  = 26601712.5 / 16   // ~1662607
+)
+
+// APU channels, as bits of a channel mask
+const (
+	CHANNEL_PULSE1   uint8 = 0x01
+	CHANNEL_PULSE2   uint8 = 0x02
+	CHANNEL_TRIANGLE uint8 = 0x04
+	CHANNEL_NOISE    uint8 = 0x08
+	CHANNEL_DMC      uint8 = 0x10
+	CHANNEL_ALL      uint8 = 0x1F
+
+	num_CHANNELS = 5
+)
+
+// channelNames are the names of the channels, in channel bit order
+var channelNames = [num_CHANNELS]string{"pulse1", "pulse2", "triangle", "noise", "dmc"}
+
+const (
+	DEFAULT_SAMPLE_RATE = 44100
+	MAX_SAMPLE_RATE     = 192000
+
+	// Filters between the DAC and the output jack of the console
+	mixer_HIGH_PASS_1 = 90.0
+	mixer_HIGH_PASS_2 = 440.0
+	mixer_LOW_PASS    = 14000.0
+)
+
+// audioTap receives a mix of some of the APU's channels at its own sample
+// rate, filtered like the console's audio output, and buffers it until it's read.
+type audioTap struct {
+	sampleRate int
+	blip       *blipBuffer
+	filters    []*firstOrderFilter
+	ring       *sampleRing
+
+	// channels is the mask of channels mixed into the tap. If live is set, it
+	// follows the mixer's mute and solo settings.
+	channels uint8
+	live     bool
+	level    float32
+}
+
+func newAudioTap(clockRate float64, sampleRate int, channels uint8, live bool) *audioTap {
+	tap := &audioTap{}
+	tap.sampleRate = sampleRate
+	tap.channels = channels
+	tap.live = live
+	tap.blip = newBlipBuffer(clockRate, sampleRate)
+	tap.filters = []*firstOrderFilter{
+		newFirstOrderFilter(true, mixer_HIGH_PASS_1, sampleRate),
+		newFirstOrderFilter(true, mixer_HIGH_PASS_2, sampleRate),
+		newFirstOrderFilter(false, mixer_LOW_PASS, sampleRate),
+	}
+	// Up to a second of audio is kept for readers that fall behind
+	tap.ring = newSampleRing(sampleRate)
+	return tap
+}
+
+// setLevel moves the tap's output to a new level at the current time
+func (tap *audioTap) setLevel(level float32) {
+	tap.blip.addDelta(level - tap.level)
+	tap.level = level
+}
+
+func (tap *audioTap) flush() {
+	tap.blip.flush(func(sample float32) {
+		for _, filter := range tap.filters {
+			sample = filter.apply(sample)
+		}
+		tap.ring.write(sample)
+	})
+}
+
+// mixer combines the outputs of the APU channels the way the 2A03's DACs do.
+// The two pulse channels share one DAC, and the other three share another, so
+// the channels aren't simply added together.
+type mixer struct {
+	clockRate float64
+
+	// The channel outputs last mixed, in channel bit order
+	outputs [num_CHANNELS]uint8
+
+	// Channels muted or soloed in live taps
+	muted,
+	solo uint8
+
+	// output is what ReadSamples reads; any other taps belong to e.g. dumpers
+	output *audioTap
+	taps   []*audioTap
+}
+
+func newMixer(clockRate float64) *mixer {
+	mix := &mixer{}
+	mix.clockRate = clockRate
+	mix.output = mix.addTap(DEFAULT_SAMPLE_RATE, CHANNEL_ALL, true)
+	return mix
+}
+
+// addTap adds a tap mixing the given channels. Live taps mix the channels that
+// aren't muted instead.
+func (mix *mixer) addTap(sampleRate int, channels uint8, live bool) *audioTap {
+	if live {
+		channels = mix.liveChannels()
+	}
+	tap := newAudioTap(mix.clockRate, sampleRate, channels, live)
+	tap.setLevel(mix.mixLevel(channels))
+	mix.taps = append(mix.taps, tap)
+	return tap
+}
+
+// liveChannels returns the channels that can be heard with the current mute
+// and solo settings. Soloed channels override the muted ones.
+func (mix *mixer) liveChannels() uint8 {
+	if mix.solo != 0 {
+		return mix.solo
+	}
+	return CHANNEL_ALL &^ mix.muted
+}
+
+func (mix *mixer) updateLiveTaps() {
+	for _, tap := range mix.taps {
+		if tap.live {
+			tap.channels = mix.liveChannels()
+			tap.setLevel(mix.mixLevel(tap.channels))
+		}
+	}
+}
+
+func (mix *mixer) removeTap(tap *audioTap) {
+	for i, t := range mix.taps {
+		if t == tap {
+			mix.taps = append(mix.taps[:i], mix.taps[i+1:]...)
+			return
+		}
+	}
+}
+
+// pulseLevel and tndLevel are the non-linear DAC formulas
+func pulseLevel(pulse1, pulse2 uint8) float32 {
+	if pulse1+pulse2 == 0 {
+		return 0
+	}
+	return 95.88 / (8128/float32(pulse1+pulse2) + 100)
+}
+
+func tndLevel(triangle, noise, dmc uint8) float32 {
+	sum := float32(triangle)/8227 + float32(noise)/12241 + float32(dmc)/22638
+	if sum == 0 {
+		return 0
+	}
+	return 159.79 / (1/sum + 100)
+}
+
+// mixLevel returns the level of the given channels mixed together, as if the
+// other channels were silent
+func (mix *mixer) mixLevel(channels uint8) float32 {
+	var outputs [num_CHANNELS]uint8
+	for i := range outputs {
+		if (channels & (1 << uint(i))) != 0 {
+			outputs[i] = mix.outputs[i]
+		}
+	}
+	return pulseLevel(outputs[0], outputs[1]) + tndLevel(outputs[2], outputs[3], outputs[4])
+}
+
+// clock mixes the channels for one CPU cycle
+func (mix *mixer) clock(apu *apu) {
+	outputs := [num_CHANNELS]uint8{
+		apu.pulse1.output(),
+		apu.pulse2.output(),
+		apu.triangle.output(),
+		apu.noise.output(),
+		apu.dmc.output(),
+	}
+	if outputs != mix.outputs {
+		mix.outputs = outputs
+		for _, tap := range mix.taps {
+			tap.setLevel(mix.mixLevel(tap.channels))
+		}
+	}
+
+	for _, tap := range mix.taps {
+		tap.blip.clock()
+		if tap.blip.finished() >= blip_FLUSH_SAMPLES {
+			tap.flush()
+		}
+	}
+}
+
+// flush finishes all the samples that can be finished
+func (mix *mixer) flush() {
+	for _, tap := range mix.taps {
+		tap.flush()
+	}
+}
+
+/***********************************************/
+/*                  Audio API                  */
+/***********************************************/
+
+// SetSampleRate sets the sample rate of the audio returned by ReadSamples, and
+// discards any samples that haven't been read yet.
+func (emu *Emulator) SetSampleRate(rate int) error {
+	if rate <= 0 || rate > MAX_SAMPLE_RATE {
+		return gError1New(err_INVALID_SAMPLE_RATE, uint64(rate))
+	}
+	mix := emu.apu.mixer
+	mix.removeTap(mix.output)
+	mix.output = mix.addTap(rate, CHANNEL_ALL, true)
+	return nil
+}
+
+// SampleRate returns the sample rate of the audio returned by ReadSamples.
+func (emu *Emulator) SampleRate() int {
+	return emu.apu.mixer.output.sampleRate
+}
+
+// ReadSamples reads up to len(out) mono samples, between -1 and 1, of the audio
+// generated so far, and returns how many were read. Up to a second of audio is
+// buffered; if it isn't read in time, the oldest samples are dropped.
+func (emu *Emulator) ReadSamples(out []float32) int {
+	return emu.apu.mixer.output.ring.read(out)
+}
+
+// SamplesAvailable returns the number of samples ReadSamples can read.
+func (emu *Emulator) SamplesAvailable() int {
+	return emu.apu.mixer.output.ring.count
+}
+
+// SetMutedChannels mutes the given channels (a mask of CHANNEL_ bits) in the
+// live output, video dumps and mixed audio recordings. Stems are unaffected.
+func (emu *Emulator) SetMutedChannels(channels uint8) error {
+	if (channels &^ CHANNEL_ALL) != 0 {
+		return gError1New(err_INVALID_CHANNELS, uint64(channels))
+	}
+	emu.apu.mixer.muted = channels
+	emu.apu.mixer.updateLiveTaps()
+	return nil
+}
+
+// MutedChannels returns the mask of muted channels.
+func (emu *Emulator) MutedChannels() uint8 {
+	return emu.apu.mixer.muted
+}
+
+// SetSoloChannels makes only the given channels (a mask of CHANNEL_ bits)
+// heard wherever muting applies, regardless of which are muted. A mask of 0
+// turns solo off.
+func (emu *Emulator) SetSoloChannels(channels uint8) error {
+	if (channels &^ CHANNEL_ALL) != 0 {
+		return gError1New(err_INVALID_CHANNELS, uint64(channels))
+	}
+	emu.apu.mixer.solo = channels
+	emu.apu.mixer.updateLiveTaps()
+	return nil
+}
+
+// SoloChannels returns the mask of soloed channels.
+func (emu *Emulator) SoloChannels() uint8 {
+	return emu.apu.mixer.solo
+}
+
+// ChannelNames returns the names of the channels, in channel bit order.
+func ChannelNames() []string {
+	return channelNames[:]
+}
@@ -0,0 +1,82 @@
+package gnes
+
+const (
+	noise_MODE_MASK   uint8 = 0x80
+	noise_PERIOD_MASK uint8 = 0x0F
+)
+
+// Noise timer periods, in CPU cycles
+var noisePeriodsNTSC = [16]uint16{
+	4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068,
+}
+var noisePeriodsPAL = [16]uint16{
+	4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778,
+}
+
+// noise is the pseudo-random noise channel, driven by a 15-bit linear
+// feedback shift register.
+type noise struct {
+	periods *[16]uint16
+
+	// In short mode, feedback is taken from bit 6 instead of bit 1, which
+	// gives a 93 step sequence with a metallic tone
+	shortMode bool
+	shift     uint16
+
+	timer,
+	period uint16
+
+	env    envelope
+	length lengthCounter
+}
+
+func newNoise(system uint32) *noise {
+	noise := &noise{}
+	noise.periods = &noisePeriodsNTSC
+	if system == SYS_PAL {
+		noise.periods = &noisePeriodsPAL
+	}
+	noise.period = noise.periods[0]
+	noise.shift = 1
+	return noise
+}
+
+// write writes to register 'reg' (0-3) of the channel. Register 1 is unused.
+func (noise *noise) write(val uint8, reg uint16) {
+	switch reg {
+	case 0:
+		noise.length.halt = (val & apu_LENGTH_HALT_MASK) != 0
+		noise.env.write(val)
+	case 2:
+		noise.shortMode = (val & noise_MODE_MASK) != 0
+		noise.period = noise.periods[val&noise_PERIOD_MASK]
+	case 3:
+		noise.length.load(val >> apu_LENGTH_INDEX_SHIFT)
+		noise.env.start = true
+	}
+}
+
+// clockTimer clocks the timer once per CPU cycle, shifting the LFSR at the end
+// of every period
+func (noise *noise) clockTimer() {
+	if noise.timer > 0 {
+		noise.timer--
+		return
+	}
+	noise.timer = noise.period - 1
+
+	tap := uint(1)
+	if noise.shortMode {
+		tap = 6
+	}
+	feedback := (noise.shift ^ (noise.shift >> tap)) & 1
+	noise.shift = (noise.shift >> 1) | (feedback << 14)
+}
+
+// output returns the current 4-bit output of the channel
+func (noise *noise) output() uint8 {
+	if noise.length.counter == 0 || (noise.shift&1) != 0 {
+		return 0
+	}
+	return noise.env.volume()
+}
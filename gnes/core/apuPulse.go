@@ -0,0 +1,122 @@
+package gnes
+
+const (
+	pulse_MIN_PERIOD = 8
+	pulse_MAX_PERIOD = 0x7FF
+)
+
+// pulseDuties holds the 8-step waveforms of the four pulse duty cycles
+var pulseDuties = [4][8]uint8{
+	{0, 1, 0, 0, 0, 0, 0, 0}, // 12.5%
+	{0, 1, 1, 0, 0, 0, 0, 0}, // 25%
+	{0, 1, 1, 1, 1, 0, 0, 0}, // 50%
+	{1, 0, 0, 1, 1, 1, 1, 1}, // 25% negated
+}
+
+// pulse is one of the two square wave channels
+type pulse struct {
+	// The sweep unit of pulse 1 negates with ones' complement, while pulse 2
+	// uses two's complement, so the two channels sweep down by different amounts.
+	onesComplement bool
+
+	duty,
+	step uint8
+
+	timer,
+	period uint16
+
+	env    envelope
+	length lengthCounter
+
+	sweepEnabled,
+	sweepNegate,
+	sweepReload bool
+	sweepPeriod,
+	sweepDivider,
+	sweepShift uint8
+}
+
+func newPulse(onesComplement bool) *pulse {
+	pulse := &pulse{}
+	pulse.onesComplement = onesComplement
+	return pulse
+}
+
+// write writes to register 'reg' (0-3) of the channel
+func (pulse *pulse) write(val uint8, reg uint16) {
+	switch reg {
+	case 0:
+		pulse.duty = (val & apu_DUTY_MASK) >> 6
+		pulse.length.halt = (val & apu_LENGTH_HALT_MASK) != 0
+		pulse.env.write(val)
+	case 1:
+		pulse.sweepEnabled = (val & apu_SWEEP_ENABLE_MASK) != 0
+		pulse.sweepPeriod = (val & apu_SWEEP_PERIOD_MASK) >> 4
+		pulse.sweepNegate = (val & apu_SWEEP_NEGATE_MASK) != 0
+		pulse.sweepShift = val & apu_SWEEP_SHIFT_MASK
+		pulse.sweepReload = true
+	case 2:
+		pulse.period = (pulse.period & 0x700) | uint16(val)
+	case 3:
+		pulse.period = (pulse.period & 0xFF) | (uint16(val&apu_TIMER_HI_MASK) << 8)
+		pulse.length.load(val >> apu_LENGTH_INDEX_SHIFT)
+		pulse.step = 0
+		pulse.env.start = true
+	}
+}
+
+// clockTimer clocks the timer, which steps through the duty cycle every
+// period+1 APU cycles
+func (pulse *pulse) clockTimer() {
+	if pulse.timer > 0 {
+		pulse.timer--
+		return
+	}
+	pulse.timer = pulse.period
+	pulse.step = (pulse.step + 1) % 8
+}
+
+// sweepTarget returns the period the sweep unit is moving towards. It's
+// computed continuously, and mutes the channel when it overflows, even if
+// the sweep unit is disabled.
+func (pulse *pulse) sweepTarget() int {
+	change := int(pulse.period >> pulse.sweepShift)
+	if !pulse.sweepNegate {
+		return int(pulse.period) + change
+	}
+	if pulse.onesComplement {
+		change++
+	}
+	return int(pulse.period) - change
+}
+
+func (pulse *pulse) muted() bool {
+	return pulse.period < pulse_MIN_PERIOD || pulse.sweepTarget() > pulse_MAX_PERIOD
+}
+
+// clockHalfFrame clocks the length counter and the sweep unit
+func (pulse *pulse) clockHalfFrame() {
+	pulse.length.clock()
+
+	if pulse.sweepDivider == 0 && pulse.sweepEnabled && pulse.sweepShift != 0 && !pulse.muted() {
+		target := pulse.sweepTarget()
+		if target < 0 {
+			target = 0
+		}
+		pulse.period = uint16(target)
+	}
+	if pulse.sweepDivider == 0 || pulse.sweepReload {
+		pulse.sweepDivider = pulse.sweepPeriod
+		pulse.sweepReload = false
+	} else {
+		pulse.sweepDivider--
+	}
+}
+
+// output returns the current 4-bit output of the channel
+func (pulse *pulse) output() uint8 {
+	if pulse.length.counter == 0 || pulse.muted() || pulseDuties[pulse.duty][pulse.step] == 0 {
+		return 0
+	}
+	return pulse.env.volume()
+}
@@ -0,0 +1,81 @@
+package gnes
+
+const (
+	triangle_CONTROL_MASK uint8 = 0x80
+	triangle_LINEAR_MASK  uint8 = 0x7F
+)
+
+// triangleSequence is the 32-step waveform of the triangle channel
+var triangleSequence = [32]uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// triangle is the triangle wave channel. It has no volume control, but a
+// linear counter that silences it with finer resolution than the length counter.
+type triangle struct {
+	step uint8
+
+	timer,
+	period uint16
+
+	length lengthCounter
+
+	// The control flag halts the length counter, and keeps the linear counter
+	// reloading
+	control,
+	linearReload bool
+	linearPeriod,
+	linearCounter uint8
+}
+
+func newTriangle() *triangle {
+	return &triangle{}
+}
+
+// write writes to register 'reg' (0-3) of the channel. Register 1 is unused.
+func (tri *triangle) write(val uint8, reg uint16) {
+	switch reg {
+	case 0:
+		tri.control = (val & triangle_CONTROL_MASK) != 0
+		tri.length.halt = tri.control
+		tri.linearPeriod = val & triangle_LINEAR_MASK
+	case 2:
+		tri.period = (tri.period & 0x700) | uint16(val)
+	case 3:
+		tri.period = (tri.period & 0xFF) | (uint16(val&apu_TIMER_HI_MASK) << 8)
+		tri.length.load(val >> apu_LENGTH_INDEX_SHIFT)
+		tri.linearReload = true
+	}
+}
+
+// clockTimer clocks the timer, which is clocked every CPU cycle, unlike the
+// pulse timers. The sequencer only moves while both counters are non-zero, so
+// a silenced triangle holds its last output level rather than dropping to 0.
+func (tri *triangle) clockTimer() {
+	if tri.timer > 0 {
+		tri.timer--
+		return
+	}
+	tri.timer = tri.period
+	if tri.length.counter > 0 && tri.linearCounter > 0 {
+		tri.step = (tri.step + 1) % 32
+	}
+}
+
+// clockLinearCounter clocks the linear counter, every quarter frame
+func (tri *triangle) clockLinearCounter() {
+	if tri.linearReload {
+		tri.linearCounter = tri.linearPeriod
+	} else if tri.linearCounter > 0 {
+		tri.linearCounter--
+	}
+	if !tri.control {
+		tri.linearReload = false
+	}
+}
+
+// output returns the current 4-bit output of the channel
+func (tri *triangle) output() uint8 {
+	return triangleSequence[tri.step]
+}
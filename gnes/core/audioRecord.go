@@ -0,0 +1,146 @@
+package gnes
+
+import "path/filepath"
+import "strings"
+
+// audioRecorder writes the audio to WAV files, either the mix heard through the
+// live output, or one file per channel. It's drained after every frame.
+type audioRecorder struct {
+	taps    []*audioTap
+	writers []*wavWriter
+	buf     []float32
+
+	// The number of frames to record, or 0 to record until stopped
+	frames,
+	seen uint64
+}
+
+// stemPath returns the path of a channel's stem, e.g. "song_pulse1.wav" for
+// "song.wav"
+func stemPath(path string, channel int) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + channelNames[channel] + ext
+}
+
+func newAudioRecorder(mix *mixer, path string, sampleRate int, frames uint64, stems bool) (*audioRecorder, error) {
+	rec := &audioRecorder{}
+	rec.frames = frames
+	rec.buf = make([]float32, sampleRate)
+
+	paths := []string{path}
+	if stems {
+		paths = paths[:0]
+		for i := 0; i < num_CHANNELS; i++ {
+			paths = append(paths, stemPath(path, i))
+		}
+	}
+	for _, p := range paths {
+		wav, err := newWavWriter(p, sampleRate, 1)
+		if err != nil {
+			rec.close(mix)
+			return nil, err
+		}
+		rec.writers = append(rec.writers, wav)
+	}
+
+	// The taps are only added once all the files are open
+	if stems {
+		for i := range rec.writers {
+			rec.taps = append(rec.taps, mix.addTap(sampleRate, 1<<uint(i), false))
+		}
+	} else {
+		rec.taps = append(rec.taps, mix.addTap(sampleRate, CHANNEL_ALL, true))
+	}
+	return rec, nil
+}
+
+// drain writes everything the taps have buffered so far
+func (rec *audioRecorder) drain() error {
+	for i, tap := range rec.taps {
+		for tap.ring.count > 0 {
+			n := tap.ring.read(rec.buf)
+			err := rec.writers[i].writeSamples(rec.buf[:n])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (rec *audioRecorder) frameDone(emu *Emulator) error {
+	err := rec.drain()
+	if err != nil {
+		return err
+	}
+	rec.seen++
+	if rec.frames != 0 && rec.seen >= rec.frames {
+		return emu.StopAudioRecording()
+	}
+	return nil
+}
+
+// close removes the taps and closes the files, returning the first error
+func (rec *audioRecorder) close(mix *mixer) error {
+	for _, tap := range rec.taps {
+		mix.removeTap(tap)
+	}
+	var err error
+	for _, wav := range rec.writers {
+		closeErr := wav.close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+/***********************************************/
+/*              Audio recording API            */
+/***********************************************/
+
+// StartAudioRecording starts writing the audio to a WAV file at path, at the
+// current sample rate. The mix follows the channels muted or soloed. If stems
+// is set, each channel is written to its own file instead, named after the
+// channel, e.g. "song_triangle.wav" for "song.wav", regardless of muting.
+// Recording stops on its own after 'frames' frames, or when StopAudioRecording
+// is called if frames is 0.
+func (emu *Emulator) StartAudioRecording(path string, frames int, stems bool) error {
+	if emu.audioRecorder != nil {
+		return &gError{err_ALREADY_RECORDING_AUDIO}
+	}
+	if frames < 0 {
+		return gError1New(err_INVALID_RECORD_LENGTH, uint64(frames))
+	}
+	rec, err := newAudioRecorder(emu.apu.mixer, path, emu.SampleRate(), uint64(frames), stems)
+	if err != nil {
+		return err
+	}
+	emu.audioRecorder = rec
+	emu.addFrameSink(rec)
+	return nil
+}
+
+// StopAudioRecording stops the current audio recording, writes whatever audio
+// is left, and closes its files.
+func (emu *Emulator) StopAudioRecording() error {
+	if emu.audioRecorder == nil {
+		return &gError{err_NOT_RECORDING_AUDIO}
+	}
+	rec := emu.audioRecorder
+	emu.removeFrameSink(rec)
+	emu.audioRecorder = nil
+
+	emu.apu.mixer.flush()
+	err := rec.drain()
+	closeErr := rec.close(emu.apu.mixer)
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// IsRecordingAudio returns whether an audio recording is in progress.
+func (emu *Emulator) IsRecordingAudio() bool {
+	return emu.audioRecorder != nil
+}
@@ -0,0 +1,110 @@
+package gnes
+
+import "os"
+import "path/filepath"
+import "testing"
+
+// blargg's test ROMs report through PRG RAM: $6001-$6003 hold a signature once
+// the status at $6000 is valid, and the status is $80 while running, $81 when
+// the console should be reset, or else the result, 0 for a pass. A message
+// follows at $6004.
+const (
+	blargg_STATUS_ADDR  = 0x6000
+	blargg_MESSAGE_ADDR = 0x6004
+
+	blargg_RUNNING = 0x80
+	blargg_RESET   = 0x81
+
+	// Emulated frames before a ROM is given up on, and before a requested
+	// reset is pressed
+	blargg_TIMEOUT_FRAMES = 60 * 60
+	blargg_RESET_FRAMES   = 10
+)
+
+var blarggSignature = []byte{0xDE, 0xB0, 0x61}
+
+// blarggApuRoms are the single ROMs of apu_test. 3, 4 and 6 cover the frame
+// counter and its IRQ.
+var blarggApuRoms = []string{
+	"1-len_ctr.nes",
+	"2-len_table.nes",
+	"3-irq_flag.nes",
+	"4-jitter.nes",
+	"5-len_timing.nes",
+	"6-irq_flag_timing.nes",
+	"7-dmc_basics.nes",
+	"8-dmc_rates.nes",
+}
+
+// runBlarggRom runs a test ROM until it reports a result, and returns the
+// result and message.
+func runBlarggRom(t *testing.T, path string) (uint8, string) {
+	emu, err := NewEmulator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetAt := -1
+	for frame := 0; frame < blargg_TIMEOUT_FRAMES; frame++ {
+		if err := emu.StepFrame(); err != nil {
+			if gErr, ok := err.(*gError2); ok && gErr.errType == err_UNSUPPORTED_OPCODE {
+				t.Skipf("the CPU can't run the ROM yet: %v", err)
+			}
+			t.Fatal(err)
+		}
+		if !blarggStarted(emu) {
+			continue
+		}
+		status, _ := emu.ReadAddr(blargg_STATUS_ADDR)
+		switch {
+		case status == blargg_RESET && resetAt < 0:
+			resetAt = frame + blargg_RESET_FRAMES
+		case status == blargg_RESET && frame >= resetAt:
+			resetAt = -1
+			if err := emu.Reset(); err != nil {
+				t.Fatal(err)
+			}
+		case status != blargg_RUNNING && status != blargg_RESET:
+			return status, blarggMessage(emu)
+		}
+	}
+	t.Fatalf("no result after %d frames", blargg_TIMEOUT_FRAMES)
+	return 0, ""
+}
+
+func blarggStarted(emu *Emulator) bool {
+	for i, b := range blarggSignature {
+		val, err := emu.ReadAddr(blargg_STATUS_ADDR + 1 + uint16(i))
+		if err != nil || val != b {
+			return false
+		}
+	}
+	return true
+}
+
+func blarggMessage(emu *Emulator) string {
+	var msg []byte
+	for addr := uint16(blargg_MESSAGE_ADDR); addr < addr_PRG_ROM1; addr++ {
+		val, err := emu.ReadAddr(addr)
+		if err != nil || val == 0 {
+			break
+		}
+		msg = append(msg, val)
+	}
+	return string(msg)
+}
+
+// TestBlarggApu runs blargg's apu_test ROMs from testdata/blargg. They aren't
+// distributed with the source, so the test is skipped without them.
+func TestBlarggApu(t *testing.T) {
+	for _, name := range blarggApuRoms {
+		path := filepath.Join("testdata", "blargg", name)
+		t.Run(name, func(t *testing.T) {
+			if _, err := os.Stat(path); err != nil {
+				t.Skip("ROM not found")
+			}
+			if result, msg := runBlarggRom(t, path); result != 0 {
+				t.Errorf("failed with result %d: %s", result, msg)
+			}
+		})
+	}
+}
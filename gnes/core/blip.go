@@ -0,0 +1,187 @@
+package gnes
+
+import "math"
+
+// Band-limited synthesis. The APU's output only changes in steps, so instead of
+// filtering the signal at the CPU clock rate, each step is added directly to
+// the output as a band-limited step, at its exact fractional sample position.
+const (
+	blip_PHASES = 32 // sub-sample positions a step can be placed at
+	blip_TAPS   = 16 // output samples each step is spread over
+	blip_CUTOFF = 0.45
+
+	// How far ahead of the finished samples the buffer can get before it's
+	// flushed, in samples
+	blip_FLUSH_SAMPLES = 1024
+)
+
+// blipKernel holds, for each phase, how much of a unit step lands in each
+// of the blip_TAPS samples around it.
+var blipKernel = makeBlipKernel()
+
+// makeBlipKernel integrates a Blackman windowed sinc into a step response, and
+// differentiates it at each output sample, for every phase.
+func makeBlipKernel() [blip_PHASES + 1][blip_TAPS]float32 {
+	var kernel [blip_PHASES + 1][blip_TAPS]float32
+	const steps = 64 // integration steps per sample
+	centre := float64(blip_TAPS) / 2
+
+	impulse := func(t float64) float64 {
+		if t <= -centre || t >= centre {
+			return 0
+		}
+		window := 0.42 + 0.5*math.Cos(math.Pi*t/centre) + 0.08*math.Cos(2*math.Pi*t/centre)
+		x := 2 * blip_CUTOFF * t
+		if x == 0 {
+			return 2 * blip_CUTOFF * window
+		}
+		return 2 * blip_CUTOFF * window * math.Sin(math.Pi*x) / (math.Pi * x)
+	}
+
+	for phase := 0; phase <= blip_PHASES; phase++ {
+		offset := float64(phase) / blip_PHASES
+		var sum float64
+		var taps [blip_TAPS]float64
+		for i := range taps {
+			// Integrate the impulse over the sample period ending at sample i
+			start := float64(i) - 1 - centre - offset
+			for s := 0; s < steps; s++ {
+				taps[i] += impulse(start+(float64(s)+0.5)/steps) / steps
+			}
+			sum += taps[i]
+		}
+		for i := range taps {
+			kernel[phase][i] = float32(taps[i] / sum)
+		}
+	}
+	return kernel
+}
+
+// blipBuffer turns steps at arbitrary times into samples at the output rate
+type blipBuffer struct {
+	// deltas holds the change in level at each sample, starting at the first
+	// sample that isn't finished yet
+	deltas []float32
+
+	// pos is the position of the current time, in samples from deltas[0], and
+	// ratio is how far it moves each clock
+	pos,
+	ratio float64
+
+	level float32
+}
+
+func newBlipBuffer(clockRate float64, sampleRate int) *blipBuffer {
+	blip := &blipBuffer{}
+	blip.deltas = make([]float32, blip_FLUSH_SAMPLES+blip_TAPS+1)
+	blip.ratio = float64(sampleRate) / clockRate
+	return blip
+}
+
+// addDelta adds a step of 'delta' at the current time
+func (blip *blipBuffer) addDelta(delta float32) {
+	base := int(blip.pos)
+	phase := int((blip.pos-float64(base))*blip_PHASES + 0.5)
+	for i, weight := range blipKernel[phase] {
+		blip.deltas[base+i] += delta * weight
+	}
+}
+
+// clock moves the current time forward by one clock
+func (blip *blipBuffer) clock() {
+	blip.pos += blip.ratio
+}
+
+// finished returns the number of samples no future step can change
+func (blip *blipBuffer) finished() int {
+	return int(blip.pos)
+}
+
+// flush passes the finished samples to out, and removes them from the buffer
+func (blip *blipBuffer) flush(out func(sample float32)) {
+	count := blip.finished()
+	for i := 0; i < count; i++ {
+		blip.level += blip.deltas[i]
+		out(blip.level)
+	}
+	copy(blip.deltas, blip.deltas[count:])
+	for i := len(blip.deltas) - count; i < len(blip.deltas); i++ {
+		blip.deltas[i] = 0
+	}
+	blip.pos -= float64(count)
+}
+
+/***********************************************/
+/*                  Filters                    */
+/***********************************************/
+
+// firstOrderFilter is a single pole high-pass or low-pass filter
+type firstOrderFilter struct {
+	highPass bool
+	alpha    float32
+
+	lastIn,
+	lastOut float32
+}
+
+func newFirstOrderFilter(highPass bool, cutoff float64, sampleRate int) *firstOrderFilter {
+	filter := &firstOrderFilter{}
+	filter.highPass = highPass
+	rc := 1 / (2 * math.Pi * cutoff)
+	dt := 1 / float64(sampleRate)
+	if highPass {
+		filter.alpha = float32(rc / (rc + dt))
+	} else {
+		filter.alpha = float32(dt / (rc + dt))
+	}
+	return filter
+}
+
+func (filter *firstOrderFilter) apply(in float32) float32 {
+	if filter.highPass {
+		filter.lastOut = filter.alpha * (filter.lastOut + in - filter.lastIn)
+	} else {
+		filter.lastOut += filter.alpha * (in - filter.lastOut)
+	}
+	filter.lastIn = in
+	return filter.lastOut
+}
+
+/***********************************************/
+/*                 Ring buffer                 */
+/***********************************************/
+
+// sampleRing is a fixed size FIFO of samples. When it's full, the oldest
+// samples are dropped to make room.
+type sampleRing struct {
+	buf []float32
+	start,
+	count int
+}
+
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{buf: make([]float32, size)}
+}
+
+func (ring *sampleRing) write(sample float32) {
+	if ring.count == len(ring.buf) {
+		ring.start = (ring.start + 1) % len(ring.buf)
+		ring.count--
+	}
+	ring.buf[(ring.start+ring.count)%len(ring.buf)] = sample
+	ring.count++
+}
+
+// read moves up to len(out) samples into out, and returns how many were moved
+func (ring *sampleRing) read(out []float32) int {
+	n := len(out)
+	if n > ring.count {
+		n = ring.count
+	}
+	for i := 0; i < n; i++ {
+		out[i] = ring.buf[(ring.start+i)%len(ring.buf)]
+	}
+	ring.start = (ring.start + n) % len(ring.buf)
+	ring.count -= n
+	return n
+}
@@ -8,6 +8,21 @@ const (
 	BIT_6_MASK    = 0x40
 )
 
+// Processor status bits, as pushed onto the stack
+const (
+	flag_C      = 0x01
+	flag_Z      = 0x02
+	flag_I      = 0x04
+	flag_D      = 0x08
+	flag_B      = 0x10
+	flag_UNUSED = 0x20
+	flag_V      = 0x40
+	flag_N      = 0x80
+)
+
+// Number of cycles taken to service an interrupt
+const INTERRUPT_CYCLES = 7
+
 const (
 	mode_IM     = 0
 	mode_ZERO   = 1
@@ -47,7 +62,7 @@ var opText = []string{
 	"BPL", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", // 1
 	"JSR", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "BIT", "NA", "NA", "NA", // 2
 	"NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", // 3
-	"NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "LSR", "NA", "JMP", "NA", "NA", "NA", // 4
+	"RTI", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "LSR", "NA", "JMP", "NA", "NA", "NA", // 4
 	"NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", // 5
 	"RTS", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", // 6
 	"NA", "NA", "NA", "NA", "NA", "NA", "NA", "NA", "SEI", "NA", "NA", "NA", "NA", "NA", "NA", "NA", // 7
@@ -67,7 +82,7 @@ var opArray = []func(*cpu) error{
 	(*cpu).op_BPL, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, // 1
 	(*cpu).op_JSR, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).op_BIT, (*cpu).z, (*cpu).z, (*cpu).z, // 2
 	(*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, // 3
-	(*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).op_LSR, (*cpu).z, (*cpu).op_JMP, (*cpu).z, (*cpu).z, (*cpu).z, // 4
+	(*cpu).op_RTI, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).op_LSR, (*cpu).z, (*cpu).op_JMP, (*cpu).z, (*cpu).z, (*cpu).z, // 4
 	(*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, // 5
 	(*cpu).op_RTS, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, // 6
 	(*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).op_SEI, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, (*cpu).z, // 7
@@ -86,7 +101,7 @@ var opMode = []int{
 	mode_REL, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, // 1
 	mode_ABS, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_ABS, mode_NI, mode_NI, mode_NI, // 2
 	mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, // 3
-	mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_A, mode_NI, mode_ABS, mode_NI, mode_NI, mode_NI, // 4
+	mode_IMP, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_A, mode_NI, mode_ABS, mode_NI, mode_NI, mode_NI, // 4
 	mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, // 5
 	mode_IMP, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, // 6
 	mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_IMP, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, mode_NI, // 7
@@ -106,7 +121,7 @@ var opCycles = []uint64{
 	2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // 1
 	6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, // 2
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // 3
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 3, 0, 0, 0, // 4
+	6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 3, 0, 0, 0, // 4
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // 5
 	6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // 6
 	0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, // 7
@@ -126,7 +141,7 @@ var opSrc = []int{
 	loc_NA, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 1
 	loc_ABS, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_ABS, loc_NI, loc_NI, loc_NI, // 2
 	loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 3
-	loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_A, loc_NI, loc_NA, loc_NI, loc_NI, loc_NI, // 4
+	loc_NA, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_A, loc_NI, loc_NA, loc_NI, loc_NI, loc_NI, // 4
 	loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 5
 	loc_NA, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 6
 	loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NA, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 7
@@ -146,7 +161,7 @@ var opDst = []int{
 	loc_NA, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 1
 	loc_NA, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NA, loc_NI, loc_NI, loc_NI, // 2
 	loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 3
-	loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_A, loc_NI, loc_NA, loc_NI, loc_NI, loc_NI, // 4
+	loc_NA, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_A, loc_NI, loc_NA, loc_NI, loc_NI, loc_NI, // 4
 	loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 5
 	loc_NA, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 6
 	loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NA, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, loc_NI, // 7
@@ -205,6 +220,9 @@ func newCpu(mmu *mmu) (*cpu, error) {
 	cpu := &cpu{}
 	cpu.mmu = mmu
 	cpu.regs = newRegs()
+	// Interrupts are disabled at power on, until the program is ready for them
+	cpu.regs.i = true
+	cpu.regs.sp = 0xFD
 	err := cpu.initPC()
 	if err != nil {
 		return nil, err
@@ -225,11 +243,32 @@ func (cpu *cpu) initPC() error {
 	return nil
 }
 
+// reset does what the CPU does when the reset line is pulled. It behaves like
+// an interrupt, except that nothing is actually written to the stack.
+func (cpu *cpu) reset() error {
+	cpu.regs.sp -= 3
+	cpu.regs.i = true
+	cpu.cycles += INTERRUPT_CYCLES
+	return cpu.initPC()
+}
+
 // stepInstruction is the main method of progressing emulation. It
 // fetches the instruction at the current PC and executes it accordingly,
 // and returns the number of cycles taken.
 func (cpu *cpu) stepInstruction() (uint64, error) {
 	previousCycles := cpu.cycles
+
+	// IRQs are level triggered, and polled between instructions. Servicing one
+	// takes the place of an instruction.
+	if !cpu.regs.i && cpu.mmu.irqAsserted() {
+		err := cpu.interrupt(vector_IRQ)
+		if err != nil {
+			return 0, err
+		}
+		cpu.cycles += cpu.mmu.takeStallCycles()
+		return cpu.cycles - previousCycles, nil
+	}
+
 	addr := cpu.regs.pc
 	op, err := cpu.mmu.read(addr)
 	if err != nil {
@@ -240,6 +279,7 @@ func (cpu *cpu) stepInstruction() (uint64, error) {
 	if err != nil {
 		return 0, err
 	}
+	cpu.cycles += cpu.mmu.takeStallCycles()
 	newCycles := cpu.cycles
 	return newCycles - previousCycles, nil
 }
@@ -571,10 +611,96 @@ func (cpu *cpu) pop16() (uint16, error) {
 	return make16BitValue(msByte, lsByte), nil
 }
 
+// getStatus packs the flags into the processor status byte. brk sets the B
+// flag, which only exists on the stack copy pushed by BRK and PHP.
+func (cpu *cpu) getStatus(brk bool) uint8 {
+	regs := cpu.regs
+	var status uint8 = flag_UNUSED
+	if regs.c {
+		status |= flag_C
+	}
+	if regs.z {
+		status |= flag_Z
+	}
+	if regs.i {
+		status |= flag_I
+	}
+	if regs.d {
+		status |= flag_D
+	}
+	if brk {
+		status |= flag_B
+	}
+	if regs.v {
+		status |= flag_V
+	}
+	if regs.n {
+		status |= flag_N
+	}
+	return status
+}
+
+// setStatus unpacks the processor status byte into the flags
+func (cpu *cpu) setStatus(status uint8) {
+	regs := cpu.regs
+	regs.c = (status & flag_C) != 0
+	regs.z = (status & flag_Z) != 0
+	regs.i = (status & flag_I) != 0
+	regs.d = (status & flag_D) != 0
+	regs.v = (status & flag_V) != 0
+	regs.n = (status & flag_N) != 0
+}
+
+// interrupt pushes the PC and status onto the stack, and jumps to the handler
+// pointed to by vector.
+func (cpu *cpu) interrupt(vector uint16) error {
+	err := cpu.push16(cpu.regs.pc)
+	if err != nil {
+		return err
+	}
+	err = cpu.push(cpu.getStatus(false))
+	if err != nil {
+		return err
+	}
+	cpu.regs.i = true
+
+	newPC, err := cpu.mmu.read16(vector)
+	if err != nil {
+		return err
+	}
+	cpu.regs.pc = newPC
+	cpu.cycles += INTERRUPT_CYCLES
+	return nil
+}
+
 /***********************************************/
 /*             Opcode Functions                */
 /***********************************************/
 
+// op_RTI is responsible for returning from interrupt handlers
+func (cpu *cpu) op_RTI() error {
+	cycles, err := cpu.getOpCycles()
+	if err != nil {
+		return err
+	}
+
+	status, err := cpu.pop()
+	if err != nil {
+		return err
+	}
+	cpu.setStatus(status)
+
+	newPC, err := cpu.pop16()
+	if err != nil {
+		return err
+	}
+	cpu.regs.pc = newPC
+
+	cpu.cycles += cycles
+
+	return nil
+}
+
 // op_RTS is responsible for returning from subroutines
 func (cpu *cpu) op_RTS() error {
 	cycles, err := cpu.getOpCycles()
@@ -0,0 +1,162 @@
+package gnes
+
+import "bufio"
+import "fmt"
+import "image/color"
+import "os"
+
+// Sample rate of dumped audio
+const DUMP_SAMPLE_RATE = 48000
+
+// dumper writes every completed frame to a YUV4MPEG2 stream, and a matching
+// amount of audio to a WAV file, so external tools can encode them losslessly.
+type dumper struct {
+	file  *os.File
+	video *bufio.Writer
+	audio *wavWriter
+	tap   *audioTap
+
+	frameRateNum,
+	frameRateDen uint64
+
+	width,
+	height int
+
+	frames,
+	samples uint64
+	planes []byte
+}
+
+func newDumper(videoPath, audioPath string, frameRateNum, frameRateDen uint64) (*dumper, error) {
+	dump := &dumper{}
+	dump.frameRateNum = frameRateNum
+	dump.frameRateDen = frameRateDen
+
+	file, err := os.Create(videoPath)
+	if err != nil {
+		return nil, err
+	}
+	dump.file = file
+	dump.video = bufio.NewWriter(file)
+
+	if audioPath != "" {
+		dump.audio, err = newWavWriter(audioPath, DUMP_SAMPLE_RATE, 1)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return dump, nil
+}
+
+func (dump *dumper) frameDone(emu *Emulator) error {
+	img := emu.Frame()
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+
+	if dump.frames == 0 {
+		// The stream header needs the frame size, so it's written with the first frame
+		dump.width = width
+		dump.height = height
+		dump.planes = make([]byte, 3*width*height)
+		_, err := fmt.Fprintf(dump.video, "YUV4MPEG2 W%d H%d F%d:%d Ip A1:1 C444 XCOLORRANGE=FULL\n",
+			width, height, dump.frameRateNum, dump.frameRateDen)
+		if err != nil {
+			return err
+		}
+	} else if width != dump.width || height != dump.height {
+		return &gError{err_RECORDING_SIZE_CHANGED}
+	}
+
+	size := width * height
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(x, y)
+			lum, cb, cr := color.RGBToYCbCr(img.Pix[i], img.Pix[i+1], img.Pix[i+2])
+			dump.planes[y*width+x] = lum
+			dump.planes[size+y*width+x] = cb
+			dump.planes[2*size+y*width+x] = cr
+		}
+	}
+	_, err := dump.video.WriteString("FRAME\n")
+	if err != nil {
+		return err
+	}
+	_, err = dump.video.Write(dump.planes)
+	if err != nil {
+		return err
+	}
+	dump.frames++
+
+	if dump.audio == nil {
+		return nil
+	}
+	// The number of samples is derived from the exact frame rate, so the audio
+	// never drifts from the video.
+	total := dump.frames * DUMP_SAMPLE_RATE * dump.frameRateDen / dump.frameRateNum
+	samples := make([]float32, total-dump.samples)
+	dump.samples = total
+	// The mixer's output lags slightly behind the emulation, so if it's short,
+	// the last sample is repeated. Anything left over goes in the next frame.
+	n := dump.tap.ring.read(samples)
+	for i := n; i < len(samples); i++ {
+		if i > 0 {
+			samples[i] = samples[i-1]
+		}
+	}
+	return dump.audio.writeSamples(samples)
+}
+
+func (dump *dumper) close() error {
+	err := dump.video.Flush()
+	if err == nil {
+		err = dump.file.Close()
+	} else {
+		dump.file.Close()
+	}
+	if dump.audio != nil {
+		audioErr := dump.audio.close()
+		if err == nil {
+			err = audioErr
+		}
+	}
+	return err
+}
+
+/***********************************************/
+/*                  Dump API                   */
+/***********************************************/
+
+// StartDump starts writing every completed frame to a YUV4MPEG2 file at videoPath,
+// and the audio to a WAV file at audioPath, at the exact frame rate of the
+// cartridge's region. If audioPath is empty, no audio is written.
+func (emu *Emulator) StartDump(videoPath, audioPath string) error {
+	if emu.dumper != nil {
+		return &gError{err_ALREADY_DUMPING}
+	}
+	num, den := emu.FrameRateFraction()
+	dump, err := newDumper(videoPath, audioPath, num, den)
+	if err != nil {
+		return err
+	}
+	if dump.audio != nil {
+		dump.tap = emu.apu.mixer.addTap(DUMP_SAMPLE_RATE, CHANNEL_ALL, true)
+	}
+	emu.dumper = dump
+	emu.addFrameSink(dump)
+	return nil
+}
+
+// StopDump stops the current dump and closes its files.
+func (emu *Emulator) StopDump() error {
+	if emu.dumper == nil {
+		return &gError{err_NOT_DUMPING}
+	}
+	dump := emu.dumper
+	emu.removeFrameSink(dump)
+	if dump.tap != nil {
+		emu.apu.mixer.removeTap(dump.tap)
+	}
+	emu.dumper = nil
+	return dump.close()
+}
@@ -1,13 +1,14 @@
 package gnes
 
-import "io/ioutil"
 import "bytes"
-
-//import "fmt"
+import "crypto/md5"
+import "path/filepath"
+import "strings"
 
 // file format section address enum
 const (
 	TRAINER_START_ADDR = 0x10
+	HEADER_SIZE        = 0x10
 )
 
 // file format section size enum
@@ -27,6 +28,33 @@ const (
 	SYS_NTSC_PAL = 0x3
 )
 
+// NES 2.0 CPU/PPU timing enum
+const (
+	TIMING_NTSC  = 0x0
+	TIMING_PAL   = 0x1
+	TIMING_MULTI = 0x2
+	TIMING_DENDY = 0x3
+)
+
+// console type enum
+const (
+	CONSOLE_NES      = 0x0
+	CONSOLE_VS       = 0x1
+	CONSOLE_PC10     = 0x2
+	CONSOLE_EXTENDED = 0x3
+)
+
+// frames per second of each system, as exact fractions of the master clock
+const (
+	FRAME_RATE_NTSC_NUM = 39375000
+	FRAME_RATE_NTSC_DEN = 655171
+	FRAME_RATE_PAL_NUM  = 322445
+	FRAME_RATE_PAL_DEN  = 6448
+
+	FRAME_RATE_NTSC = float64(FRAME_RATE_NTSC_NUM) / FRAME_RATE_NTSC_DEN // ~60.0988
+	FRAME_RATE_PAL  = float64(FRAME_RATE_PAL_NUM) / FRAME_RATE_PAL_DEN   // ~50.0070
+)
+
 // bit mask enum
 const (
 	NES2_MASK            = 0xc
@@ -41,6 +69,21 @@ const (
 	TV_SYS_MASK          = 0x3
 	PRG_RAM_PRESENT_MASK = 0x10
 	BUS_CONFLICT_MASK    = 0x20
+	CONSOLE_TYPE_MASK    = 0x3
+	NES2_MAPPER_HI_MASK  = 0x0f
+	SUBMAPPER_MASK       = 0xf0
+	NES2_PRG_ROM_HI_MASK = 0x0f
+	NES2_CHR_ROM_HI_MASK = 0xf0
+	ROM_EXPONENT_MASK    = 0xfc
+	ROM_MULTIPLIER_MASK  = 0x03
+	RAM_SHIFT_MASK       = 0x0f
+	NVRAM_SHIFT_MASK     = 0xf0
+	NES2_TIMING_MASK     = 0x03
+	VS_PPU_MASK          = 0x0f
+	VS_HARDWARE_MASK     = 0xf0
+	EXT_CONSOLE_MASK     = 0x0f
+	MISC_ROMS_MASK       = 0x03
+	EXPANSION_MASK       = 0x3f
 )
 
 // bit flag enum
@@ -56,6 +99,7 @@ const (
 	PAL_FLAG             = 0x2
 	PRG_RAM_PRESENT_FLAG = 0x10
 	BUS_CONFLICT_FLAG    = 0x20
+	ROM_EXPONENT_FLAG    = 0xf
 )
 
 // gameData contains the raw data sections from the rom file
@@ -67,18 +111,37 @@ type gameData struct {
 
 	pcInstRom,
 	pcProm []byte
+
+	// miscRom is whatever follows CHR ROM in a NES 2.0 file
+	miscRom []byte
 }
 
 // cartInfo contains iNES or NES 2.0 header information
 type cartInfo struct {
 	nes2 bool // If nes2, this is a NES2 format file, otherwise iNES
 
+	// The ROM sizes are in 16K and 8K units. RAM sizes are in bytes, split
+	// into volatile RAM and battery backed NVRAM.
 	prgRomSize,
 	chrRomSize,
 	prgRamSize,
+	prgNvramSize,
+	chrRamSize,
+	chrNvramSize,
 	mapper,
+	submapper,
 	system uint32
 
+	// NES 2.0 only: a TIMING_ value, a CONSOLE_ value and its details, the
+	// number of miscellaneous ROMs and the default expansion device
+	timing,
+	consoleType,
+	vsPpuType,
+	vsHardwareType,
+	extConsoleType,
+	miscRoms,
+	expansionDevice uint32
+
 	mirror,
 	prgRamBatBacked,
 	trainer,
@@ -88,6 +151,20 @@ type cartInfo struct {
 	prgRamPresent,
 	busConflict bool
 
+	// mapperFallback is set when the submapper isn't supported, and the
+	// mapper's default behaviour is used instead
+	mapperFallback bool
+
+	// dirtyHeader is set when bytes 7-15 of an iNES header hold junk, which
+	// are then ignored
+	dirtyHeader bool
+
+	// The game's title if the ROM database identified it, and the header
+	// fields the database corrected
+	title      string
+	identified bool
+	overrides  []string
+
 	data *gameData
 }
 
@@ -96,7 +173,43 @@ type Emulator struct {
 	cpu  *cpu
 	mmu  *mmu
 	ppu  *ppu
+	apu  *apu
 	info *cartInfo
+
+	filter   FrameFilter
+	overscan Overscan
+	options  Options
+
+	// The controllers of a four player adapter, if one is plugged in
+	adapterControllers []*StandardController
+
+	// frameSinks are notified of every completed frame
+	frameSinks    []frameSink
+	lastSeenFrame uint64
+	recorder      *recorder
+	dumper        *dumper
+	audioRecorder *audioRecorder
+
+	// nsf is set when playing an NSF file instead of a cartridge
+	nsf *nsfPlayer
+
+	// The name of the ROM file without its extension, and the MD5 of its data
+	romName     string
+	romChecksum [md5.Size]byte
+
+	movieRecorder *movieRecorder
+	moviePlayer   *moviePlayer
+
+	// report holds the problems found when the ROM was loaded
+	report *LoadReport
+
+	input *inputLayer
+}
+
+// frameSink is implemented by anything that consumes completed frames,
+// e.g. recorders.
+type frameSink interface {
+	frameDone(emu *Emulator) error
 }
 
 func (emu *Emulator) ReadCpu(addr uint16) (uint8, error) {
@@ -107,13 +220,18 @@ func (emu *Emulator) ReadCpu(addr uint16) (uint8, error) {
 	return val, nil
 }
 func NewEmulator(path string) (*Emulator, error) {
+	return NewEmulatorWithOptions(path, LoadOptions{})
+}
+
+// newEmulator creates an emulator with nothing loaded
+func newEmulator() *Emulator {
 	emu := &Emulator{}
 	emu.info = newCartInfo()
-	err := emu.loadRom(path)
-	if err != nil {
-		return nil, err
-	}
-	return emu, nil
+	emu.filter = NewPaletteFilter()
+	emu.overscan = OVERSCAN_NONE
+	emu.input = newInputLayer()
+	emu.report = &LoadReport{}
+	return emu
 }
 
 func newCartInfo() *cartInfo {
@@ -122,61 +240,248 @@ func newCartInfo() *cartInfo {
 	return info
 }
 
-// Given a path to an iNES or NES2 format ROM,
+// Given an iNES, NES2 or NSF format ROM and its file name,
 // loads the ROM such that emulation is ready to begin
-func (emu *Emulator) loadRom(path string) error {
+func (emu *Emulator) loadRom(rom []byte, name string, options LoadOptions) error {
 	var err error
-	rom, err := ioutil.ReadFile(path)
+	name = filepath.Base(name)
+	emu.romName = strings.TrimSuffix(name, filepath.Ext(name))
+	if bytes.HasPrefix(rom, fdsMagic) || strings.EqualFold(filepath.Ext(name), ".fds") {
+		return &gError{err_FDS_UNSUPPORTED}
+	}
+	if isNsf(rom) {
+		emu.romChecksum = md5.Sum(rom)
+		err = emu.loadNsf(rom)
+		if err != nil {
+			return err
+		}
+		if expansion := emu.nsf.info.Expansion; expansion != 0 {
+			emu.report.add(PROBLEM_NSF_EXPANSION, SEVERITY_WARNING,
+				"Expansion sound chips aren't emulated, so the %s channels are silent", expansionNames(expansion))
+		}
+		return nil
+	}
+
+	emu.report = ValidateRom(rom)
+	if options.Repair {
+		rom = repairRom(rom, emu.report)
+	}
+	err = emu.info.loadCartInfo(rom)
 	if err != nil {
 		return err
 	}
-	err = emu.info.loadCartInfo(rom)
+	// The junk was ignored, as the ROM database knew better
+	if emu.info.dirtyHeader {
+		for _, kind := range []ProblemKind{PROBLEM_DISKDUDE, PROBLEM_DIRTY_HEADER} {
+			if problem := emu.report.find(kind); problem != nil {
+				problem.Repaired = true
+			}
+		}
+	}
+	if err = emu.report.err(); err != nil {
+		return err
+	}
+
+	// Like FCEUX, the checksum covers the ROM data but not the header
+	hash := md5.New()
+	hash.Write(emu.info.data.prgRom)
+	hash.Write(emu.info.data.chrRom)
+	copy(emu.romChecksum[:], hash.Sum(nil))
+	err = emu.powerOn()
 	if err != nil {
 		return err
 	}
+	if emu.info.mapperFallback {
+		emu.report.add(PROBLEM_SUBMAPPER_FALLBACK, SEVERITY_WARNING,
+			"Submapper %d of mapper %d is unsupported, using the mapper's default behaviour",
+			emu.info.submapper, emu.info.mapper)
+	}
+	return nil
+}
 
+// powerOn creates the console's components in their power on state. When the
+// console is power cycled, everything attached from outside (hooks, audio
+// taps, input devices and options) is carried over to the new components.
+func (emu *Emulator) powerOn() error {
 	ppu, err := newPpu()
 	if err != nil {
 		return err
 	}
-	emu.ppu = ppu
+	apu, err := newApu(emu.info.system)
+	if err != nil {
+		return err
+	}
 	// We can only initialize the mmu once we know which
 	// mapper we need to use
-	mmu, err := newMmu(emu.info.mapper, emu.info, emu.ppu)
+	mmu, err := newMmu(emu.info.mapper, emu.info, ppu, apu)
 	if err != nil {
 		return err
 	}
-	emu.mmu = mmu
 	cpu, err := newCpu(mmu)
 	if err != nil {
 		return err
 	}
-	emu.cpu = cpu
 
+	ppu.options = emu.options
+	if emu.ppu != nil {
+		ppu.hooks = emu.ppu.hooks
+		ppu.nextHookID = emu.ppu.nextHookID
+		apu.mixer = emu.apu.mixer
+		mmu.ports = emu.mmu.ports
+	}
+	emu.ppu = ppu
+	emu.apu = apu
+	emu.mmu = mmu
+	emu.cpu = cpu
+	emu.lastSeenFrame = 0
 	return nil
 }
 
 // Step is the main way for external callers to step through emulation. This takes care
 // of fetching and executing opcodes/instructions, updating APU and PPU appropriately, etc.
 func (emu *Emulator) Step() error {
+	if emu.nsf != nil {
+		return emu.nsf.step(emu)
+	}
 	cycles, err := emu.cpu.stepInstruction()
 	if err != nil {
 		return err
 	}
+	err = emu.apu.step(cycles)
+	if err != nil {
+		return err
+	}
 	emu.ppu.catchupCycles += cycles * 3
 	err = emu.ppu.catchup()
 	if err != nil {
+		return err
+	}
+	emu.mmu.endInstruction()
+	if emu.ppu.lastFrameNumber != emu.lastSeenFrame {
+		emu.lastSeenFrame = emu.ppu.lastFrameNumber
+		return emu.notifyFrameSinks()
+	}
+	return nil
+}
+
+// notifyFrameSinks tells every sink that a frame is done, even if one fails,
+// and returns the first error.
+func (emu *Emulator) notifyFrameSinks() error {
+	var firstErr error
+	for _, sink := range emu.frameSinks {
+		err := sink.frameDone(emu)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	// The input for the next frame is worked out once everything has seen
+	// this one, so movies record what was actually held
+	emu.input.frameDone(emu)
+	return firstErr
+}
+
+// Reset presses the console's reset button. The CPU restarts from the reset
+// vector, and the PPU and APU return to their reset state, but memory is kept.
+// When playing an NSF, the current track restarts instead. While a movie is
+// being recorded, the reset happens at the start of the next frame, so it can
+// be replayed exactly.
+func (emu *Emulator) Reset() error {
+	if emu.movieRecorder != nil {
+		emu.movieRecorder.pending |= MOVIE_CMD_RESET
+		return nil
+	}
+	return emu.reset()
+}
+
+// Power turns the console off and on again. Memory and the cartridge's state
+// are lost, as if a new emulator had been created for the same ROM. Like
+// Reset, it's deferred to the next frame while a movie is being recorded.
+func (emu *Emulator) Power() error {
+	if emu.movieRecorder != nil {
+		emu.movieRecorder.pending |= MOVIE_CMD_POWER
 		return nil
 	}
+	return emu.power()
+}
+
+func (emu *Emulator) power() error {
+	if emu.nsf != nil {
+		return emu.PlayTrack(emu.nsf.track)
+	}
+	return emu.powerOn()
+}
+
+func (emu *Emulator) reset() error {
+	if emu.nsf != nil {
+		return emu.PlayTrack(emu.nsf.track)
+	}
+	err := emu.cpu.reset()
+	if err != nil {
+		return err
+	}
+	emu.ppu.reset()
+	return emu.apu.reset()
+}
+
+func (emu *Emulator) addFrameSink(sink frameSink) {
+	emu.frameSinks = append(emu.frameSinks, sink)
+}
+
+// removeFrameSink removes a sink. A new slice is built, so sinks can remove
+// themselves while they're being notified.
+func (emu *Emulator) removeFrameSink(sink frameSink) {
+	for i, s := range emu.frameSinks {
+		if s == sink {
+			sinks := make([]frameSink, 0, len(emu.frameSinks)-1)
+			sinks = append(sinks, emu.frameSinks[:i]...)
+			emu.frameSinks = append(sinks, emu.frameSinks[i+1:]...)
+			return
+		}
+	}
+}
+
+// FrameRate returns the number of frames per second for the cartridge's region.
+func (emu *Emulator) FrameRate() float64 {
+	num, den := emu.FrameRateFraction()
+	return float64(num) / float64(den)
+}
+
+// FrameRateFraction returns the exact number of frames per second for the
+// cartridge's region, as a fraction. When playing an NSF, it's the rate the
+// play routine is called at.
+func (emu *Emulator) FrameRateFraction() (uint64, uint64) {
+	if emu.nsf != nil {
+		if emu.info.system == SYS_PAL {
+			return nsf_MICROSECONDS, uint64(emu.nsf.info.PlaySpeedPAL)
+		}
+		return nsf_MICROSECONDS, uint64(emu.nsf.info.PlaySpeedNTSC)
+	}
+	if emu.info.system == SYS_PAL {
+		return FRAME_RATE_PAL_NUM, FRAME_RATE_PAL_DEN
+	}
+	return FRAME_RATE_NTSC_NUM, FRAME_RATE_NTSC_DEN
+}
+
+// StepFrame steps emulation until the PPU completes the current frame.
+func (emu *Emulator) StepFrame() error {
+	frame := emu.GetFrameNumber()
+	for emu.GetFrameNumber() == frame {
+		err := emu.Step()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // loadCartInfo loads a cartInfo struct with all the available data in the header
 // of the given rom, which must be in either iNES or NES2.0 format.
 func (info *cartInfo) loadCartInfo(rom []byte) error {
+	if len(rom) < HEADER_SIZE {
+		return &gError{err_TRUNCATED_ROM}
+	}
 	// Check that the header magic constant is correct
-	nesConstant := []byte{0x4e, 0x45, 0x53, 0x1a}
-	if !bytes.Equal(rom[0:4], nesConstant) {
+	if !bytes.HasPrefix(rom, inesMagic) {
 		return &gError{err_BAD_MAGIC_CONSTANT}
 	}
 
@@ -185,17 +490,19 @@ func (info *cartInfo) loadCartInfo(rom []byte) error {
 
 	var err error
 	if info.nes2 {
-		return nil
+		err = info.loadNES2Data(rom)
 	} else {
-		if err := info.loadINESData(rom); err != nil {
-			return err
-		}
-		//fmt.Printf("%+v\n", *info)
+		err = info.loadINESData(rom)
 	}
 	if err != nil {
 		return err
 	}
 
+	// A dirty header can't be trusted, unless the database knows the game
+	info.applyRomDb()
+	if info.dirtyHeader && !info.identified {
+		return &gError{err_NONZERO_INES_HEADER_BUFFER}
+	}
 	return nil
 }
 
@@ -223,14 +530,21 @@ func (info *cartInfo) loadINESData(rom []byte) error {
 	if nes2 {
 		return &gError{err_BAD_INES_HEADER}
 	}
+	// Old tools wrote things like "DiskDude!" over bytes 7-15, so none of them
+	// mean anything. Whether the ROM can still be loaded is up to the caller.
 	if !zeroBytes {
-		return &gError{err_NONZERO_INES_HEADER_BUFFER}
+		info.dirtyHeader = true
+		rom = cleanHeader(rom)
 	}
 	// Get data that's common to both iNES and NES2.0
 	if err := info.loadCommonData(rom); err != nil {
 		return err
 	}
-	info.prgRamSize = uint32(rom[8])
+	if info.prgRamBatBacked {
+		info.prgNvramSize = uint32(rom[8]) * PRG_RAM_SIZE
+	} else {
+		info.prgRamSize = uint32(rom[8]) * PRG_RAM_SIZE
+	}
 	// We just ignore flag 9, since it's pretty outdated
 	if (rom[10] & TV_SYS_MASK) == NTSC_FLAG {
 		info.system = SYS_NTSC
@@ -243,7 +557,100 @@ func (info *cartInfo) loadINESData(rom []byte) error {
 	info.prgRamPresent = (rom[10] & PRG_RAM_PRESENT_MASK) == PRG_RAM_PRESENT_FLAG
 	info.busConflict = (rom[10] & BUS_CONFLICT_MASK) == BUS_CONFLICT_FLAG
 
-	var sectionStart uint32 = TRAINER_START_ADDR
+	return info.loadSections(rom, uint64(info.prgRomSize)*PRG_ROM_SIZE, uint64(info.chrRomSize)*CHR_ROM_SIZE)
+}
+
+// loadNES2Data loads a cartInfo struct with data under the assumption that the
+// given byte array represents a NES 2.0 format ROM.
+func (info *cartInfo) loadNES2Data(rom []byte) error {
+	if err := info.loadCommonData(rom); err != nil {
+		return err
+	}
+	info.mapper |= uint32(rom[8]&NES2_MAPPER_HI_MASK) << 8
+	info.submapper = uint32(rom[8]&SUBMAPPER_MASK) >> 4
+
+	prgBytes, err := nes2RomSize(rom[4], rom[9]&NES2_PRG_ROM_HI_MASK, PRG_ROM_SIZE)
+	if err != nil {
+		return err
+	}
+	chrBytes, err := nes2RomSize(rom[5], (rom[9]&NES2_CHR_ROM_HI_MASK)>>4, CHR_ROM_SIZE)
+	if err != nil {
+		return err
+	}
+
+	info.prgRamSize = nes2RamSize(rom[10] & RAM_SHIFT_MASK)
+	info.prgNvramSize = nes2RamSize((rom[10] & NVRAM_SHIFT_MASK) >> 4)
+	info.chrRamSize = nes2RamSize(rom[11] & RAM_SHIFT_MASK)
+	info.chrNvramSize = nes2RamSize((rom[11] & NVRAM_SHIFT_MASK) >> 4)
+	info.prgRamPresent = info.prgRamSize+info.prgNvramSize > 0
+
+	info.timing = uint32(rom[12] & NES2_TIMING_MASK)
+	switch info.timing {
+	case TIMING_NTSC:
+		info.system = SYS_NTSC
+	case TIMING_MULTI:
+		info.system = SYS_NTSC_PAL
+	default:
+		// The Dendy isn't emulated, PAL is closest as it also runs at 50Hz
+		info.system = SYS_PAL
+	}
+
+	// The console type takes up both the Vs. and PlayChoice bits
+	info.consoleType = uint32(rom[7] & CONSOLE_TYPE_MASK)
+	info.vs = info.consoleType == CONSOLE_VS
+	info.pc10 = info.consoleType == CONSOLE_PC10
+	switch info.consoleType {
+	case CONSOLE_VS:
+		info.vsPpuType = uint32(rom[13] & VS_PPU_MASK)
+		info.vsHardwareType = uint32(rom[13]&VS_HARDWARE_MASK) >> 4
+	case CONSOLE_EXTENDED:
+		info.extConsoleType = uint32(rom[13] & EXT_CONSOLE_MASK)
+	}
+
+	info.miscRoms = uint32(rom[14] & MISC_ROMS_MASK)
+	info.expansionDevice = uint32(rom[15] & EXPANSION_MASK)
+
+	return info.loadSections(rom, prgBytes, chrBytes)
+}
+
+// nes2RomSize returns the size in bytes of a NES 2.0 ROM area, from its size
+// byte and the nibble with its upper bits. A nibble of $F means the size byte
+// is an exponent and multiplier, otherwise they make up a number of units.
+func nes2RomSize(lo, hi uint8, unit uint64) (uint64, error) {
+	if hi != ROM_EXPONENT_FLAG {
+		return (uint64(hi)<<8 | uint64(lo)) * unit, nil
+	}
+	exponent := uint(lo&ROM_EXPONENT_MASK) >> 2
+	multiplier := uint64(lo&ROM_MULTIPLIER_MASK)*2 + 1
+	// No file could hold more than this anyway
+	if exponent > 32 {
+		return 0, &gError{err_TRUNCATED_ROM}
+	}
+	return (1 << exponent) * multiplier, nil
+}
+
+// nes2RamSize returns the size in bytes of a NES 2.0 RAM area from its shift
+// count
+func nes2RamSize(shift uint8) uint32 {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
+
+// loadSections slices the trainer, PRG ROM, CHR ROM and whatever follows out
+// of the rom. ROM that isn't a whole number of units is mirrored up to the next
+// one, as the mappers bank in whole units.
+func (info *cartInfo) loadSections(rom []byte, prgBytes, chrBytes uint64) error {
+	size := uint64(HEADER_SIZE) + prgBytes + chrBytes
+	if info.trainer {
+		size += TRAINER_SIZE
+	}
+	if uint64(len(rom)) < size {
+		return &gError{err_TRUNCATED_ROM}
+	}
+
+	var sectionStart uint64 = TRAINER_START_ADDR
 	if info.trainer {
 		info.data.trainer = rom[sectionStart : sectionStart+TRAINER_SIZE]
 		sectionStart += TRAINER_SIZE
@@ -251,14 +658,37 @@ func (info *cartInfo) loadINESData(rom []byte) error {
 		info.data.trainer = []byte{}
 	}
 
-	info.data.prgRom = rom[sectionStart : sectionStart+(PRG_ROM_SIZE*info.prgRomSize)]
-	sectionStart += PRG_ROM_SIZE * info.prgRomSize
-	info.data.chrRom = rom[sectionStart : sectionStart+(CHR_ROM_SIZE*info.chrRomSize)]
-	sectionStart += CHR_ROM_SIZE * info.chrRomSize
+	info.data.prgRom = padRom(rom[sectionStart:sectionStart+prgBytes], PRG_ROM_SIZE)
+	info.prgRomSize = uint32(len(info.data.prgRom) / PRG_ROM_SIZE)
+	sectionStart += prgBytes
+	info.data.chrRom = padRom(rom[sectionStart:sectionStart+chrBytes], CHR_ROM_SIZE)
+	info.chrRomSize = uint32(len(info.data.chrRom) / CHR_ROM_SIZE)
+	sectionStart += chrBytes
 
+	if !info.nes2 {
+		return nil
+	}
+	info.data.miscRom = rom[sectionStart:]
+	// PlayChoice dumps keep the INST-ROM and PROM there
+	if info.pc10 && len(info.data.miscRom) >= PC_ROM_SIZE+PC_PROM_SIZE {
+		info.data.pcInstRom = info.data.miscRom[:PC_ROM_SIZE]
+		info.data.pcProm = info.data.miscRom[PC_ROM_SIZE : PC_ROM_SIZE+PC_PROM_SIZE]
+	}
 	return nil
 }
 
+// padRom mirrors data up to a whole number of units
+func padRom(data []byte, unit int) []byte {
+	if len(data)%unit == 0 {
+		return data
+	}
+	padded := make([]byte, (len(data)/unit+1)*unit)
+	for i := 0; i < len(padded); i += len(data) {
+		copy(padded[i:], data)
+	}
+	return padded
+}
+
 /***********************************************/
 /*                   Getters                   */
 /***********************************************/
@@ -282,3 +712,20 @@ func (emu *Emulator) GetOpMnemonic(addr uint16) (string, error) {
 func (emu *Emulator) GetOpLength(addr uint16) (uint16, error) {
 	return emu.cpu.getOpLengthAddr(addr)
 }
+
+// GetRawFrame returns a copy of the last completed frame as 9-bit PPU pixels,
+// which can be passed to a FrameFilter.
+func (emu *Emulator) GetRawFrame() []uint16 {
+	frame := make([]uint16, len(emu.ppu.lastFrame))
+	copy(frame, emu.ppu.lastFrame)
+	return frame
+}
+
+// GetFrameNumber returns the number of the last completed frame. When playing
+// an NSF, it's the number of times the play routine has been called.
+func (emu *Emulator) GetFrameNumber() uint64 {
+	if emu.nsf != nil {
+		return emu.nsf.frames
+	}
+	return emu.ppu.lastFrameNumber
+}
@@ -0,0 +1,140 @@
+package gnes
+
+import "errors"
+import "testing"
+
+// countingSink counts its frames, and fails every one if err is set
+type countingSink struct {
+	frames int
+	err    error
+}
+
+func (sink *countingSink) frameDone(emu *Emulator) error {
+	sink.frames++
+	return sink.err
+}
+
+func TestNotifyFrameSinks(t *testing.T) {
+	emu := testEmulator(t)
+	first := &countingSink{err: errors.New("first")}
+	second := &countingSink{err: errors.New("second")}
+	third := &countingSink{}
+	emu.addFrameSink(first)
+	emu.addFrameSink(second)
+	emu.addFrameSink(third)
+
+	frame := emu.input.frame
+	if err := emu.notifyFrameSinks(); err != first.err {
+		t.Errorf("got error %v, want %v", err, first.err)
+	}
+	if first.frames != 1 || second.frames != 1 || third.frames != 1 {
+		t.Errorf("sinks saw %d, %d and %d frames, want 1 each", first.frames, second.frames, third.frames)
+	}
+	if emu.input.frame != frame+1 {
+		t.Error("input layer didn't move on to the next frame")
+	}
+}
+
+func TestNES2RomSize(t *testing.T) {
+	tests := []struct {
+		lo, hi uint8
+		unit   uint64
+		want   uint64
+		err    bool
+	}{
+		{2, 0, PRG_ROM_SIZE, 2 * PRG_ROM_SIZE, false},
+		{0x02, 0x1, CHR_ROM_SIZE, 0x102 * CHR_ROM_SIZE, false},
+		// Exponent 10, multiplier 1
+		{10 << 2, 0xF, PRG_ROM_SIZE, 1024, false},
+		// Exponent 14, multiplier 3
+		{14<<2 | 1, 0xF, PRG_ROM_SIZE, 3 * 16384, false},
+		// Exponent 0, multiplier 7
+		{3, 0xF, CHR_ROM_SIZE, 7, false},
+		// Exponent 32, multiplier 7 is the most that's accepted
+		{32<<2 | 3, 0xF, PRG_ROM_SIZE, 7 << 32, false},
+		{33 << 2, 0xF, PRG_ROM_SIZE, 0, true},
+	}
+	for _, test := range tests {
+		size, err := nes2RomSize(test.lo, test.hi, test.unit)
+		if (err != nil) != test.err || size != test.want {
+			t.Errorf("nes2RomSize($%02X, $%X) = %d, %v, want %d", test.lo, test.hi, size, err, test.want)
+		}
+	}
+}
+
+// nes2Rom builds a NES 2.0 ROM from header bytes 4-15 and 'size' bytes of data
+func nes2Rom(flags [12]uint8, size int) []byte {
+	rom := make([]byte, HEADER_SIZE+size)
+	copy(rom, "NES\x1A")
+	copy(rom[4:], flags[:])
+	rom[7] |= NES2_FLAG
+	for i := HEADER_SIZE; i < len(rom); i++ {
+		rom[i] = uint8(i)
+	}
+	return rom
+}
+
+func TestLoadNES2Data(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags [12]uint8
+		size  int
+		check func(info *cartInfo) bool
+	}{
+		{"mapper and submapper", [12]uint8{1, 1, 0x10, 0x20, 0x21}, PRG_ROM_SIZE + CHR_ROM_SIZE,
+			func(info *cartInfo) bool { return info.mapper == 0x121 && info.submapper == 2 }},
+		{"exponent PRG ROM", [12]uint8{13<<2 | 1, 0, 0, 0, 0, 0x0F}, 3 * 8192,
+			func(info *cartInfo) bool {
+				// 24K is mirrored up to two 16K banks
+				prg := info.data.prgRom
+				return info.prgRomSize == 2 && len(prg) == 2*PRG_ROM_SIZE && prg[3*8192] == prg[0]
+			}},
+		{"RAM shift counts", [12]uint8{1, 0, 0, 0, 0, 0, 0x97, 0x07}, PRG_ROM_SIZE,
+			func(info *cartInfo) bool {
+				return info.prgRamSize == 8192 && info.prgNvramSize == 32768 &&
+					info.chrRamSize == 8192 && info.chrNvramSize == 0 && info.prgRamPresent
+			}},
+		{"no RAM", [12]uint8{1}, PRG_ROM_SIZE,
+			func(info *cartInfo) bool { return info.prgRamSize == 0 && !info.prgRamPresent }},
+		{"NTSC timing", [12]uint8{1, 0, 0, 0, 0, 0, 0, 0, TIMING_NTSC}, PRG_ROM_SIZE,
+			func(info *cartInfo) bool { return info.timing == TIMING_NTSC && info.system == SYS_NTSC }},
+		{"PAL timing", [12]uint8{1, 0, 0, 0, 0, 0, 0, 0, TIMING_PAL}, PRG_ROM_SIZE,
+			func(info *cartInfo) bool { return info.timing == TIMING_PAL && info.system == SYS_PAL }},
+		{"multi-region timing", [12]uint8{1, 0, 0, 0, 0, 0, 0, 0, TIMING_MULTI}, PRG_ROM_SIZE,
+			func(info *cartInfo) bool { return info.timing == TIMING_MULTI && info.system == SYS_NTSC_PAL }},
+		{"Dendy timing", [12]uint8{1, 0, 0, 0, 0, 0, 0, 0, TIMING_DENDY}, PRG_ROM_SIZE,
+			func(info *cartInfo) bool { return info.timing == TIMING_DENDY && info.system == SYS_PAL }},
+		{"Vs. System", [12]uint8{1, 0, 0, CONSOLE_VS, 0, 0, 0, 0, 0, 0x23}, PRG_ROM_SIZE,
+			func(info *cartInfo) bool {
+				return info.consoleType == CONSOLE_VS && info.vs && !info.pc10 &&
+					info.vsPpuType == 3 && info.vsHardwareType == 2
+			}},
+		{"PlayChoice-10", [12]uint8{1, 0, 0, CONSOLE_PC10, 0, 0, 0, 0, 0, 0, 1}, PRG_ROM_SIZE + PC_ROM_SIZE + PC_PROM_SIZE,
+			func(info *cartInfo) bool {
+				return info.consoleType == CONSOLE_PC10 && info.pc10 && !info.vs && info.miscRoms == 1 &&
+					len(info.data.pcInstRom) == PC_ROM_SIZE && len(info.data.pcProm) == PC_PROM_SIZE
+			}},
+		{"extended console", [12]uint8{1, 0, 0, CONSOLE_EXTENDED, 0, 0, 0, 0, 0, 0x05}, PRG_ROM_SIZE,
+			func(info *cartInfo) bool {
+				return info.consoleType == CONSOLE_EXTENDED && !info.vs && !info.pc10 && info.extConsoleType == 5
+			}},
+		{"expansion device", [12]uint8{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x08}, PRG_ROM_SIZE,
+			func(info *cartInfo) bool { return info.expansionDevice == 8 }},
+	}
+	for _, test := range tests {
+		info := &cartInfo{nes2: true, data: &gameData{}}
+		if err := info.loadNES2Data(nes2Rom(test.flags, test.size)); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !test.check(info) {
+			t.Errorf("%s: loaded %+v", test.name, *info)
+		}
+	}
+
+	// The data has to be all there
+	info := &cartInfo{nes2: true, data: &gameData{}}
+	if err := info.loadNES2Data(nes2Rom([12]uint8{2, 1}, PRG_ROM_SIZE)); err == nil {
+		t.Error("loaded a truncated ROM")
+	}
+}
@@ -16,6 +16,47 @@ const (
 	err_MMC1_INVALID_PRG_ROM_MODE_VAL = 11
 	err_UNWRITEABLE_PPU_REG           = 12
 	err_UNREADABLE_PPU_REG            = 13
+	err_INVALID_OVERSCAN              = 14
+	err_INVALID_PALETTE               = 15
+	err_INVALID_PORT                  = 16
+	err_INVALID_RECORD_INTERVAL       = 17
+	err_UNKNOWN_RECORD_FORMAT         = 18
+	err_ALREADY_RECORDING             = 19
+	err_NOT_RECORDING                 = 20
+	err_EMPTY_RECORDING               = 21
+	err_BAD_PNG_DATA                  = 22
+	err_RECORDING_SIZE_CHANGED        = 23
+	err_ALREADY_DUMPING               = 24
+	err_NOT_DUMPING                   = 25
+	err_INVALID_RASTER_POSITION       = 26
+	err_UNKNOWN_HOOK                  = 27
+	err_INVALID_SAMPLE_RATE           = 28
+	err_INVALID_CHANNELS              = 29
+	err_INVALID_RECORD_LENGTH         = 30
+	err_ALREADY_RECORDING_AUDIO       = 31
+	err_NOT_RECORDING_AUDIO           = 32
+	err_BAD_NSF_FILE                  = 33
+	err_NSF_EXPANSION_UNSUPPORTED     = 34
+	err_INVALID_TRACK                 = 35
+	err_NOT_NSF                       = 36
+	err_NOT_BUTTON_DEVICE             = 37
+	err_NOT_ZAPPER                    = 38
+	err_MOVIE_IN_PROGRESS             = 39
+	err_NOT_RECORDING_MOVIE           = 40
+	err_NOT_PLAYING_MOVIE             = 41
+	err_MOVIE_ROM_MISMATCH            = 42
+	err_MOVIE_UNSUPPORTED_DEVICE      = 43
+	err_BAD_FM2_FILE                  = 44
+	err_BAD_MACRO                     = 45
+	err_UNKNOWN_MACRO                 = 46
+	err_INVALID_TURBO_PERIOD          = 47
+	err_TRUNCATED_ROM                 = 48
+	err_BAD_ROMDB_ENTRY               = 49
+	err_NO_ROM_IN_ARCHIVE             = 50
+	err_ARCHIVE_ENTRY_NOT_FOUND       = 51
+	err_FDS_UNSUPPORTED               = 52
+	err_ROM_TOO_LARGE                 = 53
+	err_MOVIE_REGION_MISMATCH         = 54
 )
 
 var errToString = map[int]string{
@@ -32,6 +73,47 @@ var errToString = map[int]string{
 	err_MMC1_INVALID_PRG_ROM_MODE_VAL: "Invalid value %x for MMC1 PRG ROM mode",
 	err_UNWRITEABLE_PPU_REG:           "Illegal PPU register to write",
 	err_UNREADABLE_PPU_REG:            "Illegal PPU register to read",
+	err_INVALID_OVERSCAN:              "Overscan must not crop the entire picture",
+	err_INVALID_PALETTE:               "Invalid palette %d, must be between 0 and 7",
+	err_INVALID_PORT:                  "Invalid controller port %d",
+	err_INVALID_RECORD_INTERVAL:       "Invalid recording interval of %d frames",
+	err_UNKNOWN_RECORD_FORMAT:         "Unknown recording format, path must end in .gif, .png or .apng",
+	err_ALREADY_RECORDING:             "A recording is already in progress",
+	err_NOT_RECORDING:                 "No recording is in progress",
+	err_EMPTY_RECORDING:               "No frames were recorded",
+	err_BAD_PNG_DATA:                  "Malformed PNG data",
+	err_RECORDING_SIZE_CHANGED:        "Frame size changed during recording",
+	err_ALREADY_DUMPING:               "A dump is already in progress",
+	err_NOT_DUMPING:                   "No dump is in progress",
+	err_INVALID_RASTER_POSITION:       "Invalid raster position, scanline %d dot %d",
+	err_UNKNOWN_HOOK:                  "Unknown hook %d",
+	err_INVALID_SAMPLE_RATE:           "Invalid sample rate %d",
+	err_INVALID_CHANNELS:              "Invalid channel mask %#x",
+	err_INVALID_RECORD_LENGTH:         "Invalid recording length %d",
+	err_ALREADY_RECORDING_AUDIO:       "An audio recording is already in progress",
+	err_NOT_RECORDING_AUDIO:           "No audio recording is in progress",
+	err_BAD_NSF_FILE:                  "Invalid or truncated NSF file",
+	err_NSF_EXPANSION_UNSUPPORTED:     "Unsupported NSF expansion chips %#x",
+	err_INVALID_TRACK:                 "Invalid track %d",
+	err_NOT_NSF:                       "No NSF file is loaded",
+	err_NOT_BUTTON_DEVICE:             "The device in port %d doesn't take buttons",
+	err_NOT_ZAPPER:                    "The device in port %d isn't a Zapper",
+	err_MOVIE_IN_PROGRESS:             "A movie is already being recorded or played",
+	err_NOT_RECORDING_MOVIE:           "No movie is being recorded",
+	err_NOT_PLAYING_MOVIE:             "No movie is being played",
+	err_MOVIE_ROM_MISMATCH:            "The movie was recorded with a different ROM",
+	err_MOVIE_UNSUPPORTED_DEVICE:      "Movies only support standard controllers, Zappers and the Four Score",
+	err_BAD_FM2_FILE:                  "Malformed or binary FM2 file",
+	err_BAD_MACRO:                     "Malformed macro",
+	err_UNKNOWN_MACRO:                 "Unknown macro",
+	err_INVALID_TURBO_PERIOD:          "Invalid turbo period %d",
+	err_TRUNCATED_ROM:                 "ROM file is smaller than its header says",
+	err_BAD_ROMDB_ENTRY:               "Malformed ROM database entry on line %d",
+	err_NO_ROM_IN_ARCHIVE:             "No .nes, .fds, .nsf or .nsfe file in the archive",
+	err_ARCHIVE_ENTRY_NOT_FOUND:       "The archive has no such file",
+	err_FDS_UNSUPPORTED:               "Famicom Disk System images are unsupported",
+	err_ROM_TOO_LARGE:                 "ROM file is larger than the %d byte limit",
+	err_MOVIE_REGION_MISMATCH:         "The movie was recorded on a console of a different region",
 }
 
 type gError struct {
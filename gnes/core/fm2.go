@@ -0,0 +1,314 @@
+package gnes
+
+import "bufio"
+import "crypto/rand"
+import "encoding/base64"
+import "fmt"
+import "io"
+import "os"
+import "strconv"
+import "strings"
+
+// FM2 is FCEUX's text movie format: a header of "key value" lines, followed
+// by one line per frame of '|' separated fields.
+const (
+	fm2_VERSION     = 3
+	fm2_EMU_VERSION = 22020
+
+	// Port device types
+	fm2_SI_NONE    = 0
+	fm2_SI_GAMEPAD = 1
+	fm2_SI_ZAPPER  = 2
+
+	fm2_CHECKSUM_PREFIX = "base64:"
+
+	// The gamepad mnemonics, from BUTTON_RIGHT down to BUTTON_A
+	fm2_GAMEPAD = "RLDUTSBA"
+
+	// Extra keys for the enhancement options
+	fm2_KEY_NO_SPRITE_LIMIT = "gnesNoSpriteLimit"
+	fm2_KEY_SHOW_OVERSCAN   = "gnesShowOverscan"
+	fm2_KEY_NO_LEFT_CLIP    = "gnesNoLeftClip"
+)
+
+var fm2DeviceTypes = map[DeviceType]int{
+	DEVICE_NONE:     fm2_SI_NONE,
+	DEVICE_STANDARD: fm2_SI_GAMEPAD,
+	DEVICE_ZAPPER:   fm2_SI_ZAPPER,
+}
+
+// newMovieGUID returns a random GUID in the form FCEUX uses
+func newMovieGUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func boolToFm2(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// WriteFM2 writes the movie in FCEUX's FM2 format.
+func (movie *Movie) WriteFM2(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "version %d\n", fm2_VERSION)
+	fmt.Fprintf(out, "emuVersion %d\n", fm2_EMU_VERSION)
+	fmt.Fprintf(out, "rerecordCount %d\n", movie.RerecordCount)
+	fmt.Fprintf(out, "palFlag %d\n", boolToFm2(movie.PAL))
+	fmt.Fprintf(out, "romFilename %s\n", movie.RomName)
+	fmt.Fprintf(out, "romChecksum %s%s\n", fm2_CHECKSUM_PREFIX, base64.StdEncoding.EncodeToString(movie.RomChecksum[:]))
+	fmt.Fprintf(out, "guid %s\n", movie.GUID)
+	fmt.Fprintf(out, "fourscore %d\n", boolToFm2(movie.FourScore))
+	fmt.Fprintf(out, "microphone 0\n")
+	for port, device := range movie.Ports {
+		if movie.FourScore {
+			device = DEVICE_STANDARD
+		}
+		fm2Type, ok := fm2DeviceTypes[device]
+		if !ok {
+			return &gError{err_MOVIE_UNSUPPORTED_DEVICE}
+		}
+		fmt.Fprintf(out, "port%d %d\n", port, fm2Type)
+	}
+	fmt.Fprintf(out, "port2 0\n")
+	fmt.Fprintf(out, "FDS 0\n")
+	fmt.Fprintf(out, "NewPPU 0\n")
+	// Keys FCEUX doesn't know are ignored by it
+	fmt.Fprintf(out, "%s %d\n", fm2_KEY_NO_SPRITE_LIMIT, boolToFm2(movie.Options.NoSpriteLimit))
+	fmt.Fprintf(out, "%s %d\n", fm2_KEY_SHOW_OVERSCAN, boolToFm2(movie.Options.ShowOverscan))
+	fmt.Fprintf(out, "%s %d\n", fm2_KEY_NO_LEFT_CLIP, boolToFm2(movie.Options.NoLeftClip))
+	for _, comment := range movie.Comments {
+		fmt.Fprintf(out, "comment %s\n", comment)
+	}
+
+	for i := range movie.Frames {
+		frame := &movie.Frames[i]
+		fmt.Fprintf(out, "|%d|", frame.Commands)
+		if movie.FourScore {
+			for port := 0; port < 4; port++ {
+				out.WriteString(fm2Gamepad(frame.Buttons[port]) + "|")
+			}
+		} else {
+			for port, device := range movie.Ports {
+				switch device {
+				case DEVICE_STANDARD:
+					out.WriteString(fm2Gamepad(frame.Buttons[port]))
+				case DEVICE_ZAPPER:
+					zapper := frame.Zappers[port]
+					fmt.Fprintf(out, "%d %d %d 0 0", zapper.X, zapper.Y, boolToFm2(zapper.Trigger))
+				}
+				out.WriteString("|")
+			}
+		}
+		// The expansion port is always empty
+		out.WriteString("|\n")
+	}
+	return out.Flush()
+}
+
+func fm2Gamepad(buttons Buttons) string {
+	field := []byte(fm2_GAMEPAD)
+	for i := range field {
+		if (buttons & (BUTTON_RIGHT >> uint(i))) == 0 {
+			field[i] = '.'
+		}
+	}
+	return string(field)
+}
+
+func parseFm2Gamepad(field string) Buttons {
+	var buttons Buttons
+	for i := 0; i < len(field) && i < len(fm2_GAMEPAD); i++ {
+		if field[i] != '.' && field[i] != ' ' {
+			buttons |= BUTTON_RIGHT >> uint(i)
+		}
+	}
+	return buttons
+}
+
+func parseFm2Zapper(field string) (ZapperState, error) {
+	var state ZapperState
+	values := strings.Fields(field)
+	if len(values) < 3 {
+		return state, &gError{err_BAD_FM2_FILE}
+	}
+	var nums [3]int
+	for i := range nums {
+		n, err := strconv.Atoi(values[i])
+		if err != nil {
+			return state, &gError{err_BAD_FM2_FILE}
+		}
+		nums[i] = n
+	}
+	state.X = nums[0]
+	state.Y = nums[1]
+	state.Trigger = nums[2] != 0
+	return state, nil
+}
+
+// ReadFM2 reads a movie in FCEUX's FM2 text format. Binary FM2 files, and
+// devices other than standard controllers, Zappers and the Four Score, aren't
+// supported.
+func ReadFM2(r io.Reader) (*Movie, error) {
+	movie := &Movie{}
+	ports := [3]int{fm2_SI_GAMEPAD, fm2_SI_GAMEPAD, fm2_SI_NONE}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if line[0] == '|' {
+			frame, err := movie.parseFm2Frame(line)
+			if err != nil {
+				return nil, err
+			}
+			movie.Frames = append(movie.Frames, frame)
+			continue
+		}
+
+		key, value := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			key, value = line[:i], line[i+1:]
+		}
+		num, _ := strconv.Atoi(value)
+		switch key {
+		case "binary":
+			if num != 0 {
+				return nil, &gError{err_BAD_FM2_FILE}
+			}
+		case "rerecordCount":
+			movie.RerecordCount = num
+		case "palFlag":
+			movie.PAL = num != 0
+		case "romFilename":
+			movie.RomName = value
+		case "romChecksum":
+			sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, fm2_CHECKSUM_PREFIX))
+			if err != nil || len(sum) != len(movie.RomChecksum) {
+				return nil, &gError{err_BAD_FM2_FILE}
+			}
+			copy(movie.RomChecksum[:], sum)
+		case "guid":
+			movie.GUID = value
+		case "fourscore":
+			movie.FourScore = num != 0
+		case "port0":
+			ports[0] = num
+		case "port1":
+			ports[1] = num
+		case "port2":
+			ports[2] = num
+		case "comment":
+			movie.Comments = append(movie.Comments, value)
+		case fm2_KEY_NO_SPRITE_LIMIT:
+			movie.Options.NoSpriteLimit = num != 0
+		case fm2_KEY_SHOW_OVERSCAN:
+			movie.Options.ShowOverscan = num != 0
+		case fm2_KEY_NO_LEFT_CLIP:
+			movie.Options.NoLeftClip = num != 0
+		}
+
+		// The ports have to be known before the frames are parsed, and they
+		// always come first
+		if key == "port0" || key == "port1" {
+			port := key[len(key)-1] - '0'
+			device, ok := fm2DeviceType(num)
+			if !ok {
+				return nil, &gError{err_MOVIE_UNSUPPORTED_DEVICE}
+			}
+			movie.Ports[port] = device
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if ports[2] != fm2_SI_NONE {
+		return nil, &gError{err_MOVIE_UNSUPPORTED_DEVICE}
+	}
+	if movie.FourScore {
+		movie.Ports = [2]DeviceType{DEVICE_STANDARD, DEVICE_STANDARD}
+	}
+	return movie, nil
+}
+
+func fm2DeviceType(fm2Type int) (DeviceType, bool) {
+	for device, t := range fm2DeviceTypes {
+		if t == fm2Type {
+			return device, true
+		}
+	}
+	return 0, false
+}
+
+// parseFm2Frame parses a frame line, e.g. "|0|R......A|........||"
+func (movie *Movie) parseFm2Frame(line string) (MovieFrame, error) {
+	var frame MovieFrame
+	fields := strings.Split(line, "|")
+	// The line starts and ends with '|', so the first and last fields are empty
+	if len(fields) < 3 {
+		return frame, &gError{err_BAD_FM2_FILE}
+	}
+	fields = fields[1 : len(fields)-1]
+
+	commands, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return frame, &gError{err_BAD_FM2_FILE}
+	}
+	frame.Commands = uint8(commands)
+	fields = fields[1:]
+
+	if movie.FourScore {
+		if len(fields) < 4 {
+			return frame, &gError{err_BAD_FM2_FILE}
+		}
+		for port := 0; port < 4; port++ {
+			frame.Buttons[port] = parseFm2Gamepad(fields[port])
+		}
+		return frame, nil
+	}
+
+	if len(fields) < 2 {
+		return frame, &gError{err_BAD_FM2_FILE}
+	}
+	for port, device := range movie.Ports {
+		switch device {
+		case DEVICE_STANDARD:
+			frame.Buttons[port] = parseFm2Gamepad(fields[port])
+		case DEVICE_ZAPPER:
+			frame.Zappers[port], err = parseFm2Zapper(fields[port])
+			if err != nil {
+				return frame, err
+			}
+		}
+	}
+	return frame, nil
+}
+
+// LoadFM2 reads an FM2 movie from a file.
+func LoadFM2(path string) (*Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadFM2(file)
+}
+
+// SaveFM2 writes the movie to a file in FM2 format.
+func (movie *Movie) SaveFM2(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = movie.WriteFM2(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
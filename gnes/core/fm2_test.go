@@ -0,0 +1,67 @@
+package gnes
+
+import "bytes"
+import "reflect"
+import "testing"
+
+func TestFM2RoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		movie Movie
+	}{
+		{"four score", Movie{
+			FourScore: true,
+			Ports:     [2]DeviceType{DEVICE_STANDARD, DEVICE_STANDARD},
+			Frames: []MovieFrame{
+				{Buttons: [4]Buttons{BUTTON_A, BUTTON_B | BUTTON_START, BUTTON_UP | BUTTON_LEFT, BUTTON_RIGHT | BUTTON_SELECT}},
+				{Commands: MOVIE_CMD_RESET, Buttons: [4]Buttons{0, 0, BUTTON_DOWN, BUTTON_A | BUTTON_B}},
+			},
+		}},
+		{"zapper", Movie{
+			PAL:   true,
+			Ports: [2]DeviceType{DEVICE_STANDARD, DEVICE_ZAPPER},
+			Frames: []MovieFrame{
+				{Buttons: [4]Buttons{BUTTON_START}, Zappers: [2]ZapperState{{}, {X: 128, Y: 120, Trigger: true}}},
+				{Commands: MOVIE_CMD_POWER, Zappers: [2]ZapperState{{}, {X: 255, Y: 0}}},
+			},
+		}},
+		{"empty port and options", Movie{
+			Ports:    [2]DeviceType{DEVICE_ZAPPER, DEVICE_NONE},
+			Options:  Options{NoSpriteLimit: true, NoLeftClip: true},
+			Comments: []string{"author someone", "a test"},
+			Frames: []MovieFrame{
+				{Zappers: [2]ZapperState{{X: 10, Y: 20, Trigger: true}}},
+			},
+		}},
+	}
+	for _, test := range tests {
+		movie := test.movie
+		movie.RomName = "test.nes"
+		movie.RomChecksum[0] = 0xAB
+		movie.GUID = newMovieGUID()
+		movie.RerecordCount = 7
+
+		var buf bytes.Buffer
+		if err := movie.WriteFM2(&buf); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		read, err := ReadFM2(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(*read, movie) {
+			t.Errorf("%s: read back\n%+v\nwant\n%+v", test.name, *read, movie)
+		}
+	}
+}
+
+func TestFM2UnsupportedDevice(t *testing.T) {
+	movie := Movie{Ports: [2]DeviceType{DEVICE_PADDLE, DEVICE_STANDARD}}
+	var buf bytes.Buffer
+	if err := movie.WriteFM2(&buf); err == nil {
+		t.Error("wrote a movie with a paddle")
+	}
+	if _, err := ReadFM2(bytes.NewBufferString("version 3\nport0 3\n")); err == nil {
+		t.Error("read a movie with an unknown device")
+	}
+}
@@ -0,0 +1,91 @@
+package gnes
+
+import "image"
+import "image/draw"
+import "image/png"
+import "os"
+
+// Overscan describes how many NES pixels are cropped from each edge of the picture.
+// Most TVs hide roughly 8 lines at the top and bottom of the picture.
+type Overscan struct {
+	Top,
+	Bottom,
+	Left,
+	Right int
+}
+
+var (
+	OVERSCAN_NONE = Overscan{}
+	OVERSCAN_TV   = Overscan{Top: 8, Bottom: 8, Left: 0, Right: 0}
+)
+
+// SetFrameFilter sets the filter used to convert frames into images. A nil
+// filter goes back to the default palette filter.
+func (emu *Emulator) SetFrameFilter(filter FrameFilter) {
+	if filter == nil {
+		filter = NewPaletteFilter()
+	}
+	emu.filter = filter
+}
+
+// SetOverscan sets how much of the picture is cropped by Frame and Screenshot,
+// unless the ShowOverscan option is set.
+func (emu *Emulator) SetOverscan(overscan Overscan) error {
+	if overscan.Top < 0 || overscan.Bottom < 0 || overscan.Left < 0 || overscan.Right < 0 ||
+		overscan.Top+overscan.Bottom >= SCREEN_HEIGHT || overscan.Left+overscan.Right >= SCREEN_WIDTH {
+		return &gError{err_INVALID_OVERSCAN}
+	}
+	emu.overscan = overscan
+	return nil
+}
+
+// Frame returns the last completed frame, converted by the current frame filter
+// and cropped according to the overscan settings.
+func (emu *Emulator) Frame() *image.RGBA {
+	img := emu.filter.Filter(emu.ppu.lastFrame, emu.ppu.lastFrameNumber)
+	return cropOverscan(img, emu.visibleOverscan())
+}
+
+// visibleOverscan returns the overscan actually cropped from frames, which is
+// none if the ShowOverscan option is set.
+func (emu *Emulator) visibleOverscan() Overscan {
+	if emu.options.ShowOverscan {
+		return OVERSCAN_NONE
+	}
+	return emu.overscan
+}
+
+// Screenshot writes the last completed frame to a PNG file at path.
+func (emu *Emulator) Screenshot(path string) error {
+	return writePNG(path, emu.Frame())
+}
+
+// cropOverscan crops an image generated from a frame. Since filters may produce
+// images wider than the NES picture, horizontal cropping is scaled accordingly.
+func cropOverscan(img *image.RGBA, overscan Overscan) *image.RGBA {
+	if overscan == OVERSCAN_NONE {
+		return img
+	}
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	left := overscan.Left * width / SCREEN_WIDTH
+	right := overscan.Right * width / SCREEN_WIDTH
+
+	rect := image.Rect(left, overscan.Top, width-right, height-overscan.Bottom)
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+	return cropped
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(file, img)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,104 @@
+package gnes
+
+// Raster positions the built in hooks run at
+const (
+	hook_FRAME_START_SCANLINE  = 0
+	hook_FRAME_END_SCANLINE    = 240
+	hook_VBLANK_START_SCANLINE = 241
+	hook_VBLANK_START_DOT      = 1
+
+	num_SCANLINES     = 262
+	num_SCANLINE_DOTS = 341
+)
+
+// PPUState is a snapshot of the PPU's raster position, passed to hooks.
+type PPUState struct {
+	Scanline,
+	Dot uint16
+	Frame uint64
+}
+
+// HookFunc is called by the PPU when it reaches the raster position a hook
+// was registered for. It runs in the middle of emulation, after the PPU has
+// finished its work for that dot.
+type HookFunc func(state PPUState)
+
+// HookID identifies a registered hook, so that it can be removed.
+type HookID uint64
+
+type ppuHook struct {
+	id HookID
+
+	scanline,
+	dot uint16
+
+	fn HookFunc
+}
+
+// addHook registers fn to run at (scanline, dot)
+func (ppu *ppu) addHook(scanline, dot uint16, fn HookFunc) HookID {
+	ppu.nextHookID++
+	ppu.hooks = append(ppu.hooks, ppuHook{ppu.nextHookID, scanline, dot, fn})
+	return ppu.nextHookID
+}
+
+func (ppu *ppu) removeHook(id HookID) error {
+	for i, hook := range ppu.hooks {
+		if hook.id == id {
+			// Build a new slice rather than modifying the old one in place, so
+			// hooks can remove themselves while the PPU is running them.
+			hooks := make([]ppuHook, 0, len(ppu.hooks)-1)
+			hooks = append(hooks, ppu.hooks[:i]...)
+			ppu.hooks = append(hooks, ppu.hooks[i+1:]...)
+			return nil
+		}
+	}
+	return gError1New(err_UNKNOWN_HOOK, uint64(id))
+}
+
+// runHooks runs every hook registered for the current raster position
+func (ppu *ppu) runHooks() {
+	state := PPUState{ppu.currentScanline, ppu.currentScanlineCycle, ppu.currentFrame}
+	for _, hook := range ppu.hooks {
+		if hook.scanline == state.Scanline && hook.dot == state.Dot {
+			hook.fn(state)
+		}
+	}
+}
+
+/***********************************************/
+/*                  Hooks API                  */
+/***********************************************/
+
+// OnFrameStart registers fn to run when the PPU starts drawing a frame, at
+// scanline 0, dot 0.
+func (emu *Emulator) OnFrameStart(fn HookFunc) HookID {
+	return emu.ppu.addHook(hook_FRAME_START_SCANLINE, 0, fn)
+}
+
+// OnFrameEnd registers fn to run when the PPU has finished drawing a frame, at
+// scanline 240, dot 0. The completed frame is already available from Frame.
+func (emu *Emulator) OnFrameEnd(fn HookFunc) HookID {
+	return emu.ppu.addHook(hook_FRAME_END_SCANLINE, 0, fn)
+}
+
+// OnVBlankStart registers fn to run when the PPU sets the vblank flag, at
+// scanline 241, dot 1.
+func (emu *Emulator) OnVBlankStart(fn HookFunc) HookID {
+	return emu.ppu.addHook(hook_VBLANK_START_SCANLINE, hook_VBLANK_START_DOT, fn)
+}
+
+// OnScanline registers fn to run when the PPU reaches the given dot (0-340)
+// of the given scanline (0-261, where 261 is the pre-render scanline).
+func (emu *Emulator) OnScanline(scanline, dot int, fn HookFunc) (HookID, error) {
+	if scanline < 0 || scanline >= num_SCANLINES || dot < 0 || dot >= num_SCANLINE_DOTS {
+		return 0, gError2New(err_INVALID_RASTER_POSITION, uint64(scanline), uint64(dot))
+	}
+	return emu.ppu.addHook(uint16(scanline), uint16(dot), fn), nil
+}
+
+// RemoveHook unregisters a hook. Hooks may remove themselves, or each other,
+// while they run.
+func (emu *Emulator) RemoveHook(id HookID) error {
+	return emu.ppu.removeHook(id)
+}
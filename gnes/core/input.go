@@ -0,0 +1,208 @@
+package gnes
+
+// Buttons holds the state of a standard controller, one bit per button, in the
+// order the controller reports them.
+type Buttons uint8
+
+const (
+	BUTTON_A      Buttons = 0x01
+	BUTTON_B      Buttons = 0x02
+	BUTTON_SELECT Buttons = 0x04
+	BUTTON_START  Buttons = 0x08
+	BUTTON_UP     Buttons = 0x10
+	BUTTON_DOWN   Buttons = 0x20
+	BUTTON_LEFT   Buttons = 0x40
+	BUTTON_RIGHT  Buttons = 0x80
+)
+
+// Controller ports
+const (
+	PORT_1 = 0
+	PORT_2 = 1
+)
+
+const (
+	// Bit 0 of JOY1 writes is the strobe line shared by both ports
+	JOY_STROBE_MASK uint8 = 0x01
+	JOY_OUTPUT_MASK uint8 = 0x07
+
+	// The data lines (D0-D4) a port drives when it's read. The rest of the byte
+	// is open bus.
+	JOY_DATA_MASK uint8 = 0x1F
+)
+
+// InputDevice is anything that can be plugged into a controller port. Every
+// device sees the strobe line, and a device is read whenever the CPU reads its
+// port.
+type InputDevice interface {
+	// Strobe is called whenever the CPU writes JOY1, with bit 0 of the write.
+	Strobe(high bool)
+
+	// Read returns the data lines D0-D4 in the low 5 bits, and moves on to the
+	// next bit if the device is serial.
+	Read() uint8
+}
+
+// OutputDevice is an InputDevice that also uses the other output lines of JOY1
+// (bits 0-2), e.g. to select what it returns.
+type OutputDevice interface {
+	InputDevice
+
+	// WriteOutput is called whenever the CPU writes JOY1, after Strobe.
+	WriteOutput(val uint8)
+}
+
+// ButtonDevice is an InputDevice that takes its state as standard controller
+// buttons. Frontends, movies and anything else feeding input set its buttons
+// through Emulator.SetButtons.
+type ButtonDevice interface {
+	InputDevice
+	SetButtons(buttons Buttons)
+	Buttons() Buttons
+}
+
+// StandardController is the standard NES controller. It latches its buttons
+// into a shift register while strobed, and returns one bit per read on D0.
+type StandardController struct {
+	buttons Buttons
+	shift   uint8
+	strobe  bool
+}
+
+func NewStandardController() *StandardController {
+	return &StandardController{}
+}
+
+func (ctrl *StandardController) Strobe(high bool) {
+	ctrl.strobe = high
+	if high {
+		ctrl.shift = uint8(ctrl.buttons)
+	}
+}
+
+// Read returns the next button. While the strobe is high, it keeps returning
+// A, and once all 8 buttons have been read, an official controller returns 1.
+func (ctrl *StandardController) Read() uint8 {
+	if ctrl.strobe {
+		return uint8(ctrl.buttons & BUTTON_A)
+	}
+	bit := ctrl.shift & 1
+	ctrl.shift = (ctrl.shift >> 1) | 0x80
+	return bit
+}
+
+func (ctrl *StandardController) SetButtons(buttons Buttons) {
+	ctrl.buttons = buttons
+	if ctrl.strobe {
+		ctrl.shift = uint8(buttons)
+	}
+}
+
+func (ctrl *StandardController) Buttons() Buttons {
+	return ctrl.buttons
+}
+
+// writeJoy strobes the devices in both ports, and passes the output lines to
+// the devices that use them
+func (mmu *mmu) writeJoy(val uint8) {
+	high := (val & JOY_STROBE_MASK) != 0
+	for _, device := range mmu.ports {
+		if device == nil {
+			continue
+		}
+		device.Strobe(high)
+		if output, ok := device.(OutputDevice); ok {
+			output.WriteOutput(val & JOY_OUTPUT_MASK)
+		}
+	}
+}
+
+// readJoy reads the device in 'port'. Only D0-D4 are driven, so the rest of
+// the byte is whatever was last on the bus.
+func (mmu *mmu) readJoy(port int) uint8 {
+	var val uint8
+	if device := mmu.ports[port]; device != nil {
+		val = device.Read() & JOY_DATA_MASK
+	}
+	return val | (mmu.openBus &^ JOY_DATA_MASK)
+}
+
+/***********************************************/
+/*                  Input API                  */
+/***********************************************/
+
+func checkPort(port int) error {
+	if port != PORT_1 && port != PORT_2 {
+		return gError1New(err_INVALID_PORT, uint64(port))
+	}
+	return nil
+}
+
+// SetInputDevice plugs a device into 'port', replacing whatever was there. A
+// nil device leaves the port empty. Both ports start with standard controllers.
+// If a four player adapter is plugged in, it's replaced by a standard
+// controller in the other port. The options are updated to match.
+func (emu *Emulator) SetInputDevice(port int, device InputDevice) error {
+	if err := checkPort(port); err != nil {
+		return err
+	}
+	if emu.adapterControllers != nil {
+		emu.adapterControllers = nil
+		emu.mmu.ports[1-port] = NewStandardController()
+		emu.options.Adapter = ADAPTER_NONE
+		emu.options.Ports[1-port] = DEVICE_STANDARD
+	}
+	emu.mmu.ports[port] = device
+	if deviceType, ok := inputDeviceType(device); ok {
+		emu.options.Ports[port] = deviceType
+	}
+	return nil
+}
+
+// buttonDevice returns what takes the buttons of the controller in 'port'. The
+// third and fourth controllers are only there when an adapter is plugged in.
+func (emu *Emulator) buttonDevice(port int) (ButtonDevice, error) {
+	if port < PORT_1 || port > PORT_4 {
+		return nil, gError1New(err_INVALID_PORT, uint64(port))
+	}
+	if emu.adapterControllers != nil {
+		return emu.adapterControllers[port], nil
+	}
+	if port > PORT_2 {
+		return nil, gError1New(err_NOT_BUTTON_DEVICE, uint64(port))
+	}
+	device, ok := emu.mmu.ports[port].(ButtonDevice)
+	if !ok {
+		return nil, gError1New(err_NOT_BUTTON_DEVICE, uint64(port))
+	}
+	return device, nil
+}
+
+// GetInputDevice returns the device plugged into 'port', or nil if it's empty.
+func (emu *Emulator) GetInputDevice(port int) (InputDevice, error) {
+	if err := checkPort(port); err != nil {
+		return nil, err
+	}
+	return emu.mmu.ports[port], nil
+}
+
+// SetButtons sets the buttons the host holds on the controller in 'port'. The
+// controller also gets any turbo buttons or macro playing on it.
+// PORT_3 and PORT_4 are the extra controllers of a four player adapter.
+func (emu *Emulator) SetButtons(port int, buttons Buttons) error {
+	if _, err := emu.buttonDevice(port); err != nil {
+		return err
+	}
+	emu.input.host[port] = buttons
+	emu.input.apply(emu)
+	return nil
+}
+
+// GetButtons returns the buttons currently held on the controller in 'port'.
+func (emu *Emulator) GetButtons(port int) (Buttons, error) {
+	device, err := emu.buttonDevice(port)
+	if err != nil {
+		return 0, err
+	}
+	return device.Buttons(), nil
+}
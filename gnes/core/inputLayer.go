@@ -0,0 +1,224 @@
+package gnes
+
+import "sort"
+import "strconv"
+import "strings"
+
+const (
+	TURBO_DEFAULT_PERIOD = 4
+	num_CONTROLLERS      = 4
+)
+
+// buttonNames are the names ParseButtons accepts
+var buttonNames = map[string]Buttons{
+	"A":      BUTTON_A,
+	"B":      BUTTON_B,
+	"SELECT": BUTTON_SELECT,
+	"START":  BUTTON_START,
+	"UP":     BUTTON_UP,
+	"DOWN":   BUTTON_DOWN,
+	"LEFT":   BUTTON_LEFT,
+	"RIGHT":  BUTTON_RIGHT,
+}
+
+// MacroStep holds some buttons for a number of frames.
+type MacroStep struct {
+	Buttons Buttons
+	Frames  int
+}
+
+// runningMacro is a macro being played on a controller
+type runningMacro struct {
+	steps []MacroStep
+	step,
+	frame int
+}
+
+// inputLayer sits between the host's input and the controllers. Every frame,
+// it works out the buttons each controller holds from what the host holds,
+// the turbo buttons and any macro being played, and sets them on the
+// controllers. Since the controllers only ever see plain buttons, turbo and
+// macros are recorded into movies like any other input.
+type inputLayer struct {
+	host,
+	turbo [num_CONTROLLERS]Buttons
+
+	// Turbo buttons are pressed for the first half of every period
+	turboPeriod int
+	frame       uint64
+
+	macros  map[string][]MacroStep
+	running [num_CONTROLLERS]*runningMacro
+}
+
+func newInputLayer() *inputLayer {
+	input := &inputLayer{}
+	input.turboPeriod = TURBO_DEFAULT_PERIOD
+	input.macros = make(map[string][]MacroStep)
+	return input
+}
+
+// buttons returns the buttons controller 'port' holds this frame
+func (input *inputLayer) buttons(port int) Buttons {
+	if macro := input.running[port]; macro != nil {
+		return macro.steps[macro.step].Buttons
+	}
+	buttons := input.host[port]
+	if int(input.frame%uint64(input.turboPeriod)) < (input.turboPeriod+1)/2 {
+		buttons |= input.turbo[port]
+	}
+	return buttons
+}
+
+// apply sets the buttons on every controller. Movies drive the controllers
+// themselves while they play.
+func (input *inputLayer) apply(emu *Emulator) {
+	if emu.moviePlayer != nil {
+		return
+	}
+	for port := 0; port < num_CONTROLLERS; port++ {
+		if device, err := emu.buttonDevice(port); err == nil {
+			device.SetButtons(input.buttons(port))
+		}
+	}
+}
+
+// frameDone moves turbo and macros on to the next frame
+func (input *inputLayer) frameDone(emu *Emulator) {
+	input.frame++
+	for port, macro := range input.running {
+		if macro == nil {
+			continue
+		}
+		macro.frame++
+		if macro.frame >= macro.steps[macro.step].Frames {
+			macro.frame = 0
+			macro.step++
+			if macro.step == len(macro.steps) {
+				input.running[port] = nil
+			}
+		}
+	}
+	input.apply(emu)
+}
+
+// ParseButtons parses buttons written as names joined with '+', e.g.
+// "A+START". "-" and "" are no buttons.
+func ParseButtons(text string) (Buttons, error) {
+	var buttons Buttons
+	if text == "-" || text == "" {
+		return 0, nil
+	}
+	for _, name := range strings.Split(text, "+") {
+		button, ok := buttonNames[strings.ToUpper(name)]
+		if !ok {
+			return 0, &gError{err_BAD_MACRO}
+		}
+		buttons |= button
+	}
+	return buttons, nil
+}
+
+// ParseMacro parses a macro written as space separated steps, each some
+// buttons for ParseButtons and a number of frames, e.g. "DOWN:2 -:2 A:1".
+func ParseMacro(text string) ([]MacroStep, error) {
+	var steps []MacroStep
+	for _, field := range strings.Fields(text) {
+		i := strings.LastIndexByte(field, ':')
+		if i < 0 {
+			return nil, &gError{err_BAD_MACRO}
+		}
+		buttons, err := ParseButtons(field[:i])
+		if err != nil {
+			return nil, err
+		}
+		frames, err := strconv.Atoi(field[i+1:])
+		if err != nil || frames < 1 {
+			return nil, &gError{err_BAD_MACRO}
+		}
+		steps = append(steps, MacroStep{buttons, frames})
+	}
+	if len(steps) == 0 {
+		return nil, &gError{err_BAD_MACRO}
+	}
+	return steps, nil
+}
+
+/***********************************************/
+/*               Turbo/macro API               */
+/***********************************************/
+
+// SetTurbo sets the turbo buttons the host holds on controller 'port'. While
+// they're held, they're pressed and released every turbo period.
+func (emu *Emulator) SetTurbo(port int, buttons Buttons) error {
+	if _, err := emu.buttonDevice(port); err != nil {
+		return err
+	}
+	emu.input.turbo[port] = buttons
+	emu.input.apply(emu)
+	return nil
+}
+
+// SetTurboPeriod sets how many frames a turbo press and release take together.
+// It must be at least 2.
+func (emu *Emulator) SetTurboPeriod(frames int) error {
+	if frames < 2 {
+		return gError1New(err_INVALID_TURBO_PERIOD, uint64(frames))
+	}
+	emu.input.turboPeriod = frames
+	return nil
+}
+
+// DefineMacro defines a macro, replacing any with the same name.
+func (emu *Emulator) DefineMacro(name string, steps []MacroStep) error {
+	if len(steps) == 0 {
+		return &gError{err_BAD_MACRO}
+	}
+	for _, step := range steps {
+		if step.Frames < 1 {
+			return &gError{err_BAD_MACRO}
+		}
+	}
+	emu.input.macros[name] = append([]MacroStep(nil), steps...)
+	return nil
+}
+
+// Macros returns the names of the defined macros, sorted.
+func (emu *Emulator) Macros() []string {
+	var names []string
+	for name := range emu.input.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunMacro starts playing a macro on controller 'port', from the next frame.
+// While it plays, it overrides the host's buttons on that controller.
+func (emu *Emulator) RunMacro(name string, port int) error {
+	if _, err := emu.buttonDevice(port); err != nil {
+		return err
+	}
+	steps, ok := emu.input.macros[name]
+	if !ok {
+		return &gError{err_UNKNOWN_MACRO}
+	}
+	// The current frame doesn't count towards the first step
+	emu.input.running[port] = &runningMacro{steps: steps, frame: -1}
+	return nil
+}
+
+// StopMacro stops the macro playing on controller 'port', if there is one.
+func (emu *Emulator) StopMacro(port int) error {
+	if _, err := emu.buttonDevice(port); err != nil {
+		return err
+	}
+	emu.input.running[port] = nil
+	emu.input.apply(emu)
+	return nil
+}
+
+// MacroRunning returns whether a macro is playing on controller 'port'.
+func (emu *Emulator) MacroRunning(port int) bool {
+	return port >= 0 && port < num_CONTROLLERS && emu.input.running[port] != nil
+}
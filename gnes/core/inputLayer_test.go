@@ -0,0 +1,20 @@
+package gnes
+
+import "reflect"
+import "testing"
+
+func TestMacrosSorted(t *testing.T) {
+	emu := testEmulator(t)
+	steps := []MacroStep{{Buttons: BUTTON_A, Frames: 1}}
+	for _, name := range []string{"jump", "dash", "shoot", "duck", "pause"} {
+		if err := emu.DefineMacro(name, steps); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"dash", "duck", "jump", "pause", "shoot"}
+	for i := 0; i < 10; i++ {
+		if names := emu.Macros(); !reflect.DeepEqual(names, want) {
+			t.Fatalf("macros %q, want %q", names, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package gnes
+
+// Key is a key of the Family BASIC keyboard, numbered by its place in the
+// key matrix: 8 per row, 4 for each of the row's two columns.
+type Key int
+
+const (
+	KEY_RIGHT_BRACKET Key = iota
+	KEY_LEFT_BRACKET
+	KEY_RETURN
+	KEY_F8
+	KEY_STOP
+	KEY_YEN
+	KEY_RIGHT_SHIFT
+	KEY_KANA
+
+	KEY_SEMICOLON
+	KEY_COLON
+	KEY_AT
+	KEY_F7
+	KEY_CARET
+	KEY_MINUS
+	KEY_SLASH
+	KEY_UNDERSCORE
+
+	KEY_K
+	KEY_L
+	KEY_O
+	KEY_F6
+	KEY_0
+	KEY_P
+	KEY_COMMA
+	KEY_PERIOD
+
+	KEY_J
+	KEY_U
+	KEY_I
+	KEY_F5
+	KEY_8
+	KEY_9
+	KEY_N
+	KEY_M
+
+	KEY_H
+	KEY_G
+	KEY_Y
+	KEY_F4
+	KEY_6
+	KEY_7
+	KEY_V
+	KEY_B
+
+	KEY_D
+	KEY_R
+	KEY_T
+	KEY_F3
+	KEY_4
+	KEY_5
+	KEY_C
+	KEY_F
+
+	KEY_A
+	KEY_S
+	KEY_W
+	KEY_F2
+	KEY_3
+	KEY_E
+	KEY_Z
+	KEY_X
+
+	KEY_CTR
+	KEY_Q
+	KEY_ESC
+	KEY_F1
+	KEY_2
+	KEY_1
+	KEY_GRPH
+	KEY_LEFT_SHIFT
+
+	KEY_LEFT
+	KEY_RIGHT
+	KEY_UP
+	KEY_CLR_HOME
+	KEY_INS
+	KEY_DEL
+	KEY_SPACE
+	KEY_DOWN
+
+	NUM_KEYS
+)
+
+const (
+	keyboard_ROWS        = 9
+	keyboard_ROW_KEYS    = 8
+	keyboard_COLUMN_KEYS = 4
+
+	// JOY1 write bits
+	keyboard_RESET_MASK  uint8 = 0x01
+	keyboard_COLUMN_MASK uint8 = 0x02
+	keyboard_ENABLE_MASK uint8 = 0x04
+
+	// The keys of the selected column are returned on D1-D4, 0 if pressed
+	keyboard_DATA_SHIFT = 1
+)
+
+// Keyboard is the Family BASIC keyboard. The CPU walks its key matrix through
+// writes to JOY1: bit 0 goes back to the first row, bit 1 selects the column,
+// and moving from column 1 back to column 0 moves on to the next row. Bit 2
+// must be set for the keyboard to respond. It's read through JOY2, so it
+// belongs in PORT_2.
+type Keyboard struct {
+	pressed [NUM_KEYS]bool
+
+	row,
+	column int
+	enabled bool
+}
+
+func NewKeyboard() *Keyboard {
+	return &Keyboard{}
+}
+
+// SetKey presses or releases a key.
+func (kb *Keyboard) SetKey(key Key, pressed bool) {
+	if key >= 0 && key < NUM_KEYS {
+		kb.pressed[key] = pressed
+	}
+}
+
+// KeyPressed returns whether a key is pressed.
+func (kb *Keyboard) KeyPressed(key Key) bool {
+	return key >= 0 && key < NUM_KEYS && kb.pressed[key]
+}
+
+// The keyboard ignores the strobe line on its own, since it sees the whole
+// write through WriteOutput
+func (kb *Keyboard) Strobe(high bool) {}
+
+func (kb *Keyboard) WriteOutput(val uint8) {
+	column := 0
+	if (val & keyboard_COLUMN_MASK) != 0 {
+		column = 1
+	}
+	if kb.column == 1 && column == 0 {
+		kb.row++
+	}
+	kb.column = column
+	if (val & keyboard_RESET_MASK) != 0 {
+		kb.row = 0
+	}
+	kb.enabled = (val & keyboard_ENABLE_MASK) != 0
+}
+
+func (kb *Keyboard) Read() uint8 {
+	if !kb.enabled {
+		return 0
+	}
+	var val uint8 = 0x0F
+	if kb.row < keyboard_ROWS {
+		base := kb.row*keyboard_ROW_KEYS + kb.column*keyboard_COLUMN_KEYS
+		for i := 0; i < keyboard_COLUMN_KEYS; i++ {
+			if kb.pressed[base+i] {
+				val &^= 1 << uint(i)
+			}
+		}
+	}
+	return val << keyboard_DATA_SHIFT
+}
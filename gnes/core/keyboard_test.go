@@ -0,0 +1,69 @@
+package gnes
+
+import "testing"
+
+func TestKeyboardRead(t *testing.T) {
+	const (
+		enable = keyboard_ENABLE_MASK
+		column = keyboard_COLUMN_MASK
+		reset  = keyboard_RESET_MASK
+	)
+	tests := []struct {
+		name  string
+		write uint8
+		// The keys pressed in the selected row and column, bit n for key n of
+		// the column
+		keys uint8
+	}{
+		{"row 0, column 0", enable | reset, 0x4},
+		{"row 0, column 1", enable | column, 0x8},
+		{"column 1 to 0 moves to row 1", enable, 0x4},
+		{"column 0 again stays on row 1", enable, 0x4},
+		{"row 1, column 1", enable | column, 0x0},
+		{"row 2, column 0", enable, 0x1},
+		{"reset goes back to row 0", enable | reset, 0x4},
+		{"reset with column 1", enable | reset | column, 0x8},
+		{"reset holds row 0", enable | reset, 0x4},
+	}
+	emu := testEmulator(t)
+	kb := NewKeyboard()
+	if err := emu.SetInputDevice(PORT_2, kb); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []Key{KEY_RETURN, KEY_KANA, KEY_AT, KEY_K} {
+		kb.SetKey(key, true)
+	}
+	read := func() uint8 {
+		val, err := emu.mmu.read(JOY2_ADDR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return val & JOY_DATA_MASK
+	}
+	for _, test := range tests {
+		if err := emu.mmu.write(test.write, JOY1_ADDR); err != nil {
+			t.Fatal(err)
+		}
+		// Pressed keys read as 0
+		want := (0x0F &^ test.keys) << keyboard_DATA_SHIFT
+		if val := read(); val != want {
+			t.Errorf("%s: read $%02X, want $%02X", test.name, val, want)
+		}
+	}
+
+	// Past the last row, nothing is pressed
+	emu.mmu.write(enable|reset, JOY1_ADDR)
+	for row := 0; row < keyboard_ROWS; row++ {
+		emu.mmu.write(enable|column, JOY1_ADDR)
+		emu.mmu.write(enable, JOY1_ADDR)
+	}
+	if val := read(); val != 0x0F<<keyboard_DATA_SHIFT {
+		t.Errorf("past the last row: read $%02X", val)
+	}
+
+	// A disabled keyboard returns nothing
+	emu.mmu.write(reset, JOY1_ADDR)
+	if val := read(); val != 0 {
+		t.Errorf("disabled: read $%02X, want 0", val)
+	}
+}
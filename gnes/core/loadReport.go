@@ -0,0 +1,259 @@
+package gnes
+
+import "bytes"
+import "fmt"
+import "io/ioutil"
+
+// Severity says how much a problem found in a ROM file matters.
+type Severity int
+
+const (
+	// SEVERITY_INFO problems don't affect emulation
+	SEVERITY_INFO Severity = iota
+	// SEVERITY_WARNING problems are worked around, but the game may not run
+	// the way it should
+	SEVERITY_WARNING
+	// SEVERITY_ERROR problems stop the ROM loading unless they're repaired
+	SEVERITY_ERROR
+)
+
+var severityNames = map[Severity]string{
+	SEVERITY_INFO:    "info",
+	SEVERITY_WARNING: "warning",
+	SEVERITY_ERROR:   "error",
+}
+
+// ProblemKind identifies a problem found in a ROM file.
+type ProblemKind int
+
+const (
+	PROBLEM_TRUNCATED_HEADER ProblemKind = iota
+	PROBLEM_BAD_MAGIC
+	PROBLEM_NO_PRG_ROM
+	PROBLEM_TRUNCATED_DATA
+	PROBLEM_TRAILING_DATA
+	PROBLEM_DIRTY_HEADER
+	PROBLEM_DISKDUDE
+	PROBLEM_SUBMAPPER_FALLBACK
+	PROBLEM_NSF_EXPANSION
+)
+
+// repairRom won't pad a ROM file by more than this, or by more than the
+// file's own size, as a header asking for that much is more likely garbage
+// than a bad dump
+const repair_MAX_PADDING = 64 << 20
+
+// diskDude is the signature an old ripping tool left in bytes 7-15 of iNES
+// headers
+var diskDude = []byte("DiskDude!")
+
+// LoadProblem is a problem found in a ROM file.
+type LoadProblem struct {
+	Kind     ProblemKind
+	Severity Severity
+	Message  string
+
+	// Repaired is set when the problem was fixed while loading, either by
+	// LoadOptions.Repair or with the help of the ROM database
+	Repaired bool
+}
+
+func (problem LoadProblem) String() string {
+	s := severityNames[problem.Severity] + ": " + problem.Message
+	if problem.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+// LoadReport lists the problems found in a ROM file when it was loaded.
+type LoadReport struct {
+	Problems []LoadProblem
+}
+
+func (report *LoadReport) add(kind ProblemKind, severity Severity, format string, args ...interface{}) {
+	report.Problems = append(report.Problems, LoadProblem{kind, severity, fmt.Sprintf(format, args...), false})
+}
+
+// find returns the first problem of a kind, or nil
+func (report *LoadReport) find(kind ProblemKind) *LoadProblem {
+	for i := range report.Problems {
+		if report.Problems[i].Kind == kind {
+			return &report.Problems[i]
+		}
+	}
+	return nil
+}
+
+// OK returns whether every error was repaired.
+func (report *LoadReport) OK() bool {
+	return report.err() == nil
+}
+
+// err returns an error for the first error that wasn't repaired, or nil
+func (report *LoadReport) err() error {
+	for _, problem := range report.Problems {
+		if problem.Severity != SEVERITY_ERROR || problem.Repaired {
+			continue
+		}
+		switch problem.Kind {
+		case PROBLEM_BAD_MAGIC:
+			return &gError{err_BAD_MAGIC_CONSTANT}
+		case PROBLEM_NO_PRG_ROM:
+			return &gError{err_INCONSISTENT_PRG_ROM_SIZE}
+		case PROBLEM_DIRTY_HEADER, PROBLEM_DISKDUDE:
+			return &gError{err_NONZERO_INES_HEADER_BUFFER}
+		default:
+			return &gError{err_TRUNCATED_ROM}
+		}
+	}
+	return nil
+}
+
+// LoadOptions control how a ROM file is loaded.
+type LoadOptions struct {
+	// Repair fixes what it can in a broken ROM file, and loads it anyway.
+	// Junk in the header is cleared, and missing PRG or CHR ROM is filled with
+	// zeros, unless more is missing than the file holds. Without it, any error
+	// stops the ROM loading, except junk in the header of a game in the ROM
+	// database.
+	Repair bool
+
+	// ArchiveEntry names the file to load from a zip file. If it's empty, the
+	// first .nes, .fds, .nsf or .nsfe file is loaded.
+	ArchiveEntry string
+}
+
+// romLayout is where the header says each section of a ROM file is
+type romLayout struct {
+	prgStart,
+	prgSize,
+	chrSize,
+	dataEnd uint64
+}
+
+// layoutRom works out the layout of a ROM file from its header
+func layoutRom(rom []byte) (romLayout, error) {
+	var layout romLayout
+	var err error
+	layout.prgStart = HEADER_SIZE
+	if (rom[6] & TRAINER_MASK) == TRAINER_FLAG {
+		layout.prgStart += TRAINER_SIZE
+	}
+	if (rom[7] & NES2_MASK) == NES2_FLAG {
+		layout.prgSize, err = nes2RomSize(rom[4], rom[9]&NES2_PRG_ROM_HI_MASK, PRG_ROM_SIZE)
+		if err != nil {
+			return layout, err
+		}
+		layout.chrSize, err = nes2RomSize(rom[5], (rom[9]&NES2_CHR_ROM_HI_MASK)>>4, CHR_ROM_SIZE)
+		if err != nil {
+			return layout, err
+		}
+	} else {
+		layout.prgSize = uint64(rom[4]) * PRG_ROM_SIZE
+		layout.chrSize = uint64(rom[5]) * CHR_ROM_SIZE
+	}
+	layout.dataEnd = layout.prgStart + layout.prgSize + layout.chrSize
+	return layout, nil
+}
+
+// ValidateRom checks an iNES or NES 2.0 file for problems, without loading it.
+func ValidateRom(rom []byte) *LoadReport {
+	report := &LoadReport{}
+	if len(rom) < HEADER_SIZE {
+		report.add(PROBLEM_TRUNCATED_HEADER, SEVERITY_ERROR, "File is %d bytes, too short for a header", len(rom))
+		return report
+	}
+	if !bytes.HasPrefix(rom, inesMagic) {
+		report.add(PROBLEM_BAD_MAGIC, SEVERITY_ERROR, "File doesn't start with the iNES magic constant")
+		return report
+	}
+
+	nes2 := (rom[7] & NES2_MASK) == NES2_FLAG
+	if bytes.Equal(rom[7:HEADER_SIZE], diskDude) {
+		report.add(PROBLEM_DISKDUDE, SEVERITY_ERROR, "Header bytes 7-15 hold a \"DiskDude!\" signature")
+	} else if !nes2 && !bytes.Equal(rom[11:15], []byte{0, 0, 0, 0}) {
+		report.add(PROBLEM_DIRTY_HEADER, SEVERITY_ERROR, "Header bytes 11-14 should be zero, but hold % x", rom[11:15])
+	}
+	if report.find(PROBLEM_DISKDUDE) != nil || report.find(PROBLEM_DIRTY_HEADER) != nil {
+		// Only bytes 4-6 of the header can be trusted
+		nes2 = false
+		rom = cleanHeader(rom)
+	}
+
+	layout, err := layoutRom(rom)
+	if err != nil {
+		report.add(PROBLEM_TRUNCATED_DATA, SEVERITY_ERROR, "Header says the ROM is larger than any file could be")
+		return report
+	}
+	if layout.prgSize == 0 {
+		report.add(PROBLEM_NO_PRG_ROM, SEVERITY_ERROR, "Header says there is no PRG ROM")
+	}
+	size := uint64(len(rom))
+	if size < layout.dataEnd {
+		report.add(PROBLEM_TRUNCATED_DATA, SEVERITY_ERROR, "File is %d bytes short of the PRG and CHR ROM the header says it has",
+			layout.dataEnd-size)
+	} else if size > layout.dataEnd {
+		extra := size - layout.dataEnd
+		pc10 := (rom[7] & PC10_MASK) == PC10_FLAG
+		if nes2 && (rom[14]&MISC_ROMS_MASK) != 0 {
+			report.add(PROBLEM_TRAILING_DATA, SEVERITY_INFO, "%d bytes of miscellaneous ROM follow CHR ROM", extra)
+		} else if pc10 && extra == PC_ROM_SIZE+PC_PROM_SIZE {
+			report.add(PROBLEM_TRAILING_DATA, SEVERITY_INFO, "PlayChoice INST-ROM and PROM follow CHR ROM")
+		} else {
+			report.add(PROBLEM_TRAILING_DATA, SEVERITY_WARNING, "%d bytes of unknown data follow CHR ROM, and are ignored", extra)
+		}
+	}
+	return report
+}
+
+// cleanHeader returns a copy of an iNES file with bytes 7-15 of the header
+// zeroed
+func cleanHeader(rom []byte) []byte {
+	clean := make([]byte, len(rom))
+	copy(clean, rom[:7])
+	copy(clean[HEADER_SIZE:], rom[HEADER_SIZE:])
+	return clean
+}
+
+// repairRom returns a copy of a ROM file with every problem in the report that
+// can be fixed fixed, and marks them repaired.
+func repairRom(rom []byte, report *LoadReport) []byte {
+	for _, kind := range []ProblemKind{PROBLEM_DISKDUDE, PROBLEM_DIRTY_HEADER} {
+		if problem := report.find(kind); problem != nil {
+			rom = cleanHeader(rom)
+			problem.Repaired = true
+		}
+	}
+	if problem := report.find(PROBLEM_TRUNCATED_DATA); problem != nil {
+		layout, err := layoutRom(rom)
+		size := uint64(len(rom))
+		if err == nil && layout.prgSize != 0 && layout.dataEnd-size <= size && layout.dataEnd-size <= repair_MAX_PADDING {
+			padded := make([]byte, layout.dataEnd)
+			copy(padded, rom)
+			rom = padded
+			problem.Repaired = true
+		}
+	}
+	return rom
+}
+
+/***********************************************/
+/*                Load report API              */
+/***********************************************/
+
+// NewEmulatorWithOptions loads a ROM like NewEmulator, with control over how
+// problems in the file are handled. Whatever was found is in LoadReport.
+func NewEmulatorWithOptions(path string, options LoadOptions) (*Emulator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewEmulatorFromBytes(data, path, options)
+}
+
+// LoadReport returns the problems found in the ROM file when it was loaded,
+// and anything about it that isn't emulated the way its header asks.
+func (emu *Emulator) LoadReport() *LoadReport {
+	return emu.report
+}
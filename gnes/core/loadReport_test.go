@@ -0,0 +1,118 @@
+package gnes
+
+import "testing"
+
+func TestLoadReport(t *testing.T) {
+	truncated := testNrom()[:HEADER_SIZE+PRG_ROM_SIZE]
+	tooLarge := testNrom()
+	tooLarge[4] = 0xFF
+	exponent := testNrom()
+	exponent[4] = 32<<2 | 3
+	exponent[7] = NES2_FLAG
+	exponent[9] = 0x0F
+	trailing := append(testNrom(), make([]byte, 100)...)
+	diskDude := testNrom()
+	copy(diskDude[7:], "DiskDude!")
+	dirty := testNrom()
+	dirty[12] = 1
+	dirtyKnown := testDbRom(7, 3)
+	dirtyKnown[12] = 1
+	badMagic := testNrom()
+	badMagic[3] = 0
+	noPrgNrom := testNrom()[:HEADER_SIZE+CHR_ROM_SIZE]
+	noPrgNrom[4] = 0
+	noPrgMmc1 := append([]byte{}, noPrgNrom...)
+	noPrgMmc1[6] = 0x10
+
+	tests := []struct {
+		name  string
+		rom   []byte
+		kinds []ProblemKind
+		// Whether the ROM loads without and with LoadOptions.Repair
+		loads,
+		repairedLoads bool
+	}{
+		{"clean", testNrom(), nil, true, true},
+		{"truncated", truncated, []ProblemKind{PROBLEM_TRUNCATED_DATA}, false, true},
+		{"too large to pad", tooLarge, []ProblemKind{PROBLEM_TRUNCATED_DATA}, false, false},
+		{"exponent too large to pad", exponent, []ProblemKind{PROBLEM_TRUNCATED_DATA}, false, false},
+		{"trailing data", trailing, []ProblemKind{PROBLEM_TRAILING_DATA}, true, true},
+		{"DiskDude", diskDude, []ProblemKind{PROBLEM_DISKDUDE}, false, true},
+		{"dirty header", dirty, []ProblemKind{PROBLEM_DIRTY_HEADER}, false, true},
+		{"dirty header in the database", dirtyKnown, []ProblemKind{PROBLEM_DIRTY_HEADER}, true, true},
+		{"bad magic", badMagic, []ProblemKind{PROBLEM_BAD_MAGIC}, false, false},
+		{"truncated header", testNrom()[:HEADER_SIZE-1], []ProblemKind{PROBLEM_TRUNCATED_HEADER}, false, false},
+		{"no PRG ROM, NROM", noPrgNrom, []ProblemKind{PROBLEM_NO_PRG_ROM}, false, false},
+		{"no PRG ROM, MMC1", noPrgMmc1, []ProblemKind{PROBLEM_NO_PRG_ROM}, false, false},
+	}
+	loadTestRomDb(t)
+	for _, test := range tests {
+		report := ValidateRom(test.rom)
+		if len(report.Problems) != len(test.kinds) {
+			t.Errorf("%s: found %v", test.name, report.Problems)
+			continue
+		}
+		for i, problem := range report.Problems {
+			if problem.Kind != test.kinds[i] {
+				t.Errorf("%s: found %v", test.name, report.Problems)
+			}
+		}
+
+		for _, repair := range []bool{false, true} {
+			loads := test.loads
+			if repair {
+				loads = test.repairedLoads
+			}
+			emu, err := NewEmulatorFromBytes(test.rom, "test.nes", LoadOptions{Repair: repair})
+			if (err == nil) != loads {
+				t.Errorf("%s, repair %t: got error %v", test.name, repair, err)
+				continue
+			}
+			if err == nil && !emu.LoadReport().OK() {
+				t.Errorf("%s, repair %t: loaded with %v", test.name, repair, emu.LoadReport().Problems)
+			}
+		}
+	}
+}
+
+func TestRepairRom(t *testing.T) {
+	rom := testNrom()
+	copy(rom[7:], "DiskDude!")
+	rom[HEADER_SIZE] = 0xEA
+	rom = rom[:HEADER_SIZE+PRG_ROM_SIZE+100]
+	report := ValidateRom(rom)
+	repaired := repairRom(rom, report)
+	if !report.OK() {
+		t.Errorf("not repaired: %v", report.Problems)
+	}
+	if len(repaired) != HEADER_SIZE+PRG_ROM_SIZE+CHR_ROM_SIZE {
+		t.Errorf("repaired to %d bytes", len(repaired))
+	}
+	for i := 7; i < HEADER_SIZE; i++ {
+		if repaired[i] != 0 {
+			t.Errorf("header byte %d is $%02X", i, repaired[i])
+		}
+	}
+	if repaired[HEADER_SIZE] != 0xEA || repaired[len(repaired)-1] != 0 {
+		t.Error("data wasn't kept, or padding isn't zero")
+	}
+	if rom[7] != 'D' {
+		t.Error("the original was changed")
+	}
+}
+
+func TestMappersRejectNoPrgRom(t *testing.T) {
+	constructors := map[string]func(*cartInfo, *ppu) (mapper, error){
+		"NROM":  newMapper_NROM,
+		"MMC1":  newMapper_MMC1,
+		"UxROM": newMapper_UxROM,
+	}
+	for name, newMapper := range constructors {
+		info := newCartInfo()
+		info.chrRomSize = 1
+		info.data.chrRom = make([]byte, CHR_ROM_SIZE)
+		if _, err := newMapper(info, nil); err == nil {
+			t.Errorf("%s accepted a cartridge without PRG ROM", name)
+		}
+	}
+}
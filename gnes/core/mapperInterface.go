@@ -1,24 +1,52 @@
 package gnes
 
-var mapperMap = map[uint32]func(*cartInfo, *ppu) (mapper, error){
-	0: newMapper_NROM,
-	1: newMapper_MMC1,
+// mapperKey identifies a board by its mapper number and NES 2.0 submapper.
+// Submapper 0 is the mapper's default behaviour.
+type mapperKey struct {
+	mapper,
+	submapper uint32
 }
 
+// mapperMap holds the constructors of every supported board. Constructors can
+// tell boards sharing a mapper apart by info.submapper.
+var mapperMap = map[mapperKey]func(*cartInfo, *ppu) (mapper, error){
+	{0, 0}:                                newMapper_NROM,
+	{1, 0}:                                newMapper_MMC1,
+	{1, submapper_MMC1_SEROM}:             newMapper_MMC1,
+	{2, 0}:                                newMapper_UxROM,
+	{2, submapper_UXROM_NO_BUS_CONFLICTS}: newMapper_UxROM,
+	{2, submapper_UXROM_BUS_CONFLICTS}:    newMapper_UxROM,
+}
+
+// numberToMapper constructs the board for the mapper and the cartridge's
+// submapper. If the submapper isn't supported, the mapper's default behaviour
+// is used instead, and info.mapperFallback is set.
 func numberToMapper(mapper uint32, info *cartInfo, ppu *ppu) (mapper, error) {
-	if mapFunc, ok := mapperMap[mapper]; ok {
-		newMapper, err := mapFunc(info, ppu)
-		if err != nil {
-			return nil, err
+	info.mapperFallback = false
+	mapFunc, ok := mapperMap[mapperKey{mapper, info.submapper}]
+	if !ok {
+		mapFunc, ok = mapperMap[mapperKey{mapper, 0}]
+		if !ok {
+			return nil, &gError1{err_MAPPER_UNSUPPORTED, uint64(mapper)}
 		}
-		return newMapper, nil
-	} else {
-		return nil, &gError1{err_MAPPER_UNSUPPORTED, uint64(mapper)}
+		info.mapperFallback = true
+		fallback := *info
+		fallback.submapper = 0
+		info = &fallback
 	}
+	newMapper, err := mapFunc(info, ppu)
+	if err != nil {
+		return nil, err
+	}
+	return newMapper, nil
 }
 
 type mapper interface {
 	write(val uint8, addr uint16) error
 	read(addr uint16) (uint8, error)
 	getAddrPointer(addr uint16) (*uint8, error)
+
+	// readChr and writeChr access the pattern tables at $0000-$1FFF on the PPU bus
+	readChr(addr uint16) (uint8, error)
+	writeChr(val uint8, addr uint16) error
 }
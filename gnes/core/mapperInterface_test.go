@@ -0,0 +1,65 @@
+package gnes
+
+import "testing"
+
+func TestNumberToMapper(t *testing.T) {
+	tests := []struct {
+		mapper, submapper uint32
+		fallback          bool
+	}{
+		{0, 0, false},
+		{1, submapper_MMC1_SEROM, false},
+		{1, 3, true},
+		{2, submapper_UXROM_BUS_CONFLICTS, false},
+		{2, 7, true},
+	}
+	for _, test := range tests {
+		info := testMMC1Info(2, test.submapper)
+		ppu, err := newPpu()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := numberToMapper(test.mapper, info, ppu); err != nil {
+			t.Errorf("mapper %d, submapper %d: %v", test.mapper, test.submapper, err)
+			continue
+		}
+		if info.mapperFallback != test.fallback {
+			t.Errorf("mapper %d, submapper %d: fallback %t", test.mapper, test.submapper, info.mapperFallback)
+		}
+		if info.submapper != test.submapper {
+			t.Errorf("mapper %d, submapper %d: submapper changed to %d", test.mapper, test.submapper, info.submapper)
+		}
+	}
+
+	ppu, _ := newPpu()
+	if _, err := numberToMapper(99, testMMC1Info(2, 0), ppu); err == nil {
+		t.Error("constructed mapper 99")
+	}
+}
+
+func TestSubmapperFallbackWarning(t *testing.T) {
+	rom := testNrom()
+	rom[6] = 0x20 // UxROM
+	rom[7] = NES2_FLAG
+	rom[8] = 7 << 4
+	emu, err := NewEmulatorFromBytes(rom, "test.nes", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	problem := emu.LoadReport().find(PROBLEM_SUBMAPPER_FALLBACK)
+	if problem == nil || problem.Severity != SEVERITY_WARNING {
+		t.Fatalf("problems %v, want a submapper fallback warning", emu.LoadReport().Problems)
+	}
+	if !emu.info.mapperFallback || emu.info.mapper != 2 || emu.info.submapper != 7 {
+		t.Errorf("loaded mapper %d submapper %d, fallback %t", emu.info.mapper, emu.info.submapper, emu.info.mapperFallback)
+	}
+
+	rom[8] = submapper_UXROM_BUS_CONFLICTS << 4
+	emu, err = NewEmulatorFromBytes(rom, "test.nes", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problem := emu.LoadReport().find(PROBLEM_SUBMAPPER_FALLBACK); problem != nil {
+		t.Errorf("supported submapper reported: %v", problem)
+	}
+}
@@ -3,6 +3,7 @@ package gnes
 const (
 	vector_RESET_HI = 0xFFFD
 	vector_RESET_LO = 0xFFFC
+	vector_IRQ      = 0xFFFE
 )
 const (
 	INTERNAL_RAM_SIZE        = 0x800
@@ -34,8 +35,14 @@ const (
 	PPUSCROLL_ADDR = 0x2005
 	PPUADDR_ADDR   = 0x2006
 	PPUDATA_ADDR   = 0x2007
+	OAMDMA_ADDR    = 0x4014
+	JOY1_ADDR      = 0x4016
+	JOY2_ADDR      = 0x4017
 )
 
+// Number of cycles the CPU is halted for while OAM DMA copies a page
+const OAMDMA_CYCLES = 513
+
 const (
 	REGION_INTERNAL_RAM        = 1
 	REGION_INTERNAL_RAM_MIRROR = 2
@@ -46,27 +53,99 @@ const (
 	REGION_CART_SPACE          = 7
 )
 
-type apuRegisters struct {
-}
-
 // mmu contains all memory accessible to all subsystems of the NES, and is the sole
 // interface through which subsystems read and write memory.
 type mmu struct {
-	mapper  mapper
-	ram     [INTERNAL_RAM_SIZE]byte
-	apuRegs *apuRegisters
-	ppu     *ppu
+	mapper mapper
+	ram    [INTERNAL_RAM_SIZE]byte
+	apu    *apu
+	ppu    *ppu
+
+	// The devices plugged into the controller ports
+	ports [2]InputDevice
+
+	// openBus is the last value seen on the CPU's data bus, which is what reads
+	// of unmapped addresses return
+	openBus uint8
+
+	// ioRead is the last register with read side effects (PPUDATA or a
+	// controller port) read by the current instruction, or 0 if there was none.
+	// A DMC fetch that lands on that read makes the CPU read it again.
+	ioRead uint16
+
+	// stallCycles counts the cycles the CPU loses to DMA. It is collected by the
+	// cpu after each instruction.
+	stallCycles uint64
 }
 
-func newMmu(mapperNum uint32, info *cartInfo, ppu *ppu) (*mmu, error) {
-	mmu := &mmu{}
-	mmu.ppu = ppu
+func newMmu(mapperNum uint32, info *cartInfo, ppu *ppu, apu *apu) (*mmu, error) {
 	mapper, err := numberToMapper(mapperNum, info, ppu)
 	if err != nil {
 		return nil, err
 	}
+	return newMmuWithMapper(mapper, ppu, apu), nil
+}
+
+func newMmuWithMapper(mapper mapper, ppu *ppu, apu *apu) *mmu {
+	mmu := &mmu{}
+	mmu.ppu = ppu
+	mmu.apu = apu
+	mmu.ports[PORT_1] = NewStandardController()
+	mmu.ports[PORT_2] = NewStandardController()
+	apu.setMmu(mmu)
 	mmu.mapper = mapper
-	return mmu, nil
+	ppu.mapper = mapper
+	return mmu
+}
+
+// oamDma copies the 256 byte page starting at page << 8 into OAM, through OAMDATA.
+func (mmu *mmu) oamDma(page uint8) error {
+	base := uint16(page) << 8
+	for i := uint16(0); i < size_OAM; i++ {
+		val, err := mmu.read(base + i)
+		if err != nil {
+			return err
+		}
+		err = mmu.ppu.writeCPU(val, OAMDATA_ADDR)
+		if err != nil {
+			return err
+		}
+	}
+	mmu.stallCycles += OAMDMA_CYCLES
+	return nil
+}
+
+// dmcConflict models the DMC's DMA conflict. When a sample fetch halts the CPU
+// during a read, the CPU repeats that read while it waits, which clocks the
+// controllers or increments the PPU address an extra time. Since the CPU isn't
+// cycle accurate, fetches are assumed to land on the instruction's last
+// register read.
+func (mmu *mmu) dmcConflict() error {
+	if mmu.ioRead == 0 {
+		return nil
+	}
+	addr := mmu.ioRead
+	mmu.ioRead = 0
+	_, err := mmu.read(addr)
+	return err
+}
+
+// endInstruction is called once the APU and PPU have caught up with an
+// instruction, after which its register reads can no longer conflict with DMA.
+func (mmu *mmu) endInstruction() {
+	mmu.ioRead = 0
+}
+
+// irqAsserted returns whether any device is holding the CPU's IRQ line
+func (mmu *mmu) irqAsserted() bool {
+	return mmu.apu.irqAsserted()
+}
+
+// takeStallCycles returns the cycles lost to DMA since the last call.
+func (mmu *mmu) takeStallCycles() uint64 {
+	cycles := mmu.stallCycles
+	mmu.stallCycles = 0
+	return cycles
 }
 
 func (mmu *mmu) getAddrPointer(addr uint16) (*uint8, error) {
@@ -122,12 +201,31 @@ func (mmu *mmu) read(addr uint16) (uint8, error) {
 		if err != nil {
 			return 0, err
 		}
+		if addr == PPUDATA_ADDR {
+			mmu.ioRead = addr
+		}
 	case REGION_PPU_REG_MIRROR:
 		val, err = mmu.ppu.readCPU(addr)
 		if err != nil {
 			return 0, err
 		}
-	//case REGION_APU_IO_REG:
+		if addr%PPU_REG_SIZE == PPUDATA_ADDR%PPU_REG_SIZE {
+			mmu.ioRead = addr
+		}
+	case REGION_APU_IO_REG:
+		switch addr {
+		case SND_CHN_ADDR:
+			// Bit 5 of SND_CHN isn't driven
+			val = mmu.apu.readStatus() | (mmu.openBus & 0x20)
+		case JOY1_ADDR:
+			mmu.ioRead = addr
+			val = mmu.readJoy(PORT_1)
+		case JOY2_ADDR:
+			mmu.ioRead = addr
+			val = mmu.readJoy(PORT_2)
+		default:
+			val = mmu.openBus
+		}
 	//case REGION_APU_IO_TEST:
 	case REGION_CART_SPACE:
 		val, err = mmu.mapper.read(addr)
@@ -138,6 +236,7 @@ func (mmu *mmu) read(addr uint16) (uint8, error) {
 		return 0, &gError{err_ADDR_OUT_OF_BOUNDS}
 	}
 
+	mmu.openBus = val
 	return val, nil
 }
 
@@ -168,13 +267,21 @@ func (mmu *mmu) write(val uint8, addr uint16) error {
 		err = mmu.ppu.writeCPU(val, addr)
 	case REGION_PPU_REG_MIRROR:
 		err = mmu.ppu.writeCPU(val, addr)
-	//case REGION_APU_IO_REG:
+	case REGION_APU_IO_REG:
+		if addr == OAMDMA_ADDR {
+			err = mmu.oamDma(val)
+		} else if addr == JOY1_ADDR {
+			mmu.writeJoy(val)
+		} else {
+			err = mmu.apu.writeCPU(val, addr)
+		}
 	//case REGION_APU_IO_TEST:
 	case REGION_CART_SPACE:
 		err = mmu.mapper.write(val, addr)
 	default:
 		err = &gError{err_ADDR_OUT_OF_BOUNDS}
 	}
+	mmu.openBus = val
 	return err
 }
 
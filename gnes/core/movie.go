@@ -0,0 +1,282 @@
+package gnes
+
+import "crypto/md5"
+
+// Commands a movie frame can start with
+const (
+	MOVIE_CMD_RESET uint8 = 0x01
+	MOVIE_CMD_POWER uint8 = 0x02
+)
+
+// ZapperState is what a movie records of a Zapper each frame.
+type ZapperState struct {
+	X,
+	Y int
+	Trigger bool
+}
+
+// MovieFrame is the input for one frame of a movie.
+type MovieFrame struct {
+	// Commands is a mask of MOVIE_CMD_ bits, carried out as the frame starts
+	Commands uint8
+
+	// Buttons holds the standard controllers, in PORT_1 to PORT_4, and Zappers
+	// holds the Zappers in PORT_1 and PORT_2
+	Buttons [4]Buttons
+	Zappers [2]ZapperState
+}
+
+// Movie is a recording of the input of every frame from power on. Movies only
+// support what FM2 files can describe: standard controllers, Zappers, empty
+// ports and the Four Score.
+type Movie struct {
+	Frames []MovieFrame
+
+	// The console the movie was recorded on
+	PAL       bool
+	FourScore bool
+	Ports     [2]DeviceType
+
+	// Options holds the enhancements the movie was recorded with. Its input
+	// devices are ignored in favour of FourScore and Ports.
+	Options Options
+
+	// The ROM the movie was recorded with, and the MD5 of its data
+	RomName     string
+	RomChecksum [md5.Size]byte
+
+	GUID          string
+	RerecordCount int
+	Comments      []string
+}
+
+// movieRecorder appends a frame to its movie at the end of every frame.
+type movieRecorder struct {
+	movie *Movie
+
+	// commands were carried out at the start of the current frame, and pending
+	// will be carried out at the start of the next
+	commands,
+	pending uint8
+}
+
+// readInput returns the state of every device the movie covers
+func (movie *Movie) readInput(emu *Emulator) MovieFrame {
+	var frame MovieFrame
+	ports := 2
+	if movie.FourScore {
+		ports = 4
+	}
+	for port := 0; port < ports; port++ {
+		if device, err := emu.buttonDevice(port); err == nil {
+			frame.Buttons[port] = device.Buttons()
+		}
+	}
+	for port := PORT_1; port <= PORT_2; port++ {
+		if zapper, ok := emu.mmu.ports[port].(*Zapper); ok {
+			frame.Zappers[port] = ZapperState{zapper.x, zapper.y, zapper.trigger}
+		}
+	}
+	return frame
+}
+
+// applyInput sets every device the movie covers to the frame's state
+func (movie *Movie) applyInput(emu *Emulator, frame *MovieFrame) {
+	ports := 2
+	if movie.FourScore {
+		ports = 4
+	}
+	for port := 0; port < ports; port++ {
+		if device, err := emu.buttonDevice(port); err == nil {
+			device.SetButtons(frame.Buttons[port])
+		}
+	}
+	for port := PORT_1; port <= PORT_2; port++ {
+		if zapper, ok := emu.mmu.ports[port].(*Zapper); ok {
+			state := frame.Zappers[port]
+			zapper.Aim(state.X, state.Y)
+			zapper.SetTrigger(state.Trigger)
+		}
+	}
+}
+
+// runMovieCommands carries out the commands a frame starts with
+func runMovieCommands(emu *Emulator, commands uint8) error {
+	if (commands & MOVIE_CMD_POWER) != 0 {
+		return emu.power()
+	} else if (commands & MOVIE_CMD_RESET) != 0 {
+		return emu.reset()
+	}
+	return nil
+}
+
+func (rec *movieRecorder) frameDone(emu *Emulator) error {
+	frame := rec.movie.readInput(emu)
+	frame.Commands = rec.commands
+	rec.movie.Frames = append(rec.movie.Frames, frame)
+
+	rec.commands = rec.pending
+	rec.pending = 0
+	return runMovieCommands(emu, rec.commands)
+}
+
+// moviePlayer sets the input at the start of every frame from its movie.
+type moviePlayer struct {
+	movie *Movie
+	frame int
+
+	// options are the caller's, restored when playback stops
+	options Options
+}
+
+// startFrame carries out the current frame's commands and sets its input
+func (player *moviePlayer) startFrame(emu *Emulator) error {
+	frame := &player.movie.Frames[player.frame]
+	err := runMovieCommands(emu, frame.Commands)
+	if err != nil {
+		return err
+	}
+	player.movie.applyInput(emu, frame)
+	return nil
+}
+
+func (player *moviePlayer) frameDone(emu *Emulator) error {
+	player.frame++
+	if player.frame >= len(player.movie.Frames) {
+		return emu.StopMovie()
+	}
+	return player.startFrame(emu)
+}
+
+// movieOptions returns the options the movie was recorded with
+func (movie *Movie) movieOptions() Options {
+	options := movie.Options
+	options.Ports = movie.Ports
+	options.Adapter = ADAPTER_NONE
+	if movie.FourScore {
+		options.Adapter = ADAPTER_FOUR_SCORE
+	}
+	return options
+}
+
+/***********************************************/
+/*                  Movie API                  */
+/***********************************************/
+
+// StartMovieRecording power cycles the console and starts recording the input
+// of every frame. Only devices that movies support can be plugged in.
+func (emu *Emulator) StartMovieRecording() error {
+	if emu.movieRecorder != nil || emu.moviePlayer != nil {
+		return &gError{err_MOVIE_IN_PROGRESS}
+	}
+	movie := &Movie{}
+	movie.PAL = emu.info.system == SYS_PAL
+	movie.RomName = emu.romName
+	movie.RomChecksum = emu.romChecksum
+	movie.GUID = newMovieGUID()
+	movie.Options = emu.options
+	switch emu.options.Adapter {
+	case ADAPTER_NONE:
+	case ADAPTER_FOUR_SCORE:
+		movie.FourScore = true
+	default:
+		return &gError{err_MOVIE_UNSUPPORTED_DEVICE}
+	}
+	for port, device := range emu.options.Ports {
+		if device != DEVICE_STANDARD && device != DEVICE_NONE && device != DEVICE_ZAPPER {
+			return &gError{err_MOVIE_UNSUPPORTED_DEVICE}
+		}
+		movie.Ports[port] = device
+	}
+
+	// Devices plugged in with SetInputDevice are replaced by the ones the
+	// options describe, so the movie knows exactly what's there
+	emu.applyInputOptions()
+	err := emu.power()
+	if err != nil {
+		return err
+	}
+	emu.movieRecorder = &movieRecorder{movie: movie}
+	emu.addFrameSink(emu.movieRecorder)
+	return nil
+}
+
+// StopMovieRecording stops recording, and returns the movie.
+func (emu *Emulator) StopMovieRecording() (*Movie, error) {
+	if emu.movieRecorder == nil {
+		return nil, &gError{err_NOT_RECORDING_MOVIE}
+	}
+	rec := emu.movieRecorder
+	emu.removeFrameSink(rec)
+	emu.movieRecorder = nil
+	return rec.movie, nil
+}
+
+// PlayMovie power cycles the console, sets the options and input devices the
+// movie was recorded with, and starts playing the movie back, which drives the
+// input of every frame until the movie ends. The options in use before are
+// restored when playback stops. Movies recorded with a different ROM, or on a
+// console of a different region, are refused.
+func (emu *Emulator) PlayMovie(movie *Movie) error {
+	if emu.movieRecorder != nil || emu.moviePlayer != nil {
+		return &gError{err_MOVIE_IN_PROGRESS}
+	}
+	if movie.RomChecksum != emu.romChecksum {
+		return &gError{err_MOVIE_ROM_MISMATCH}
+	}
+	if movie.PAL != (emu.info.system == SYS_PAL) {
+		return &gError{err_MOVIE_REGION_MISMATCH}
+	}
+	if len(movie.Frames) == 0 {
+		return nil
+	}
+
+	player := &moviePlayer{movie: movie, options: emu.options}
+	emu.SetOptions(movie.movieOptions())
+	emu.applyInputOptions()
+	err := emu.power()
+	if err == nil {
+		err = player.startFrame(emu)
+	}
+	if err != nil {
+		emu.SetOptions(player.options)
+		return err
+	}
+	emu.moviePlayer = player
+	emu.addFrameSink(player)
+	return nil
+}
+
+// StopMovie stops playing back a movie, and restores the options in use before
+// it started. If they plug in different devices than the movie's, new devices
+// are plugged in, otherwise the input stays as the movie left it.
+func (emu *Emulator) StopMovie() error {
+	if emu.moviePlayer == nil {
+		return &gError{err_NOT_PLAYING_MOVIE}
+	}
+	player := emu.moviePlayer
+	emu.removeFrameSink(player)
+	emu.moviePlayer = nil
+	emu.SetOptions(player.options)
+	return nil
+}
+
+// IsPlayingMovie returns whether a movie is being played back.
+func (emu *Emulator) IsPlayingMovie() bool {
+	return emu.moviePlayer != nil
+}
+
+// IsRecordingMovie returns whether a movie is being recorded.
+func (emu *Emulator) IsRecordingMovie() bool {
+	return emu.movieRecorder != nil
+}
+
+// MovieFrame returns the frame of the movie being played back or recorded.
+func (emu *Emulator) MovieFrame() int {
+	if emu.moviePlayer != nil {
+		return emu.moviePlayer.frame
+	} else if emu.movieRecorder != nil {
+		return len(emu.movieRecorder.movie.Frames)
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package gnes
+
+import "testing"
+
+// testLoopEmulator loads an NROM cartridge that spins in a JMP loop, so it
+// can run whole frames
+func testLoopEmulator(t *testing.T) *Emulator {
+	rom := testNrom()
+	prg := rom[HEADER_SIZE : HEADER_SIZE+PRG_ROM_SIZE]
+	copy(prg, []byte{0x4C, 0x00, 0x80}) // JMP $8000
+	// The reset vector points at $8000
+	prg[PRG_ROM_SIZE-3] = 0x80
+	emu, err := NewEmulatorFromBytes(rom, "loop.nes", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return emu
+}
+
+func testMovie(emu *Emulator, frames int) *Movie {
+	return &Movie{
+		Frames:      make([]MovieFrame, frames),
+		Ports:       [2]DeviceType{DEVICE_STANDARD, DEVICE_STANDARD},
+		Options:     Options{NoSpriteLimit: true},
+		RomChecksum: emu.romChecksum,
+	}
+}
+
+func TestPlayMovieRefusesMismatch(t *testing.T) {
+	emu := testLoopEmulator(t)
+	movie := testMovie(emu, 1)
+	movie.PAL = true
+	if err := emu.PlayMovie(movie); err == nil {
+		t.Error("played a PAL movie on an NTSC console")
+	}
+	movie = testMovie(emu, 1)
+	movie.RomChecksum[0]++
+	if err := emu.PlayMovie(movie); err == nil {
+		t.Error("played a movie recorded with a different ROM")
+	}
+}
+
+func TestPlayMovieRestoresOptions(t *testing.T) {
+	emu := testLoopEmulator(t)
+	options := Options{ShowOverscan: true, Ports: [2]DeviceType{DEVICE_STANDARD, DEVICE_ZAPPER}}
+	emu.SetOptions(options)
+
+	// Played to the end
+	if err := emu.PlayMovie(testMovie(emu, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if got := emu.GetOptions(); got != testMovie(emu, 2).movieOptions() {
+		t.Errorf("playing with options %+v", got)
+	}
+	for emu.IsPlayingMovie() {
+		if err := emu.StepFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := emu.GetOptions(); got != options {
+		t.Errorf("options %+v after the movie ended, want %+v", got, options)
+	}
+	if _, err := emu.zapper(PORT_2); err != nil {
+		t.Error("the Zapper wasn't plugged back in")
+	}
+
+	// Stopped early
+	if err := emu.PlayMovie(testMovie(emu, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := emu.StopMovie(); err != nil {
+		t.Fatal(err)
+	}
+	if got := emu.GetOptions(); got != options {
+		t.Errorf("options %+v after the movie was stopped, want %+v", got, options)
+	}
+}
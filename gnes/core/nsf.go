@@ -0,0 +1,387 @@
+package gnes
+
+import "bytes"
+import "encoding/binary"
+import "strings"
+
+// NSF file layout
+const (
+	nsf_HEADER_SIZE = 0x80
+
+	nsf_VERSION_OFFSET     = 0x05
+	nsf_SONGS_OFFSET       = 0x06
+	nsf_START_SONG_OFFSET  = 0x07
+	nsf_LOAD_OFFSET        = 0x08
+	nsf_INIT_OFFSET        = 0x0A
+	nsf_PLAY_OFFSET        = 0x0C
+	nsf_TITLE_OFFSET       = 0x0E
+	nsf_ARTIST_OFFSET      = 0x2E
+	nsf_COPYRIGHT_OFFSET   = 0x4E
+	nsf_SPEED_NTSC_OFFSET  = 0x6E
+	nsf_BANKS_OFFSET       = 0x70
+	nsf_SPEED_PAL_OFFSET   = 0x78
+	nsf_REGION_OFFSET      = 0x7A
+	nsf_EXPANSION_OFFSET   = 0x7B
+	nsf_DATA_LENGTH_OFFSET = 0x7D
+	nsf_STRING_SIZE        = 32
+
+	nsf_REGION_PAL_MASK  uint8 = 0x01
+	nsf_REGION_DUAL_MASK uint8 = 0x02
+
+	// Play routine periods used when a file doesn't give one, in microseconds
+	nsf_DEFAULT_SPEED_NTSC = 16639
+	nsf_DEFAULT_SPEED_PAL  = 19997
+)
+
+// Expansion sound chips an NSF can ask for, as bits of NSFInfo.Expansion
+const (
+	NSF_EXP_VRC6 uint8 = 0x01
+	NSF_EXP_VRC7 uint8 = 0x02
+	NSF_EXP_FDS  uint8 = 0x04
+	NSF_EXP_MMC5 uint8 = 0x08
+	NSF_EXP_N163 uint8 = 0x10
+	NSF_EXP_S5B  uint8 = 0x20
+)
+
+var nsfExpansionNames = []struct {
+	chip uint8
+	name string
+}{
+	{NSF_EXP_VRC6, "VRC6"},
+	{NSF_EXP_VRC7, "VRC7"},
+	{NSF_EXP_FDS, "FDS"},
+	{NSF_EXP_MMC5, "MMC5"},
+	{NSF_EXP_N163, "N163"},
+	{NSF_EXP_S5B, "5B"},
+}
+
+// expansionNames lists the chips in a mask of NSF_EXP_ bits, e.g. "VRC6, 5B"
+func expansionNames(expansion uint8) string {
+	var names []string
+	for _, exp := range nsfExpansionNames {
+		if (expansion & exp.chip) != 0 {
+			names = append(names, exp.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+var nsfMagic = []byte{'N', 'E', 'S', 'M', 0x1A}
+var nsfeMagic = []byte{'N', 'S', 'F', 'E'}
+
+// NSFInfo describes a loaded NSF or NSFe file.
+type NSFInfo struct {
+	Title,
+	Artist,
+	Copyright,
+	Ripper string
+
+	// Songs is the number of tracks, and StartSong is the one to play first,
+	// counting from 1
+	Songs,
+	StartSong int
+
+	LoadAddr,
+	InitAddr,
+	PlayAddr uint16
+
+	// Banks are the initial values of the bank registers. If they're all 0, the
+	// file doesn't use bankswitching.
+	Banks [8]uint8
+
+	// System is SYS_NTSC, SYS_PAL or SYS_NTSC_PAL
+	System uint32
+
+	// Expansion is a mask of NSF_EXP_ bits
+	Expansion uint8
+
+	// Periods of the play routine for each region, in microseconds
+	PlaySpeedNTSC,
+	PlaySpeedPAL uint16
+
+	// Track names and lengths in milliseconds, from NSFe files. Lengths are -1
+	// where they aren't known.
+	TrackNames   []string
+	TrackLengths []int
+
+	data []byte
+}
+
+func isNsf(file []byte) bool {
+	return bytes.HasPrefix(file, nsfMagic) || bytes.HasPrefix(file, nsfeMagic)
+}
+
+// parseNsf parses an NSF or NSFe file
+func parseNsf(file []byte) (*NSFInfo, error) {
+	if bytes.HasPrefix(file, nsfeMagic) {
+		return parseNsfe(file)
+	}
+	if len(file) < nsf_HEADER_SIZE {
+		return nil, &gError{err_BAD_NSF_FILE}
+	}
+
+	info := &NSFInfo{}
+	info.Songs = int(file[nsf_SONGS_OFFSET])
+	info.StartSong = int(file[nsf_START_SONG_OFFSET])
+	info.LoadAddr = binary.LittleEndian.Uint16(file[nsf_LOAD_OFFSET:])
+	info.InitAddr = binary.LittleEndian.Uint16(file[nsf_INIT_OFFSET:])
+	info.PlayAddr = binary.LittleEndian.Uint16(file[nsf_PLAY_OFFSET:])
+	info.Title = nsfString(file[nsf_TITLE_OFFSET : nsf_TITLE_OFFSET+nsf_STRING_SIZE])
+	info.Artist = nsfString(file[nsf_ARTIST_OFFSET : nsf_ARTIST_OFFSET+nsf_STRING_SIZE])
+	info.Copyright = nsfString(file[nsf_COPYRIGHT_OFFSET : nsf_COPYRIGHT_OFFSET+nsf_STRING_SIZE])
+	info.PlaySpeedNTSC = binary.LittleEndian.Uint16(file[nsf_SPEED_NTSC_OFFSET:])
+	info.PlaySpeedPAL = binary.LittleEndian.Uint16(file[nsf_SPEED_PAL_OFFSET:])
+	copy(info.Banks[:], file[nsf_BANKS_OFFSET:])
+	info.System = nsfSystem(file[nsf_REGION_OFFSET])
+	info.Expansion = file[nsf_EXPANSION_OFFSET]
+
+	// NSF2 files can have metadata after the program data, in which case its
+	// length is given. The metadata is skipped.
+	info.data = file[nsf_HEADER_SIZE:]
+	if file[nsf_VERSION_OFFSET] >= 2 {
+		length := uint32(file[nsf_DATA_LENGTH_OFFSET]) | uint32(file[nsf_DATA_LENGTH_OFFSET+1])<<8 |
+			uint32(file[nsf_DATA_LENGTH_OFFSET+2])<<16
+		if length != 0 && int(length) <= len(info.data) {
+			info.data = info.data[:length]
+		}
+	}
+	return info, info.validate()
+}
+
+// parseNsfe parses an NSFe file, which is a list of chunks. Chunks with an
+// uppercase ID are required to play the file, so unknown ones are errors.
+func parseNsfe(file []byte) (*NSFInfo, error) {
+	info := &NSFInfo{}
+	info.Songs = 1
+	info.StartSong = 1
+	haveInfo := false
+	haveData := false
+
+	pos := len(nsfeMagic)
+	for {
+		if pos+8 > len(file) {
+			return nil, &gError{err_BAD_NSF_FILE}
+		}
+		length := int(binary.LittleEndian.Uint32(file[pos:]))
+		id := string(file[pos+4 : pos+8])
+		pos += 8
+		if pos+length > len(file) {
+			return nil, &gError{err_BAD_NSF_FILE}
+		}
+		chunk := file[pos : pos+length]
+		pos += length
+
+		switch id {
+		case "INFO":
+			if len(chunk) < 8 {
+				return nil, &gError{err_BAD_NSF_FILE}
+			}
+			info.LoadAddr = binary.LittleEndian.Uint16(chunk[0:])
+			info.InitAddr = binary.LittleEndian.Uint16(chunk[2:])
+			info.PlayAddr = binary.LittleEndian.Uint16(chunk[4:])
+			info.System = nsfSystem(chunk[6])
+			info.Expansion = chunk[7]
+			if len(chunk) >= 9 {
+				info.Songs = int(chunk[8])
+			}
+			if len(chunk) >= 10 {
+				// NSFe counts tracks from 0
+				info.StartSong = int(chunk[9]) + 1
+			}
+			haveInfo = true
+		case "DATA":
+			info.data = chunk
+			haveData = true
+		case "BANK":
+			copy(info.Banks[:], chunk)
+		case "RATE":
+			if len(chunk) >= 2 {
+				info.PlaySpeedNTSC = binary.LittleEndian.Uint16(chunk[0:])
+			}
+			if len(chunk) >= 4 {
+				info.PlaySpeedPAL = binary.LittleEndian.Uint16(chunk[2:])
+			}
+		case "auth":
+			fields := nsfStrings(chunk)
+			for i, field := range []*string{&info.Title, &info.Artist, &info.Copyright, &info.Ripper} {
+				if i < len(fields) {
+					*field = fields[i]
+				}
+			}
+		case "tlbl":
+			info.TrackNames = nsfStrings(chunk)
+		case "time":
+			for i := 0; i+4 <= len(chunk); i += 4 {
+				info.TrackLengths = append(info.TrackLengths, int(int32(binary.LittleEndian.Uint32(chunk[i:]))))
+			}
+		case "NEND":
+			if !haveInfo || !haveData {
+				return nil, &gError{err_BAD_NSF_FILE}
+			}
+			return info, info.validate()
+		default:
+			if id[0] >= 'A' && id[0] <= 'Z' {
+				return nil, &gError{err_BAD_NSF_FILE}
+			}
+		}
+	}
+}
+
+// validate checks the fields that playback depends on, and fills in defaults
+func (info *NSFInfo) validate() error {
+	if info.Songs == 0 || info.LoadAddr < 0x8000 || info.InitAddr < 0x8000 || info.PlayAddr < 0x8000 {
+		return &gError{err_BAD_NSF_FILE}
+	}
+	if info.StartSong < 1 || info.StartSong > info.Songs {
+		info.StartSong = 1
+	}
+	if info.PlaySpeedNTSC == 0 {
+		info.PlaySpeedNTSC = nsf_DEFAULT_SPEED_NTSC
+	}
+	if info.PlaySpeedPAL == 0 {
+		info.PlaySpeedPAL = nsf_DEFAULT_SPEED_PAL
+	}
+	for len(info.TrackLengths) < info.Songs {
+		info.TrackLengths = append(info.TrackLengths, -1)
+	}
+	// The FDS needs RAM where the program normally is, which isn't modelled
+	if (info.Expansion & NSF_EXP_FDS) != 0 {
+		return gError1New(err_NSF_EXPANSION_UNSUPPORTED, uint64(info.Expansion))
+	}
+	return nil
+}
+
+// nsfSystem converts the region byte of an NSF into a system type
+func nsfSystem(region uint8) uint32 {
+	if (region & nsf_REGION_DUAL_MASK) != 0 {
+		return SYS_NTSC_PAL
+	} else if (region & nsf_REGION_PAL_MASK) != 0 {
+		return SYS_PAL
+	}
+	return SYS_NTSC
+}
+
+// nsfString returns the null terminated string in a fixed size field
+func nsfString(field []byte) string {
+	if i := bytes.IndexByte(field, 0); i >= 0 {
+		field = field[:i]
+	}
+	return string(field)
+}
+
+// nsfStrings splits a list of null terminated strings
+func nsfStrings(chunk []byte) []string {
+	var strs []string
+	for len(chunk) > 0 {
+		i := bytes.IndexByte(chunk, 0)
+		if i < 0 {
+			strs = append(strs, string(chunk))
+			break
+		}
+		strs = append(strs, string(chunk[:i]))
+		chunk = chunk[i+1:]
+	}
+	return strs
+}
+
+/***********************************************/
+/*                 NSF mapper                  */
+/***********************************************/
+
+const (
+	size_NSF_BANK        = 0x1000
+	addr_NSF_BANK_REGS   = 0x5FF8
+	num_NSF_BANK_REGS    = 8
+	num_NSF_NOBANK_BANKS = 8
+)
+
+// mapper_NSF maps an NSF's program data into $8000-$FFFF in 4K banks, which
+// are switched by writing $5FF8-$5FFF. Files that don't use bankswitching are
+// loaded directly at their load address. There's 8K of RAM at $6000-$7FFF.
+type mapper_NSF struct {
+	prg    []byte
+	prgRam []byte
+	banks  [num_NSF_BANK_REGS]uint8
+
+	numBanks uint32
+	// zero is returned for the write-only registers below $6000
+	zero uint8
+}
+
+func newMapper_NSF(info *NSFInfo) *mapper_NSF {
+	mapper := &mapper_NSF{}
+	mapper.prgRam = make([]byte, size_PRG_RAM)
+
+	var padding int
+	if info.bankswitched() {
+		// The data starts at the load address's offset into its bank
+		padding = int(info.LoadAddr % size_NSF_BANK)
+	} else {
+		padding = int(info.LoadAddr - addr_PRG_ROM1)
+	}
+	size := padding + len(info.data)
+	if size%size_NSF_BANK != 0 {
+		size += size_NSF_BANK - size%size_NSF_BANK
+	}
+	if !info.bankswitched() && size < num_NSF_NOBANK_BANKS*size_NSF_BANK {
+		size = num_NSF_NOBANK_BANKS * size_NSF_BANK
+	}
+	mapper.prg = make([]byte, size)
+	copy(mapper.prg[padding:], info.data)
+	mapper.numBanks = uint32(size / size_NSF_BANK)
+	mapper.resetBanks(info)
+	return mapper
+}
+
+func (info *NSFInfo) bankswitched() bool {
+	return info.Banks != [8]uint8{}
+}
+
+// resetBanks puts the banks back to how the file says they start
+func (mmu *mapper_NSF) resetBanks(info *NSFInfo) {
+	for i := range mmu.banks {
+		if info.bankswitched() {
+			mmu.banks[i] = info.Banks[i]
+		} else {
+			mmu.banks[i] = uint8(i)
+		}
+	}
+}
+
+func (mmu *mapper_NSF) write(val uint8, addr uint16) error {
+	if addr >= addr_NSF_BANK_REGS && addr < addr_PRG_RAM {
+		mmu.banks[addr-addr_NSF_BANK_REGS] = val
+	} else if addr >= addr_PRG_RAM && addr < addr_PRG_ROM1 {
+		mmu.prgRam[addr-addr_PRG_RAM] = val
+	}
+	return nil
+}
+
+func (mmu *mapper_NSF) read(addr uint16) (uint8, error) {
+	ptr, err := mmu.getAddrPointer(addr)
+	if err != nil {
+		return 0, err
+	}
+	return *ptr, nil
+}
+
+func (mmu *mapper_NSF) getAddrPointer(addr uint16) (*uint8, error) {
+	if addr >= addr_PRG_ROM1 {
+		offset := uint32(addr - addr_PRG_ROM1)
+		bank := uint32(mmu.banks[offset/size_NSF_BANK]) % mmu.numBanks
+		return &mmu.prg[bank*size_NSF_BANK+offset%size_NSF_BANK], nil
+	} else if addr >= addr_PRG_RAM {
+		return &mmu.prgRam[addr-addr_PRG_RAM], nil
+	}
+	mmu.zero = 0
+	return &mmu.zero, nil
+}
+
+// There's no PPU in an NSF player, so there's nothing on its bus
+func (mmu *mapper_NSF) readChr(addr uint16) (uint8, error) {
+	return 0, nil
+}
+
+func (mmu *mapper_NSF) writeChr(val uint8, addr uint16) error {
+	return nil
+}
@@ -0,0 +1,216 @@
+package gnes
+
+import "math"
+
+const (
+	// The init and play routines are called as if from a JSR just before this
+	// address, and the player knows they've returned once the PC reaches it.
+	// Nothing is ever executed there.
+	nsf_RETURN_ADDR = 0x4100
+
+	nsf_MICROSECONDS = 1000000
+)
+
+// nsfPlayer plays an NSF without a PPU. It calls the file's init routine to
+// start a track, and then its play routine on a timer. Each call to the play
+// routine counts as a frame.
+type nsfPlayer struct {
+	info   *NSFInfo
+	mapper *mapper_NSF
+
+	track int
+
+	// calling is set while the init or play routine is running
+	calling bool
+
+	// period is the time between calls to the play routine, and playTimer is
+	// the time until the next one, both in CPU cycles
+	period,
+	playTimer float64
+
+	frames uint64
+}
+
+func newNsfPlayer(info *NSFInfo, mapper *mapper_NSF, system uint32) *nsfPlayer {
+	player := &nsfPlayer{}
+	player.info = info
+	player.mapper = mapper
+	if system == SYS_PAL {
+		player.period = float64(info.PlaySpeedPAL) * CPU_CLOCK_PAL / nsf_MICROSECONDS
+	} else {
+		player.period = float64(info.PlaySpeedNTSC) * CPU_CLOCK_NTSC / nsf_MICROSECONDS
+	}
+	return player
+}
+
+// loadNsf loads an NSF or NSFe file, and starts its first track
+func (emu *Emulator) loadNsf(file []byte) error {
+	info, err := parseNsf(file)
+	if err != nil {
+		return err
+	}
+	// Dual region files are played as NTSC
+	emu.info.system = SYS_NTSC
+	if info.System == SYS_PAL {
+		emu.info.system = SYS_PAL
+	}
+
+	// The PPU is never clocked, but it still answers register accesses
+	ppu, err := newPpu()
+	if err != nil {
+		return err
+	}
+	emu.ppu = ppu
+	apu, err := newApu(emu.info.system)
+	if err != nil {
+		return err
+	}
+	emu.apu = apu
+	mapper := newMapper_NSF(info)
+	emu.mmu = newMmuWithMapper(mapper, ppu, apu)
+	cpu, err := newCpu(emu.mmu)
+	if err != nil {
+		return err
+	}
+	emu.cpu = cpu
+
+	emu.nsf = newNsfPlayer(info, mapper, emu.info.system)
+	return emu.PlayTrack(info.StartSong)
+}
+
+// call starts a routine as if it were called with JSR
+func (player *nsfPlayer) call(cpu *cpu, addr uint16) error {
+	err := cpu.push16(nsf_RETURN_ADDR - 1)
+	if err != nil {
+		return err
+	}
+	cpu.setPC(addr)
+	player.calling = true
+	return nil
+}
+
+// step runs one instruction of the current routine, or if none is running,
+// waits for the next call to the play routine and makes it.
+func (player *nsfPlayer) step(emu *Emulator) error {
+	if player.calling {
+		cycles, err := emu.cpu.stepInstruction()
+		if err != nil {
+			return err
+		}
+		err = emu.apu.step(cycles)
+		if err != nil {
+			return err
+		}
+		emu.mmu.endInstruction()
+		player.playTimer -= float64(cycles)
+		if emu.cpu.getPC() == nsf_RETURN_ADDR {
+			player.calling = false
+		}
+		return nil
+	}
+
+	if player.playTimer > 0 {
+		cycles := uint64(math.Ceil(player.playTimer))
+		emu.cpu.cycles += cycles
+		player.playTimer -= float64(cycles)
+		return emu.apu.step(cycles)
+	}
+
+	// If the play routine overran its period, the next call is late, but the
+	// timer keeps its phase
+	player.playTimer += player.period
+	err := player.call(emu.cpu, player.info.PlayAddr)
+	if err != nil {
+		return err
+	}
+	player.frames++
+	return emu.notifyFrameSinks()
+}
+
+/***********************************************/
+/*                   NSF API                   */
+/***********************************************/
+
+// IsNSF returns whether the emulator is playing an NSF or NSFe file rather
+// than running a cartridge.
+func (emu *Emulator) IsNSF() bool {
+	return emu.nsf != nil
+}
+
+// NSFInfo returns the header information of the loaded NSF or NSFe file.
+func (emu *Emulator) NSFInfo() (*NSFInfo, error) {
+	if emu.nsf == nil {
+		return nil, &gError{err_NOT_NSF}
+	}
+	return emu.nsf.info, nil
+}
+
+// PlayTrack starts playing a track of the loaded NSF, counting from 1. Memory
+// and the APU are initialized the way the NSF specification requires, and the
+// track's init routine is called.
+//
+// Expansion sound chips aren't emulated, so tracks that use them are missing
+// those channels, which LoadReport warns about.
+func (emu *Emulator) PlayTrack(track int) error {
+	player := emu.nsf
+	if player == nil {
+		return &gError{err_NOT_NSF}
+	}
+	if track < 1 || track > player.info.Songs {
+		return gError1New(err_INVALID_TRACK, uint64(track))
+	}
+	player.track = track
+
+	for i := range emu.mmu.ram {
+		emu.mmu.ram[i] = 0
+	}
+	for i := range player.mapper.prgRam {
+		player.mapper.prgRam[i] = 0
+	}
+	player.mapper.resetBanks(player.info)
+
+	err := emu.apu.reset()
+	if err != nil {
+		return err
+	}
+	for addr := uint16(SQ1_VOL_ADDR); addr <= 0x4013; addr++ {
+		err = emu.mmu.write(0x00, addr)
+		if err != nil {
+			return err
+		}
+	}
+	writes := []struct {
+		val  uint8
+		addr uint16
+	}{
+		{0x00, SND_CHN_ADDR},
+		{0x0F, SND_CHN_ADDR},
+		{0x40, FRAME_CNT_ADDR},
+	}
+	for _, w := range writes {
+		err = emu.mmu.write(w.val, w.addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	regs := emu.cpu.regs
+	*regs = registers{}
+	regs.a = uint8(track - 1)
+	if emu.info.system == SYS_PAL {
+		regs.x = 1
+	}
+	regs.sp = 0xFD
+	regs.i = true
+
+	player.playTimer = player.period
+	return player.call(emu.cpu, player.info.InitAddr)
+}
+
+// Track returns the track of the loaded NSF being played, counting from 1.
+func (emu *Emulator) Track() int {
+	if emu.nsf == nil {
+		return 0
+	}
+	return emu.nsf.track
+}
@@ -0,0 +1,102 @@
+package gnes
+
+import "testing"
+
+// testNsf builds an NSF whose init routine stores the track index at $11 and
+// enables the channels, and whose play routine marks $10. The CPU doesn't
+// implement INC zp,X yet, so the play routine can't count its calls.
+func testNsf(expansion uint8) []byte {
+	file := make([]byte, nsf_HEADER_SIZE+0x20)
+	copy(file, nsfMagic)
+	file[nsf_VERSION_OFFSET] = 1
+	file[nsf_SONGS_OFFSET] = 3
+	file[nsf_START_SONG_OFFSET] = 2
+	file[nsf_LOAD_OFFSET+1] = 0x80
+	file[nsf_INIT_OFFSET+1] = 0x80
+	file[nsf_PLAY_OFFSET] = 0x10
+	file[nsf_PLAY_OFFSET+1] = 0x80
+	copy(file[nsf_TITLE_OFFSET:], "Test Tune")
+	copy(file[nsf_ARTIST_OFFSET:], "Someone")
+	file[nsf_SPEED_NTSC_OFFSET] = 0xFF // 16639
+	file[nsf_SPEED_NTSC_OFFSET+1] = 0x40
+	file[nsf_EXPANSION_OFFSET] = expansion
+
+	code := file[nsf_HEADER_SIZE:]
+	// init: STA $11; LDA #$0F; STA $4015; RTS
+	copy(code, []byte{0x85, 0x11, 0xA9, 0x0F, 0x8D, 0x15, 0x40, 0x60})
+	// play: LDA #$2A; STA $10; RTS
+	copy(code[0x10:], []byte{0xA9, 0x2A, 0x85, 0x10, 0x60})
+	return file
+}
+
+func TestParseNsf(t *testing.T) {
+	info, err := parseNsf(testNsf(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "Test Tune" || info.Artist != "Someone" || info.Songs != 3 || info.StartSong != 2 {
+		t.Errorf("parsed %+v", info)
+	}
+	if info.LoadAddr != 0x8000 || info.InitAddr != 0x8000 || info.PlayAddr != 0x8010 || info.PlaySpeedNTSC != 16639 {
+		t.Errorf("parsed %+v", info)
+	}
+
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"truncated", testNsf(0)[:nsf_HEADER_SIZE-1]},
+		{"FDS", testNsf(NSF_EXP_FDS)},
+	}
+	for _, test := range tests {
+		if _, err := parseNsf(test.file); err == nil {
+			t.Errorf("%s: parsed without an error", test.name)
+		}
+	}
+}
+
+func TestNsfPlayback(t *testing.T) {
+	emu, err := NewEmulatorFromBytes(testNsf(0), "test.nsf", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emu.LoadReport().Problems) != 0 {
+		t.Errorf("problems reported: %v", emu.LoadReport().Problems)
+	}
+	if emu.Track() != 2 {
+		t.Errorf("started on track %d, want 2", emu.Track())
+	}
+	if err := emu.PlayTrack(3); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := emu.StepFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	track, _ := emu.ReadAddr(0x11)
+	mark, _ := emu.ReadAddr(0x10)
+	if track != 2 {
+		t.Errorf("init routine got track index %d, want 2", track)
+	}
+	if mark != 0x2A {
+		t.Errorf("play routine wasn't called, $10 = %#x", mark)
+	}
+	if emu.GetFrameNumber() != 10 {
+		t.Errorf("played %d frames, want 10", emu.GetFrameNumber())
+	}
+	if err := emu.PlayTrack(4); err == nil {
+		t.Error("played a track past the last")
+	}
+}
+
+func TestNsfExpansionWarning(t *testing.T) {
+	emu, err := NewEmulatorFromBytes(testNsf(NSF_EXP_VRC6|NSF_EXP_S5B), "test.nsf", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := emu.LoadReport().Problems
+	if len(problems) != 1 || problems[0].Kind != PROBLEM_NSF_EXPANSION || problems[0].Severity != SEVERITY_WARNING {
+		t.Fatalf("problems %v, want one expansion warning", problems)
+	}
+}
@@ -0,0 +1,233 @@
+package gnes
+
+import "image"
+import "math"
+
+// NTSC signal constants. Voltage levels are relative to sync, as measured from a 2C02.
+const (
+	ntsc_BLACK             = 0.518
+	ntsc_WHITE             = 1.962
+	ntsc_ATTENUATION       = 0.746
+	ntsc_SAMPLES_PER_PIXEL = 8
+	ntsc_SAMPLES_PER_CYCLE = 12 // samples per colour subcarrier cycle
+	ntsc_LINE_SAMPLES      = SCREEN_WIDTH * ntsc_SAMPLES_PER_PIXEL
+	ntsc_GAMMA             = 2.2 / 1.8
+	ntsc_HUE_OFFSET        = 3.9 // demodulation phase, in samples, relative to the PPU's colour phases
+)
+
+// NTSC_DEFAULT_WIDTH is the width of the decoded image, which keeps the
+// pixel aspect ratio of a CRT for 240 lines of output.
+const NTSC_DEFAULT_WIDTH = 602
+
+var ntscLevels = [8]float64{
+	0.350, 0.518, 0.962, 1.550, // signal low
+	1.094, 1.506, 1.962, 1.962, // signal high
+}
+
+// NTSCOptions configures how the composite signal is decoded.
+type NTSCOptions struct {
+	// Sharpness ranges from -1 (soft) to 1 (sharp), and controls the width of the
+	// luma filter.
+	Sharpness float64
+	// Fringing ranges from 0 to 1, and controls how much of the chroma signal
+	// leaks into luma, producing coloured fringes and dot crawl on edges.
+	Fringing float64
+	// Artifacting ranges from 0 to 1, and controls how much of the luma signal
+	// is decoded as colour, producing rainbow artifacts on fine detail.
+	Artifacting float64
+	// Saturation scales the decoded colour, where 1 is unchanged.
+	Saturation float64
+	// Width of the output image. Defaults to NTSC_DEFAULT_WIDTH.
+	Width int
+}
+
+// Decoding presets, roughly matching the different video cables
+var (
+	NTSC_PRESET_COMPOSITE  = NTSCOptions{Sharpness: 0, Fringing: 1, Artifacting: 1, Saturation: 1}
+	NTSC_PRESET_SVIDEO     = NTSCOptions{Sharpness: 0.2, Fringing: 0, Artifacting: 0.2, Saturation: 1}
+	NTSC_PRESET_RGB        = NTSCOptions{Sharpness: 0.6, Fringing: 0, Artifacting: 0, Saturation: 1}
+	NTSC_PRESET_MONOCHROME = NTSCOptions{Sharpness: 0.2, Fringing: 0, Artifacting: 0, Saturation: 0}
+)
+
+// NTSCFilter synthesizes the composite signal the PPU would generate for a frame
+// and decodes it again, the way a TV would.
+type NTSCFilter struct {
+	options NTSCOptions
+
+	lumaWidth int
+
+	// Signal generated for every pixel at every subcarrier phase, and the part of
+	// it which is chroma
+	signal,
+	chroma [512][ntsc_SAMPLES_PER_CYCLE]float64
+
+	// YIQ values of a solid area of every pixel, i.e. without any artifacts
+	cleanY,
+	cleanI,
+	cleanQ [512]float64
+
+	cos,
+	sin [ntsc_SAMPLES_PER_CYCLE]float64
+
+	// Per-line scratch buffers
+	luma,
+	lumaSum,
+	iSum,
+	qSum,
+	cleanISum,
+	cleanQSum []float64
+}
+
+func NewNTSCFilter(options NTSCOptions) *NTSCFilter {
+	filter := &NTSCFilter{}
+	if options.Width <= 0 {
+		options.Width = NTSC_DEFAULT_WIDTH
+	}
+	filter.options = options
+
+	filter.lumaWidth = int(ntsc_SAMPLES_PER_CYCLE - 6*options.Sharpness + 0.5)
+	if filter.lumaWidth < 4 {
+		filter.lumaWidth = 4
+	} else if filter.lumaWidth > 2*ntsc_SAMPLES_PER_CYCLE {
+		filter.lumaWidth = 2 * ntsc_SAMPLES_PER_CYCLE
+	}
+
+	for p := 0; p < ntsc_SAMPLES_PER_CYCLE; p++ {
+		filter.cos[p] = math.Cos(math.Pi * (float64(p) + ntsc_HUE_OFFSET) / 6)
+		filter.sin[p] = math.Sin(math.Pi * (float64(p) + ntsc_HUE_OFFSET) / 6)
+	}
+
+	for pixel := 0; pixel < 512; pixel++ {
+		var y, i, q float64
+		for p := 0; p < ntsc_SAMPLES_PER_CYCLE; p++ {
+			level := ntscSignal(uint16(pixel), p)
+			filter.signal[pixel][p] = level
+			y += level / ntsc_SAMPLES_PER_CYCLE
+			i += level * filter.cos[p] / ntsc_SAMPLES_PER_CYCLE
+			q += level * filter.sin[p] / ntsc_SAMPLES_PER_CYCLE
+		}
+		filter.cleanY[pixel] = y
+		filter.cleanI[pixel] = i
+		filter.cleanQ[pixel] = q
+		for p := 0; p < ntsc_SAMPLES_PER_CYCLE; p++ {
+			filter.chroma[pixel][p] = filter.signal[pixel][p] - y
+		}
+	}
+
+	filter.luma = make([]float64, ntsc_LINE_SAMPLES)
+	filter.lumaSum = make([]float64, ntsc_LINE_SAMPLES+1)
+	filter.iSum = make([]float64, ntsc_LINE_SAMPLES+1)
+	filter.qSum = make([]float64, ntsc_LINE_SAMPLES+1)
+	filter.cleanISum = make([]float64, ntsc_LINE_SAMPLES+1)
+	filter.cleanQSum = make([]float64, ntsc_LINE_SAMPLES+1)
+	return filter
+}
+
+// ntscSignal returns the normalized signal level the PPU outputs for a pixel at
+// the given subcarrier phase.
+func ntscSignal(pixel uint16, phase int) float64 {
+	colour := int(pixel & 0x0F)
+	level := int(pixel>>4) & 0x3
+	emphasis := int(pixel >> 6)
+
+	// Colours $xE and $xF are always black
+	if colour > 13 {
+		level = 1
+	}
+
+	inColourPhase := func(colour int) bool {
+		return (colour+phase)%ntsc_SAMPLES_PER_CYCLE < 6
+	}
+
+	high := colour == 0 || (colour <= 12 && inColourPhase(colour))
+	signal := ntscLevels[level]
+	if high {
+		signal = ntscLevels[level+4]
+	}
+
+	if ((emphasis&0x1) != 0 && inColourPhase(0)) ||
+		((emphasis&0x2) != 0 && inColourPhase(4)) ||
+		((emphasis&0x4) != 0 && inColourPhase(8)) {
+		signal *= ntsc_ATTENUATION
+	}
+
+	return (signal - ntsc_BLACK) / (ntsc_WHITE - ntsc_BLACK)
+}
+
+func (filter *NTSCFilter) Filter(pixels []uint16, frame uint64) *image.RGBA {
+	height := len(pixels) / SCREEN_WIDTH
+	width := filter.options.Width
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		// Every line is 341 dots of 8 samples, which moves the subcarrier phase on by
+		// 4 samples per line. Frames alternate between two phases, since odd frames
+		// are a dot shorter while rendering.
+		phase := (int(frame%2)*4 + y*4) % ntsc_SAMPLES_PER_CYCLE
+		filter.filterLine(pixels[y*SCREEN_WIDTH:(y+1)*SCREEN_WIDTH], phase, img.Pix[y*img.Stride:])
+	}
+	return img
+}
+
+// filterLine encodes a single line of pixels and decodes it into out.
+func (filter *NTSCFilter) filterLine(line []uint16, phase int, out []uint8) {
+	options := &filter.options
+
+	for s := 0; s < ntsc_LINE_SAMPLES; s++ {
+		pixel := line[s/ntsc_SAMPLES_PER_PIXEL] & 0x1FF
+		p := (phase + s) % ntsc_SAMPLES_PER_CYCLE
+		signal := filter.signal[pixel][p]
+
+		filter.luma[s] = signal - (1-options.Fringing)*filter.chroma[pixel][p]
+		filter.lumaSum[s+1] = filter.lumaSum[s] + filter.luma[s]
+		filter.iSum[s+1] = filter.iSum[s] + signal*filter.cos[p]
+		filter.qSum[s+1] = filter.qSum[s] + signal*filter.sin[p]
+		filter.cleanISum[s+1] = filter.cleanISum[s] + filter.cleanI[pixel]
+		filter.cleanQSum[s+1] = filter.cleanQSum[s] + filter.cleanQ[pixel]
+	}
+
+	width := options.Width
+	for x := 0; x < width; x++ {
+		centre := (2*x + 1) * ntsc_LINE_SAMPLES / (2 * width)
+
+		start, end := clampWindow(centre-filter.lumaWidth/2, centre+(filter.lumaWidth+1)/2)
+		y := (filter.lumaSum[end] - filter.lumaSum[start]) / float64(end-start)
+
+		start, end = clampWindow(centre-ntsc_SAMPLES_PER_CYCLE/2, centre+ntsc_SAMPLES_PER_CYCLE/2)
+		n := float64(end - start)
+		rawI := (filter.iSum[end] - filter.iSum[start]) / ntsc_SAMPLES_PER_CYCLE
+		rawQ := (filter.qSum[end] - filter.qSum[start]) / ntsc_SAMPLES_PER_CYCLE
+		cleanI := (filter.cleanISum[end] - filter.cleanISum[start]) / n
+		cleanQ := (filter.cleanQSum[end] - filter.cleanQSum[start]) / n
+
+		i := (cleanI + options.Artifacting*(rawI-cleanI)) * options.Saturation
+		q := (cleanQ + options.Artifacting*(rawQ-cleanQ)) * options.Saturation
+
+		out[x*4] = ntscChannel(y + 0.946882*i + 0.623557*q)
+		out[x*4+1] = ntscChannel(y - 0.274788*i - 0.635691*q)
+		out[x*4+2] = ntscChannel(y - 1.108545*i + 1.709007*q)
+		out[x*4+3] = 0xFF
+	}
+}
+
+func clampWindow(start, end int) (int, int) {
+	if start < 0 {
+		start = 0
+	}
+	if end > ntsc_LINE_SAMPLES {
+		end = ntsc_LINE_SAMPLES
+	}
+	return start, end
+}
+
+// ntscChannel gamma corrects a decoded colour channel and converts it to 8 bits.
+func ntscChannel(val float64) uint8 {
+	if val <= 0 {
+		return 0
+	}
+	val = 255.95 * math.Pow(val, ntsc_GAMMA)
+	if val > 255 {
+		return 255
+	}
+	return uint8(val)
+}
@@ -0,0 +1,43 @@
+package gnes
+
+// Options holds enhancements that make the picture look better at the cost of
+// accuracy, and the input devices plugged into the console. The zero value is
+// accurate emulation with a standard controller in each port, and every
+// enhancement is off by default.
+type Options struct {
+	// NoSpriteLimit draws every sprite on a scanline, instead of only the first
+	// 8, which removes sprite flicker. The sprite overflow flag still behaves
+	// as if the limit were there.
+	NoSpriteLimit bool
+
+	// ShowOverscan shows the whole picture, ignoring SetOverscan.
+	ShowOverscan bool
+
+	// NoLeftClip draws the leftmost 8 pixels even when PPUMASK hides them.
+	// Sprite 0 hits still honour PPUMASK.
+	NoLeftClip bool
+
+	// Ports selects the device in each controller port. It's ignored while an
+	// adapter is plugged in.
+	Ports [2]DeviceType
+
+	// Adapter plugs in a four player adapter, with a standard controller in
+	// each of PORT_1 to PORT_4.
+	Adapter Adapter
+}
+
+// SetOptions sets the options. If the input devices change, new devices are
+// plugged in, replacing any set with SetInputDevice.
+func (emu *Emulator) SetOptions(options Options) {
+	inputChanged := options.Ports != emu.options.Ports || options.Adapter != emu.options.Adapter
+	emu.options = options
+	emu.ppu.options = options
+	if inputChanged {
+		emu.applyInputOptions()
+	}
+}
+
+// GetOptions returns the current options.
+func (emu *Emulator) GetOptions() Options {
+	return emu.options
+}
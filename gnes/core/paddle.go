@@ -0,0 +1,72 @@
+package gnes
+
+const (
+	// Bits the paddle drives when its port is read
+	PADDLE_BUTTON_MASK uint8 = 0x08
+	PADDLE_DATA_MASK   uint8 = 0x10
+
+	// The range of positions the Vaus controller's potentiometer reports
+	PADDLE_MIN = 98
+	PADDLE_MAX = 242
+)
+
+// Paddle is the Vaus controller that comes with Arkanoid. Strobing it latches
+// the potentiometer's position, which is then read one bit per read on D4,
+// most significant bit first and inverted. The button is on D3.
+type Paddle struct {
+	position uint8
+	button   bool
+
+	shift  uint8
+	strobe bool
+}
+
+// NewPaddle creates a paddle turned to the middle of its range.
+func NewPaddle() *Paddle {
+	return &Paddle{position: (PADDLE_MIN + PADDLE_MAX) / 2}
+}
+
+// SetPosition turns the knob. Positions outside PADDLE_MIN to PADDLE_MAX are
+// clamped to the range.
+func (paddle *Paddle) SetPosition(position int) {
+	if position < PADDLE_MIN {
+		position = PADDLE_MIN
+	} else if position > PADDLE_MAX {
+		position = PADDLE_MAX
+	}
+	paddle.position = uint8(position)
+}
+
+// Position returns the position of the knob.
+func (paddle *Paddle) Position() int {
+	return int(paddle.position)
+}
+
+// SetButton presses or releases the button.
+func (paddle *Paddle) SetButton(pressed bool) {
+	paddle.button = pressed
+}
+
+func (paddle *Paddle) Strobe(high bool) {
+	paddle.strobe = high
+	if high {
+		paddle.shift = ^paddle.position
+	}
+}
+
+func (paddle *Paddle) Read() uint8 {
+	if paddle.strobe {
+		paddle.shift = ^paddle.position
+	}
+	var val uint8
+	if (paddle.shift & 0x80) != 0 {
+		val |= PADDLE_DATA_MASK
+	}
+	if !paddle.strobe {
+		paddle.shift <<= 1
+	}
+	if paddle.button {
+		val |= PADDLE_BUTTON_MASK
+	}
+	return val
+}
@@ -0,0 +1,43 @@
+package gnes
+
+import "testing"
+
+func TestPaddleRead(t *testing.T) {
+	tests := []struct {
+		position int
+		button   bool
+		// The bits read on D4, most significant first, inverted
+		bits uint8
+	}{
+		{0xA5, false, 0x5A},
+		{0xA5, true, 0x5A},
+		{PADDLE_MIN, false, ^uint8(PADDLE_MIN)},
+		{PADDLE_MAX, true, ^uint8(PADDLE_MAX)},
+		// Out of range positions are clamped
+		{0, false, ^uint8(PADDLE_MIN)},
+		{255, false, ^uint8(PADDLE_MAX)},
+	}
+	emu := testEmulator(t)
+	paddle := NewPaddle()
+	if err := emu.SetInputDevice(PORT_2, paddle); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		paddle.SetPosition(test.position)
+		paddle.SetButton(test.button)
+		vals := readJoyBits(t, emu, JOY2_ADDR, 8)
+		for i, val := range vals {
+			var want uint8
+			if (test.bits<<uint(i))&0x80 != 0 {
+				want |= PADDLE_DATA_MASK
+			}
+			if test.button {
+				want |= PADDLE_BUTTON_MASK
+			}
+			if val&JOY_DATA_MASK != want {
+				t.Errorf("position %d, button %t, read %d: $%02X, want $%02X",
+					test.position, test.button, i+1, val&JOY_DATA_MASK, want)
+			}
+		}
+	}
+}
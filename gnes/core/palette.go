@@ -0,0 +1,85 @@
+package gnes
+
+import "image"
+import "image/color"
+
+// Factor applied to the colour channels that are not emphasised when any of the
+// PPUMASK emphasis bits are set. This matches the signal attenuation used by the
+// NTSC filter.
+const emphasis_ATTENUATION = 0.746
+
+// Emphasis bits of a 9-bit pixel, as the PPU outputs them
+const (
+	PIXEL_EMPHASIS_RED   = 0x40
+	PIXEL_EMPHASIS_GREEN = 0x80
+	PIXEL_EMPHASIS_BLUE  = 0x100
+	PIXEL_COLOUR_MASK    = 0x3F
+)
+
+// nesPalette is the standard 2C02 palette, as 0xRRGGBB values
+var nesPalette = [64]uint32{
+	0x666666, 0x002A88, 0x1412A7, 0x3B00A4, 0x5C007E, 0x6E0040, 0x6C0600, 0x561D00,
+	0x333500, 0x0B4800, 0x005200, 0x004F08, 0x00404D, 0x000000, 0x000000, 0x000000,
+	0xADADAD, 0x155FD9, 0x4240FF, 0x7527FE, 0xA01ACC, 0xB71E7B, 0xB53120, 0x994E00,
+	0x6B6D00, 0x388700, 0x0C9300, 0x008F32, 0x007C8D, 0x000000, 0x000000, 0x000000,
+	0xFFFEFF, 0x64B0FF, 0x9290FF, 0xC676FF, 0xF36AFF, 0xFE6ECC, 0xFE8170, 0xEA9E22,
+	0xBCBE00, 0x88D800, 0x5CE430, 0x45E082, 0x48CDDE, 0x4F4F4F, 0x000000, 0x000000,
+	0xFFFEFF, 0xC0DFFF, 0xD3D2FF, 0xE8C8FF, 0xFBC2FF, 0xFEC4EA, 0xFECCC5, 0xF7D8A5,
+	0xE4E594, 0xCFEF96, 0xBDF4AB, 0xB3F3CC, 0xB5EBF2, 0xB8B8B8, 0x000000, 0x000000,
+}
+
+// FrameFilter converts a frame of raw 9-bit PPU pixels into an image. The frame
+// number is passed along since some filters (e.g. NTSC) depend on the colour
+// subcarrier phase, which alternates between frames.
+type FrameFilter interface {
+	Filter(pixels []uint16, frame uint64) *image.RGBA
+}
+
+// PaletteFilter is the plain filter, which looks every pixel up in the NES palette
+// and produces a 256 pixel wide image.
+type PaletteFilter struct {
+	colours [512]color.RGBA
+}
+
+func NewPaletteFilter() *PaletteFilter {
+	filter := &PaletteFilter{}
+	for pixel := range filter.colours {
+		filter.colours[pixel] = pixelToRGBA(uint16(pixel))
+	}
+	return filter
+}
+
+func (filter *PaletteFilter) Filter(pixels []uint16, frame uint64) *image.RGBA {
+	height := len(pixels) / SCREEN_WIDTH
+	img := image.NewRGBA(image.Rect(0, 0, SCREEN_WIDTH, height))
+	for i, pixel := range pixels {
+		c := filter.colours[pixel&0x1FF]
+		img.Pix[i*4] = c.R
+		img.Pix[i*4+1] = c.G
+		img.Pix[i*4+2] = c.B
+		img.Pix[i*4+3] = c.A
+	}
+	return img
+}
+
+// pixelToRGBA returns the colour of a 9-bit pixel, dimming the channels which
+// aren't emphasised.
+func pixelToRGBA(pixel uint16) color.RGBA {
+	rgb := nesPalette[pixel&PIXEL_COLOUR_MASK]
+	r := float64((rgb >> 16) & 0xFF)
+	g := float64((rgb >> 8) & 0xFF)
+	b := float64(rgb & 0xFF)
+
+	if (pixel & (PIXEL_EMPHASIS_RED | PIXEL_EMPHASIS_GREEN | PIXEL_EMPHASIS_BLUE)) != 0 {
+		if (pixel & PIXEL_EMPHASIS_RED) == 0 {
+			r *= emphasis_ATTENUATION
+		}
+		if (pixel & PIXEL_EMPHASIS_GREEN) == 0 {
+			g *= emphasis_ATTENUATION
+		}
+		if (pixel & PIXEL_EMPHASIS_BLUE) == 0 {
+			b *= emphasis_ATTENUATION
+		}
+	}
+	return color.RGBA{uint8(r), uint8(g), uint8(b), 0xFF}
+}
@@ -0,0 +1,84 @@
+package gnes
+
+const (
+	// Bits the Power Pad drives when its port is read
+	POWER_PAD_D3_MASK uint8 = 0x08
+	POWER_PAD_D4_MASK uint8 = 0x10
+
+	POWER_PAD_BUTTONS = 12
+)
+
+// The order the buttons are shifted out on D3 and D4, numbered as on side B
+// of the mat
+var (
+	powerPadOrderD3 = []int{2, 1, 5, 9, 6, 10, 11, 7}
+	powerPadOrderD4 = []int{4, 3, 12, 8}
+)
+
+// PowerPad is the Power Pad exercise mat. Its 12 buttons are latched when it's
+// strobed, and read as two serial streams, on D3 and D4. Like a standard
+// controller, both return 1 once they run out of buttons.
+type PowerPad struct {
+	// pressed has bit n-1 set while button n is pressed
+	pressed uint16
+
+	shiftD3,
+	shiftD4 uint16
+	strobe bool
+}
+
+func NewPowerPad() *PowerPad {
+	return &PowerPad{}
+}
+
+// SetPressed sets the buttons being stood on, with bit n-1 for button n.
+func (pad *PowerPad) SetPressed(buttons uint16) {
+	pad.pressed = buttons & (1<<POWER_PAD_BUTTONS - 1)
+}
+
+// Pressed returns the buttons being stood on, with bit n-1 for button n.
+func (pad *PowerPad) Pressed() uint16 {
+	return pad.pressed
+}
+
+// shiftFor lays the buttons out in the order they're read, first lowest,
+// with 1s after them
+func (pad *PowerPad) shiftFor(order []int) uint16 {
+	shift := uint16(0xFFFF) << uint(len(order))
+	for i, button := range order {
+		if (pad.pressed & (1 << uint(button-1))) != 0 {
+			shift |= 1 << uint(i)
+		}
+	}
+	return shift
+}
+
+func (pad *PowerPad) load() {
+	pad.shiftD3 = pad.shiftFor(powerPadOrderD3)
+	pad.shiftD4 = pad.shiftFor(powerPadOrderD4)
+}
+
+func (pad *PowerPad) Strobe(high bool) {
+	pad.strobe = high
+	if high {
+		pad.load()
+	}
+}
+
+func (pad *PowerPad) Read() uint8 {
+	if pad.strobe {
+		pad.load()
+	}
+	var val uint8
+	if (pad.shiftD3 & 1) != 0 {
+		val |= POWER_PAD_D3_MASK
+	}
+	if (pad.shiftD4 & 1) != 0 {
+		val |= POWER_PAD_D4_MASK
+	}
+	if !pad.strobe {
+		pad.shiftD3 = (pad.shiftD3 >> 1) | 0x8000
+		pad.shiftD4 = (pad.shiftD4 >> 1) | 0x8000
+	}
+	return val
+}
@@ -0,0 +1,46 @@
+package gnes
+
+import "testing"
+
+func TestPowerPadRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		pressed []int
+		// The bits read on D3 and D4, first read lowest
+		d3, d4 uint16
+	}{
+		{"nothing pressed", nil, 0xFF00, 0xFFF0},
+		{"every button", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 0xFFFF, 0xFFFF},
+		// D3 reads 2, 1, 5, 9, 6, 10, 11, 7 and D4 reads 4, 3, 12, 8
+		{"2 and 4", []int{2, 4}, 0xFF01, 0xFFF1},
+		{"1 and 3", []int{1, 3}, 0xFF02, 0xFFF2},
+		{"5, 9 and 12", []int{5, 9, 12}, 0xFF0C, 0xFFF4},
+		{"6, 10, 11 and 7", []int{6, 10, 11, 7}, 0xFFF0, 0xFFF0},
+		{"8", []int{8}, 0xFF00, 0xFFF8},
+	}
+	emu := testEmulator(t)
+	pad := NewPowerPad()
+	if err := emu.SetInputDevice(PORT_2, pad); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		var pressed uint16
+		for _, button := range test.pressed {
+			pressed |= 1 << uint(button-1)
+		}
+		pad.SetPressed(pressed)
+		vals := readJoyBits(t, emu, JOY2_ADDR, 16)
+		for i, val := range vals {
+			var want uint8
+			if (test.d3>>uint(i))&1 != 0 {
+				want |= POWER_PAD_D3_MASK
+			}
+			if (test.d4>>uint(i))&1 != 0 {
+				want |= POWER_PAD_D4_MASK
+			}
+			if val&JOY_DATA_MASK != want {
+				t.Errorf("%s, read %d: $%02X, want $%02X", test.name, i+1, val&JOY_DATA_MASK, want)
+			}
+		}
+	}
+}
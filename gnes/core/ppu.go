@@ -13,6 +13,24 @@ const (
 const (
 	VBLANK_BIT_MASK           uint8 = 0x80
 	PPUSTATUS_UNUSED_BIT_MASK uint8 = 0x1F
+	GREYSCALE_BIT_MASK        uint8 = 0x01
+	EMPHASIS_BIT_MASK         uint8 = 0xE0
+)
+
+// PPUCTRL bit masks
+const (
+	NAMETABLE_SELECT_MASK     uint8 = 0x03
+	VRAM_INCREMENT_MASK       uint8 = 0x04
+	SPRITE_PATTERN_TABLE_MASK uint8 = 0x08
+	BG_PATTERN_TABLE_MASK     uint8 = 0x10
+	SPRITE_SIZE_MASK          uint8 = 0x20
+	NMI_ENABLE_MASK           uint8 = 0x80
+)
+
+// Dimensions of the picture generated by the PPU
+const (
+	SCREEN_WIDTH  = 256
+	SCREEN_HEIGHT = 240
 )
 const (
 	size_PATTERN_TABLE_0    = 0x1000
@@ -32,6 +50,17 @@ const (
 	addr_PPU_END   = 0x4000
 )
 
+// Addresses on the PPU's own bus
+const (
+	addr_PATTERN_TABLE_0 = 0x0000
+	addr_PATTERN_TABLE_1 = 0x1000
+	addr_NAMETABLE_0     = 0x2000
+	addr_PALETTE_RAM     = 0x3F00
+	addr_PPU_BUS_END     = 0x4000
+)
+
+const size_OAM = 0x100
+
 // ppuRegisters represents the raw registers from PPU_REG_ADDR to PPU_REG_MIRROR
 type ppuRegisters struct {
 	ppuctrl,
@@ -48,15 +77,47 @@ type ppu struct {
 	mirroring uint8
 	openLatch uint8
 
+	// mapper provides the pattern tables, and is set once the cartridge is loaded
+	mapper mapper
+
 	cycles        uint64
 	catchupCycles uint64
 
-	regs *ppuRegisters
-	vram [size_PPU_VRAM]byte
+	regs       *ppuRegisters
+	vram       [size_PPU_VRAM]byte
+	paletteRam [size_PALETTE_RAM]byte
+	oam        [size_OAM]byte
+
+	// Internal registers used for scrolling and VRAM access
+	v,
+	t uint16 // current and temporary VRAM address
+	x          uint8 // fine x scroll
+	w          bool  // first/second write toggle for PPUSCROLL and PPUADDR
+	readBuffer uint8 // PPUDATA read buffer
+
+	// frame holds the 9-bit pixels (palette index in the low 6 bits, PPUMASK
+	// emphasis bits in the upper 3) of the frame currently being drawn, and
+	// lastFrame holds the most recently completed one.
+	frame,
+	lastFrame []uint16
+	lastFrameNumber uint64
+
+	// The background and sprite pixels of the current scanline, see render.go
+	bgLine,
+	spriteLine [SCREEN_WIDTH]uint8
+	spriteBehind,
+	spriteZero [SCREEN_WIDTH]bool
+
+	// Non-accurate enhancements
+	options Options
 
 	currentScanline      uint16
 	currentScanlineCycle uint16
 	currentFrame         uint64
+
+	// Callbacks run at specific raster positions, see hooks.go
+	hooks      []ppuHook
+	nextHookID HookID
 }
 
 func newPpu() (*ppu, error) {
@@ -73,9 +134,25 @@ func newPpu() (*ppu, error) {
 	ppu.regs = &ppuRegisters{}
 	ppu.openLatch = 0
 
+	ppu.frame = make([]uint16, SCREEN_WIDTH*SCREEN_HEIGHT)
+	ppu.lastFrame = make([]uint16, SCREEN_WIDTH*SCREEN_HEIGHT)
+
 	return ppu, nil
 }
 
+// reset puts the PPU in its state after the console's reset button is pressed.
+// Memory and the current raster position are left alone.
+func (ppu *ppu) reset() {
+	ppu.regs.ppuctrl = 0
+	ppu.regs.ppumask = 0
+	ppu.regs.ppuscroll = 0
+	ppu.regs.ppudata = 0
+	ppu.t = 0
+	ppu.x = 0
+	ppu.w = false
+	ppu.readBuffer = 0
+}
+
 // catchup catches the PPU up by ppu.catchupCycles. Since CPU/PPU execution is staggered
 // and emulator execution is driven by the CPU, we need to catch the PPU up at each execution step
 // in proportion with the number of cycles spent by the CPU.
@@ -97,36 +174,97 @@ func (ppu *ppu) catchup() error {
 		// Actually do things
 		if ppu.currentScanline >= 0 && ppu.currentScanline <= 239 {
 			// Visible scanlines
-			ppu.currentScanlineCycle++
-			ppu.catchupCycles--
-
+			if ppu.currentScanlineCycle == 1 {
+				err := ppu.prepareLine(ppu.currentScanline)
+				if err != nil {
+					return err
+				}
+			}
+			if ppu.currentScanlineCycle >= 1 && ppu.currentScanlineCycle <= SCREEN_WIDTH {
+				ppu.outputPixel(ppu.currentScanlineCycle-1, ppu.currentScanline)
+			}
+			ppu.stepScroll()
 		} else if ppu.currentScanline == 240 {
 			// Post-render scanlines
-			ppu.currentScanlineCycle++
-			ppu.catchupCycles--
-
+			if ppu.currentScanlineCycle == 0 {
+				ppu.finishFrame()
+			}
 		} else if ppu.currentScanline >= 241 && ppu.currentScanline <= 260 {
 			// Vertical blanking scanlines
 			if ppu.currentScanline == 241 && ppu.currentScanlineCycle == 1 {
 				ppu.regs.ppustatus |= VBLANK_BIT_MASK
 			}
-
-			ppu.currentScanlineCycle++
-			ppu.catchupCycles--
-
 		} else if ppu.currentScanline == 261 {
 			// Pre-render scanline
 			if ppu.currentScanlineCycle == 1 {
-				ppu.regs.ppustatus &= ^VBLANK_BIT_MASK
+				ppu.regs.ppustatus &= ^(VBLANK_BIT_MASK | SPRITE_ZERO_HIT_BIT_MASK | SPRITE_OVERFLOW_BIT_MASK)
 			}
-			ppu.currentScanlineCycle++
-			ppu.catchupCycles--
+			ppu.stepScroll()
+		}
+
+		if len(ppu.hooks) > 0 {
+			ppu.runHooks()
 		}
+		ppu.currentScanlineCycle++
+		ppu.catchupCycles--
 	}
 
 	return nil
 }
 
+// outputPixel writes the pixel at (x, y) of the current frame, combining the
+// background and sprite pixels prepared for the scanline. PPUMASK is checked
+// here rather than when the scanline is prepared, so mid-scanline writes take
+// effect at the right dot.
+func (ppu *ppu) outputPixel(x, y uint16) {
+	mask := ppu.regs.ppumask
+	showBg := (mask & SHOW_BG_MASK) != 0
+	showSprites := (mask & SHOW_SPRITES_MASK) != 0
+	if x < size_CLIP && !ppu.options.NoLeftClip {
+		showBg = showBg && (mask&SHOW_BG_LEFT_MASK) != 0
+		showSprites = showSprites && (mask&SHOW_SPRITES_LEFT_MASK) != 0
+	}
+	var bg, sprite uint8
+	if showBg {
+		bg = ppu.bgLine[x]
+	}
+	if showSprites {
+		sprite = ppu.spriteLine[x]
+	}
+
+	// Sprite 0 hits always honour the clip bits, so the option doesn't
+	// change game behaviour
+	hitBg := bg != 0 && (x >= size_CLIP || (mask&SHOW_BG_LEFT_MASK) != 0)
+	hitSprite := sprite != 0 && (x >= size_CLIP || (mask&SHOW_SPRITES_LEFT_MASK) != 0)
+	if hitBg && hitSprite && ppu.spriteZero[x] && x != SCREEN_WIDTH-1 {
+		ppu.regs.ppustatus |= SPRITE_ZERO_HIT_BIT_MASK
+	}
+
+	var index uint8
+	if sprite != 0 && (bg == 0 || !ppu.spriteBehind[x]) {
+		index = sprite
+	} else {
+		index = bg
+	}
+	ppu.frame[int(y)*SCREEN_WIDTH+int(x)] = ppu.composePixel(ppu.paletteRam[index])
+}
+
+// composePixel turns a palette RAM entry into the 9-bit value the PPU actually
+// outputs, applying the greyscale and colour emphasis bits of PPUMASK.
+func (ppu *ppu) composePixel(colour uint8) uint16 {
+	if (ppu.regs.ppumask & GREYSCALE_BIT_MASK) != 0 {
+		colour &= 0x30
+	}
+	return uint16(colour&0x3F) | (uint16(ppu.regs.ppumask&EMPHASIS_BIT_MASK) << 1)
+}
+
+// finishFrame publishes the frame that has just been drawn, so that consumers
+// always see a complete picture.
+func (ppu *ppu) finishFrame() {
+	ppu.frame, ppu.lastFrame = ppu.lastFrame, ppu.frame
+	ppu.lastFrameNumber = ppu.currentFrame
+}
+
 func (ppu *ppu) setMirroring(mirrorMode uint8) error {
 	if mirrorMode < MIRROR_MODE_SINGLE_LOWER || mirrorMode > MIRROR_MODE_HORIZONTAL {
 		return fmt.Errorf("Invalid mirroring mode %d", mirrorMode)
@@ -135,6 +273,69 @@ func (ppu *ppu) setMirroring(mirrorMode uint8) error {
 	return nil
 }
 
+// nametableIndex maps an address in the nametable region of the PPU bus onto
+// the PPU's internal VRAM, according to the current mirroring mode.
+func (ppu *ppu) nametableIndex(addr uint16) uint16 {
+	addr = (addr - addr_NAMETABLE_0) % (4 * size_NAMETABLE_0)
+	table := addr / size_NAMETABLE_0
+	offset := addr % size_NAMETABLE_0
+
+	switch ppu.mirroring {
+	case MIRROR_MODE_SINGLE_LOWER:
+		table = 0
+	case MIRROR_MODE_SINGLE_UPPER:
+		table = 1
+	case MIRROR_MODE_VERITCAL:
+		table &= 1
+	case MIRROR_MODE_HORIZONTAL:
+		table >>= 1
+	}
+	return table*size_NAMETABLE_0 + offset
+}
+
+// paletteIndex maps an address in the palette region of the PPU bus onto
+// palette RAM. The backdrop entries of the sprite palettes mirror those of the
+// background palettes.
+func paletteIndex(addr uint16) uint16 {
+	index := addr % size_PALETTE_RAM
+	if index >= 0x10 && index%4 == 0 {
+		index -= 0x10
+	}
+	return index
+}
+
+// read reads a byte from the PPU's own address space
+func (ppu *ppu) read(addr uint16) (uint8, error) {
+	addr %= addr_PPU_BUS_END
+	if addr < addr_NAMETABLE_0 {
+		return ppu.mapper.readChr(addr)
+	} else if addr < addr_PALETTE_RAM {
+		return ppu.vram[ppu.nametableIndex(addr)], nil
+	}
+	return ppu.paletteRam[paletteIndex(addr)], nil
+}
+
+// write writes a byte to the PPU's own address space
+func (ppu *ppu) write(val uint8, addr uint16) error {
+	addr %= addr_PPU_BUS_END
+	if addr < addr_NAMETABLE_0 {
+		return ppu.mapper.writeChr(val, addr)
+	} else if addr < addr_PALETTE_RAM {
+		ppu.vram[ppu.nametableIndex(addr)] = val
+	} else {
+		ppu.paletteRam[paletteIndex(addr)] = val & 0x3F
+	}
+	return nil
+}
+
+// vramIncrement returns how far v moves after each PPUDATA access
+func (ppu *ppu) vramIncrement() uint16 {
+	if (ppu.regs.ppuctrl & VRAM_INCREMENT_MASK) != 0 {
+		return 32
+	}
+	return 1
+}
+
 // getCPUAddrPointer returns a pointer to a PPU-related register available in the CPU's memory map
 func (ppu *ppu) getCPUAddrPointer(addr uint16) (*uint8, error) {
 	if addr < addr_PPU_START || addr >= addr_PPU_END {
@@ -153,7 +354,7 @@ func (ppu *ppu) getCPUAddrPointer(addr uint16) (*uint8, error) {
 	case 3:
 		return nil, gErrorNew(err_UNWRITEABLE_PPU_REG)
 	case 4:
-		ptr = &ppu.regs.oamdata
+		ptr = &ppu.oam[ppu.regs.oamaddr]
 	case 5:
 		return nil, gErrorNew(err_UNWRITEABLE_PPU_REG)
 	case 6:
@@ -171,9 +372,12 @@ func (ppu *ppu) writeCPU(val uint8, addr uint16) error {
 		return errors.New("Address out of bounds for PPU")
 	}
 
-	switch val % 8 {
+	var err error
+
+	switch addr % 8 {
 	case 0:
 		ppu.regs.ppuctrl = val
+		ppu.t = (ppu.t & 0xF3FF) | (uint16(val&NAMETABLE_SELECT_MASK) << 10)
 	case 1:
 		ppu.regs.ppumask = val
 	case 2:
@@ -182,16 +386,34 @@ func (ppu *ppu) writeCPU(val uint8, addr uint16) error {
 		ppu.regs.oamaddr = val
 	case 4:
 		ppu.regs.oamdata = val
+		ppu.oam[ppu.regs.oamaddr] = val
+		ppu.regs.oamaddr++
 	case 5:
 		ppu.regs.ppuscroll = val
+		if !ppu.w {
+			ppu.t = (ppu.t & 0xFFE0) | uint16(val>>3)
+			ppu.x = val & 0x7
+		} else {
+			ppu.t = (ppu.t & 0x8C1F) | (uint16(val&0x7) << 12) | (uint16(val&0xF8) << 2)
+		}
+		ppu.w = !ppu.w
 	case 6:
 		ppu.regs.ppuaddr = val
+		if !ppu.w {
+			ppu.t = (ppu.t & 0x00FF) | (uint16(val&0x3F) << 8)
+		} else {
+			ppu.t = (ppu.t & 0xFF00) | uint16(val)
+			ppu.v = ppu.t
+		}
+		ppu.w = !ppu.w
 	case 7:
 		ppu.regs.ppudata = val
+		err = ppu.write(val, ppu.v)
+		ppu.v = (ppu.v + ppu.vramIncrement()) & 0x7FFF
 	}
 	ppu.openLatch = val
 
-	return nil
+	return err
 }
 
 // readCPU reads a PPU-related value available on the CPU's memory map
@@ -210,18 +432,37 @@ func (ppu *ppu) readCPU(addr uint16) (uint8, error) {
 	case 2:
 		val = (ppu.regs.ppustatus & ^PPUSTATUS_UNUSED_BIT_MASK) | (ppu.openLatch & PPUSTATUS_UNUSED_BIT_MASK)
 		ppu.regs.ppustatus &= ^VBLANK_BIT_MASK
+		ppu.w = false
 		ppu.openLatch = val
 	case 3:
 		val = ppu.openLatch
 	case 4:
-		val = ppu.regs.oamdata
+		val = ppu.oam[ppu.regs.oamaddr]
 		ppu.openLatch = val
 	case 5:
 		val = ppu.openLatch
 	case 6:
 		val = ppu.openLatch
 	case 7:
-		val = ppu.regs.ppudata
+		// Reads outside of palette RAM are delayed by one read through the read
+		// buffer. Palette reads are immediate, but still fill the buffer with the
+		// nametable byte "underneath" the palette.
+		data, err := ppu.read(ppu.v)
+		if err != nil {
+			return 0, err
+		}
+		if (ppu.v % addr_PPU_BUS_END) < addr_PALETTE_RAM {
+			val = ppu.readBuffer
+			ppu.readBuffer = data
+		} else {
+			val = (data & 0x3F) | (ppu.openLatch & 0xC0)
+			ppu.readBuffer, err = ppu.read(ppu.v - 0x1000)
+			if err != nil {
+				return 0, err
+			}
+		}
+		ppu.v = (ppu.v + ppu.vramIncrement()) & 0x7FFF
+		ppu.regs.ppudata = val
 		ppu.openLatch = val
 	}
 
@@ -0,0 +1,263 @@
+package gnes
+
+import "image"
+import "image/color"
+
+// OAM attribute byte masks
+const (
+	SPRITE_PALETTE_MASK  uint8 = 0x03
+	SPRITE_PRIORITY_MASK uint8 = 0x20
+	SPRITE_FLIP_H_MASK   uint8 = 0x40
+	SPRITE_FLIP_V_MASK   uint8 = 0x80
+)
+
+const (
+	size_TILE            = 8
+	size_TILE_BYTES      = 16
+	size_NAMETABLE_TILES = 32 * 30
+	offset_ATTRIBUTES    = 0x3C0
+	num_SPRITES          = 64
+	num_PALETTES         = 8
+)
+
+var scrollOverlayColour = color.RGBA{0xFF, 0x00, 0x00, 0xFF}
+var spriteBorderColour = color.RGBA{0x20, 0x20, 0x20, 0xFF}
+
+// Sprite describes a single entry in OAM
+type Sprite struct {
+	Index int
+	X,
+	Y,
+	Tile,
+	Palette uint8 // 0-3, i.e. palettes 4-7 of palette RAM
+
+	BehindBackground,
+	FlipHorizontal,
+	FlipVertical bool
+}
+
+// tileRow returns the two bit planes of row 'row' of a tile in the pattern table
+// starting at 'table'.
+func (ppu *ppu) tileRow(table uint16, tile uint8, row uint16) (uint8, uint8, error) {
+	addr := table + uint16(tile)*size_TILE_BYTES + row
+	lo, err := ppu.read(addr)
+	if err != nil {
+		return 0, 0, err
+	}
+	hi, err := ppu.read(addr + size_TILE)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lo, hi, nil
+}
+
+// paletteColour returns the colour of entry 'index' of palette 'palette', where
+// palettes 0-3 are background palettes and 4-7 are sprite palettes.
+func (ppu *ppu) paletteColour(palette, index uint8) uint8 {
+	if index == 0 {
+		return ppu.paletteRam[0]
+	}
+	return ppu.paletteRam[paletteIndex(uint16(palette)*4+uint16(index))]
+}
+
+// drawTile draws a tile of the given pattern table at (x, y) in img
+func (ppu *ppu) drawTile(img *image.RGBA, x, y int, table uint16, tile, palette uint8, flipH, flipV bool) error {
+	for row := 0; row < size_TILE; row++ {
+		srcRow := row
+		if flipV {
+			srcRow = size_TILE - 1 - row
+		}
+		lo, hi, err := ppu.tileRow(table, tile, uint16(srcRow))
+		if err != nil {
+			return err
+		}
+		for col := 0; col < size_TILE; col++ {
+			bit := uint(7 - col)
+			if flipH {
+				bit = uint(col)
+			}
+			index := ((lo >> bit) & 1) | (((hi >> bit) & 1) << 1)
+			img.SetRGBA(x+col, y+row, pixelToRGBA(uint16(ppu.paletteColour(palette, index))))
+		}
+	}
+	return nil
+}
+
+/***********************************************/
+/*               Inspection API                */
+/***********************************************/
+
+// PatternTablesImage draws both pattern tables side by side, using palette
+// 'palette' (0-3 for background palettes, 4-7 for sprite palettes).
+func (emu *Emulator) PatternTablesImage(palette int) (*image.RGBA, error) {
+	if palette < 0 || palette >= num_PALETTES {
+		return nil, gError1New(err_INVALID_PALETTE, uint64(palette))
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 256, 128))
+	for table := 0; table < 2; table++ {
+		for tile := 0; tile < 256; tile++ {
+			x := table*128 + (tile%16)*size_TILE
+			y := (tile / 16) * size_TILE
+			err := emu.ppu.drawTile(img, x, y, uint16(table)*addr_PATTERN_TABLE_1, uint8(tile), uint8(palette), false, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return img, nil
+}
+
+// NametablesImage draws all four nametables, as mirrored by the cartridge, with
+// the area currently scrolled into view outlined.
+func (emu *Emulator) NametablesImage() (*image.RGBA, error) {
+	ppu := emu.ppu
+	img := image.NewRGBA(image.Rect(0, 0, 2*SCREEN_WIDTH, 2*SCREEN_HEIGHT))
+
+	var patternTable uint16 = addr_PATTERN_TABLE_0
+	if (ppu.regs.ppuctrl & BG_PATTERN_TABLE_MASK) != 0 {
+		patternTable = addr_PATTERN_TABLE_1
+	}
+
+	for table := uint16(0); table < 4; table++ {
+		base := addr_NAMETABLE_0 + table*size_NAMETABLE_0
+		for i := uint16(0); i < size_NAMETABLE_TILES; i++ {
+			tileX := i % 32
+			tileY := i / 32
+			tile, err := ppu.read(base + i)
+			if err != nil {
+				return nil, err
+			}
+			attr, err := ppu.read(base + offset_ATTRIBUTES + (tileY/4)*8 + tileX/4)
+			if err != nil {
+				return nil, err
+			}
+			shift := ((tileY % 4) / 2 * 4) + ((tileX % 4) / 2 * 2)
+			palette := (attr >> shift) & 0x3
+
+			x := int(table%2)*SCREEN_WIDTH + int(tileX)*size_TILE
+			y := int(table/2)*SCREEN_HEIGHT + int(tileY)*size_TILE
+			err = ppu.drawTile(img, x, y, patternTable, tile, palette, false, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The scroll position the next frame will start rendering from lives in t and x
+	scrollX := int((ppu.t&0x1F)<<3) | int(ppu.x) | int((ppu.t>>10)&0x1)*SCREEN_WIDTH
+	scrollY := int(((ppu.t>>5)&0x1F)<<3) | int((ppu.t>>12)&0x7)
+	scrollY += int((ppu.t>>11)&0x1) * SCREEN_HEIGHT
+	for i := 0; i < SCREEN_WIDTH; i++ {
+		img.SetRGBA((scrollX+i)%(2*SCREEN_WIDTH), scrollY%(2*SCREEN_HEIGHT), scrollOverlayColour)
+		img.SetRGBA((scrollX+i)%(2*SCREEN_WIDTH), (scrollY+SCREEN_HEIGHT-1)%(2*SCREEN_HEIGHT), scrollOverlayColour)
+	}
+	for i := 0; i < SCREEN_HEIGHT; i++ {
+		img.SetRGBA(scrollX%(2*SCREEN_WIDTH), (scrollY+i)%(2*SCREEN_HEIGHT), scrollOverlayColour)
+		img.SetRGBA((scrollX+SCREEN_WIDTH-1)%(2*SCREEN_WIDTH), (scrollY+i)%(2*SCREEN_HEIGHT), scrollOverlayColour)
+	}
+
+	return img, nil
+}
+
+// GetSprites returns the decoded contents of OAM.
+func (emu *Emulator) GetSprites() []Sprite {
+	sprites := make([]Sprite, num_SPRITES)
+	for i := range sprites {
+		entry := emu.ppu.oam[i*4 : i*4+4]
+		sprites[i] = Sprite{
+			Index:            i,
+			Y:                entry[0],
+			Tile:             entry[1],
+			Palette:          entry[2] & SPRITE_PALETTE_MASK,
+			X:                entry[3],
+			BehindBackground: (entry[2] & SPRITE_PRIORITY_MASK) != 0,
+			FlipHorizontal:   (entry[2] & SPRITE_FLIP_H_MASK) != 0,
+			FlipVertical:     (entry[2] & SPRITE_FLIP_V_MASK) != 0,
+		}
+	}
+	return sprites
+}
+
+// SpriteHeight returns the height of sprites in the current PPUCTRL sprite size mode.
+func (emu *Emulator) SpriteHeight() int {
+	return emu.ppu.spriteHeight()
+}
+
+// SpritesImage draws a preview of all 64 sprites in OAM order, in an 8x8 grid.
+func (emu *Emulator) SpritesImage() (*image.RGBA, error) {
+	ppu := emu.ppu
+	height := emu.SpriteHeight()
+	cellWidth := size_TILE + 2
+	cellHeight := height + 2
+
+	img := image.NewRGBA(image.Rect(0, 0, 8*cellWidth, 8*cellHeight))
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			img.SetRGBA(x, y, spriteBorderColour)
+		}
+	}
+
+	for _, sprite := range emu.GetSprites() {
+		x := (sprite.Index%8)*cellWidth + 1
+		y := (sprite.Index/8)*cellHeight + 1
+		palette := sprite.Palette + 4
+
+		if height == size_TILE {
+			var table uint16 = addr_PATTERN_TABLE_0
+			if (ppu.regs.ppuctrl & SPRITE_PATTERN_TABLE_MASK) != 0 {
+				table = addr_PATTERN_TABLE_1
+			}
+			err := ppu.drawTile(img, x, y, table, sprite.Tile, palette, sprite.FlipHorizontal, sprite.FlipVertical)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// 8x16 sprites take their pattern table from bit 0 of the tile number
+		table := uint16(sprite.Tile&0x1) * addr_PATTERN_TABLE_1
+		top, bottom := sprite.Tile&0xFE, sprite.Tile|0x01
+		if sprite.FlipVertical {
+			top, bottom = bottom, top
+		}
+		err := ppu.drawTile(img, x, y, table, top, palette, sprite.FlipHorizontal, sprite.FlipVertical)
+		if err != nil {
+			return nil, err
+		}
+		err = ppu.drawTile(img, x, y+size_TILE, table, bottom, palette, sprite.FlipHorizontal, sprite.FlipVertical)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// PaletteImage draws palette RAM as swatches. The top row holds the background
+// palettes, and the bottom row the sprite palettes.
+func (emu *Emulator) PaletteImage() *image.RGBA {
+	const swatch = 16
+	img := image.NewRGBA(image.Rect(0, 0, 16*swatch, 2*swatch))
+	for i := 0; i < size_PALETTE_RAM; i++ {
+		colour := pixelToRGBA(uint16(emu.ppu.paletteRam[paletteIndex(uint16(i))]))
+		for y := 0; y < swatch; y++ {
+			for x := 0; x < swatch; x++ {
+				img.SetRGBA((i%16)*swatch+x, (i/16)*swatch+y, colour)
+			}
+		}
+	}
+	return img
+}
+
+// GetPaletteRam returns a copy of palette RAM.
+func (emu *Emulator) GetPaletteRam() []uint8 {
+	palette := make([]uint8, size_PALETTE_RAM)
+	for i := range palette {
+		palette[i] = emu.ppu.paletteRam[paletteIndex(uint16(i))]
+	}
+	return palette
+}
+
+// WritePNG writes an image, e.g. one returned by the inspection API, to a PNG file.
+func WritePNG(path string, img image.Image) error {
+	return writePNG(path, img)
+}
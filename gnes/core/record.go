@@ -0,0 +1,303 @@
+package gnes
+
+import "bytes"
+import "encoding/binary"
+import "hash/crc32"
+import "image"
+import "image/color"
+import "image/gif"
+import "image/png"
+import "io/ioutil"
+import "math"
+import "path/filepath"
+import "strings"
+
+// Recording formats
+const (
+	RECORD_FORMAT_GIF  = 1
+	RECORD_FORMAT_APNG = 2
+)
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// recorder encodes every Nth completed frame into an animated GIF or APNG.
+// Frames are kept in memory and the file is written when recording stops,
+// since both formats need to know the number of frames up front.
+type recorder struct {
+	path   string
+	format int
+	every  uint64
+
+	frameRate float64
+	seen,
+	recorded uint64
+
+	// Frame timestamps so far, in the delay units of the format, rounded
+	elapsed int
+
+	// GIF frames, or APNG frames as individually encoded PNGs
+	gifFrames []*image.Paletted
+	pngFrames [][]byte
+	delays    []int
+	size      image.Point
+
+	gifPalette color.Palette
+}
+
+func newRecorder(path string, every int, frameRate float64) (*recorder, error) {
+	rec := &recorder{}
+	rec.path = path
+	rec.frameRate = frameRate
+
+	if every < 1 {
+		return nil, gError1New(err_INVALID_RECORD_INTERVAL, uint64(every))
+	}
+	rec.every = uint64(every)
+	// GIF delays are 16 bit, in hundredths of a second
+	if float64(every)*100/frameRate > math.MaxUint16 {
+		return nil, gError1New(err_INVALID_RECORD_INTERVAL, uint64(every))
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		rec.format = RECORD_FORMAT_GIF
+	case ".png", ".apng":
+		rec.format = RECORD_FORMAT_APNG
+	default:
+		return nil, &gError{err_UNKNOWN_RECORD_FORMAT}
+	}
+
+	// GIF frames use the 64 colours of the NES palette directly. Colour
+	// emphasis can't be represented, and is dropped.
+	rec.gifPalette = make(color.Palette, len(nesPalette))
+	for i := range nesPalette {
+		rec.gifPalette[i] = pixelToRGBA(uint16(i))
+	}
+	return rec, nil
+}
+
+// frameDone records the frame. If that fails, the recording is abandoned, so
+// the error isn't repeated every frame after.
+func (rec *recorder) frameDone(emu *Emulator) error {
+	err := rec.addFrame(emu)
+	if err != nil && emu.recorder == rec {
+		emu.removeFrameSink(rec)
+		emu.recorder = nil
+	}
+	return err
+}
+
+func (rec *recorder) addFrame(emu *Emulator) error {
+	rec.seen++
+	if (rec.seen-1)%rec.every != 0 {
+		return nil
+	}
+	rec.recorded++
+
+	// Delays are rounded from the exact timestamps, so that they don't drift
+	unitsPerSecond := 100.0
+	if rec.format == RECORD_FORMAT_APNG {
+		unitsPerSecond = 1000.0
+	}
+	end := int(math.Floor(float64(rec.recorded*rec.every)*unitsPerSecond/rec.frameRate + 0.5))
+	rec.delays = append(rec.delays, end-rec.elapsed)
+	rec.elapsed = end
+
+	if rec.format == RECORD_FORMAT_GIF {
+		rec.gifFrames = append(rec.gifFrames, rec.palettedFrame(emu))
+		return nil
+	}
+
+	// Every APNG frame covers the whole canvas, so the frame filter can't
+	// change size mid-recording
+	img := emu.Frame()
+	if len(rec.pngFrames) == 0 {
+		rec.size = img.Bounds().Size()
+	} else if img.Bounds().Size() != rec.size {
+		return &gError{err_RECORDING_SIZE_CHANGED}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return err
+	}
+	rec.pngFrames = append(rec.pngFrames, buf.Bytes())
+	return nil
+}
+
+// palettedFrame converts the last frame into a paletted image, cropped to the
+// emulator's overscan settings.
+func (rec *recorder) palettedFrame(emu *Emulator) *image.Paletted {
+	overscan := emu.visibleOverscan()
+	rect := image.Rect(0, 0, SCREEN_WIDTH-overscan.Left-overscan.Right, SCREEN_HEIGHT-overscan.Top-overscan.Bottom)
+	img := image.NewPaletted(rect, rec.gifPalette)
+	for y := 0; y < rect.Dy(); y++ {
+		for x := 0; x < rect.Dx(); x++ {
+			pixel := emu.ppu.lastFrame[(y+overscan.Top)*SCREEN_WIDTH+x+overscan.Left]
+			img.Pix[y*img.Stride+x] = uint8(pixel & PIXEL_COLOUR_MASK)
+		}
+	}
+	return img
+}
+
+// finish writes the recording to disk.
+func (rec *recorder) finish() error {
+	if rec.recorded == 0 {
+		return &gError{err_EMPTY_RECORDING}
+	}
+	var buf bytes.Buffer
+	var err error
+	if rec.format == RECORD_FORMAT_GIF {
+		err = gif.EncodeAll(&buf, &gif.GIF{Image: rec.gifFrames, Delay: rec.delays})
+	} else {
+		err = rec.encodeAPNG(&buf)
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(rec.path, buf.Bytes(), 0644)
+}
+
+// encodeAPNG assembles the recorded PNGs into an animated PNG. The IHDR of the
+// first frame is used for the whole animation, and the image data of every
+// frame after the first is moved into fdAT chunks.
+func (rec *recorder) encodeAPNG(buf *bytes.Buffer) error {
+	buf.Write(pngSignature)
+	var sequence uint32
+
+	for i, frame := range rec.pngFrames {
+		chunks, err := splitPNGChunks(frame)
+		if err != nil {
+			return err
+		}
+
+		for _, chunk := range chunks {
+			switch chunk.kind {
+			case "IHDR":
+				if i > 0 {
+					continue
+				}
+				writePNGChunk(buf, "IHDR", chunk.data)
+				actl := make([]byte, 8)
+				binary.BigEndian.PutUint32(actl[0:], uint32(len(rec.pngFrames)))
+				binary.BigEndian.PutUint32(actl[4:], 0) // loop forever
+				writePNGChunk(buf, "acTL", actl)
+				writeFrameControl(buf, sequence, chunk.data, rec.delays[i])
+				sequence++
+			case "IDAT":
+				if i == 0 {
+					writePNGChunk(buf, "IDAT", chunk.data)
+					continue
+				}
+				fdat := make([]byte, 4+len(chunk.data))
+				binary.BigEndian.PutUint32(fdat, sequence)
+				copy(fdat[4:], chunk.data)
+				writePNGChunk(buf, "fdAT", fdat)
+				sequence++
+			}
+		}
+
+		if i+1 < len(rec.pngFrames) {
+			// The frame control chunk for the next frame
+			next, err := splitPNGChunks(rec.pngFrames[i+1])
+			if err != nil {
+				return err
+			}
+			writeFrameControl(buf, sequence, next[0].data, rec.delays[i+1])
+			sequence++
+		}
+	}
+	writePNGChunk(buf, "IEND", nil)
+	return nil
+}
+
+// writeFrameControl writes an fcTL chunk for a full size frame, taking the
+// frame dimensions from its IHDR data. Delays are in milliseconds, and are
+// written in coarser units if they don't fit in 16 bits.
+func writeFrameControl(buf *bytes.Buffer, sequence uint32, ihdr []byte, delay int) {
+	num, den := delay, 1000
+	for num > math.MaxUint16 && den > 1 {
+		num = (num + 5) / 10
+		den /= 10
+	}
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], sequence)
+	copy(fctl[4:12], ihdr[0:8]) // width and height
+	binary.BigEndian.PutUint16(fctl[20:], uint16(num))
+	binary.BigEndian.PutUint16(fctl[22:], uint16(den))
+	writePNGChunk(buf, "fcTL", fctl)
+}
+
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+func splitPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, &gError{err_BAD_PNG_DATA}
+	}
+	var chunks []pngChunk
+	data = data[len(pngSignature):]
+	for len(data) >= 12 {
+		length := binary.BigEndian.Uint32(data)
+		if uint64(len(data)) < 12+uint64(length) {
+			return nil, &gError{err_BAD_PNG_DATA}
+		}
+		chunks = append(chunks, pngChunk{string(data[4:8]), data[8 : 8+length]})
+		data = data[12+length:]
+	}
+	if len(chunks) == 0 || chunks[0].kind != "IHDR" {
+		return nil, &gError{err_BAD_PNG_DATA}
+	}
+	return chunks, nil
+}
+
+func writePNGChunk(buf *bytes.Buffer, kind string, data []byte) {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], kind)
+	buf.Write(header)
+	buf.Write(data)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
+
+/***********************************************/
+/*                Recording API                */
+/***********************************************/
+
+// StartRecording starts recording every 'every'th frame into an animated image
+// at path. The format is picked from the extension: .gif, or .png/.apng for APNG.
+func (emu *Emulator) StartRecording(path string, every int) error {
+	if emu.recorder != nil {
+		return &gError{err_ALREADY_RECORDING}
+	}
+	rec, err := newRecorder(path, every, emu.FrameRate())
+	if err != nil {
+		return err
+	}
+	emu.recorder = rec
+	emu.addFrameSink(rec)
+	return nil
+}
+
+// StopRecording stops the current recording and writes it to disk.
+func (emu *Emulator) StopRecording() error {
+	if emu.recorder == nil {
+		return &gError{err_NOT_RECORDING}
+	}
+	rec := emu.recorder
+	emu.removeFrameSink(rec)
+	emu.recorder = nil
+	return rec.finish()
+}
+
+// IsRecording returns whether a recording is in progress.
+func (emu *Emulator) IsRecording() bool {
+	return emu.recorder != nil
+}
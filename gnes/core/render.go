@@ -0,0 +1,232 @@
+package gnes
+
+// PPUMASK bit masks
+const (
+	SHOW_BG_LEFT_MASK      uint8 = 0x02
+	SHOW_SPRITES_LEFT_MASK uint8 = 0x04
+	SHOW_BG_MASK           uint8 = 0x08
+	SHOW_SPRITES_MASK      uint8 = 0x10
+)
+
+// PPUSTATUS bit masks
+const (
+	SPRITE_OVERFLOW_BIT_MASK uint8 = 0x20
+	SPRITE_ZERO_HIT_BIT_MASK uint8 = 0x40
+)
+
+const (
+	num_LINE_SPRITES       = 8  // sprites the PPU can draw on a single scanline
+	num_LINE_TILES         = 33 // background tiles touched by a scanline, with fine x scroll
+	size_CLIP              = 8  // width of the left column hidden by the PPUMASK clip bits
+	offset_SPRITE_PALETTES = 0x10
+)
+
+// Scroll bits of the v and t registers
+const (
+	scroll_COARSE_X_MASK   uint16 = 0x001F
+	scroll_COARSE_Y_MASK   uint16 = 0x03E0
+	scroll_NAMETABLE_X     uint16 = 0x0400
+	scroll_NAMETABLE_Y     uint16 = 0x0800
+	scroll_FINE_Y_MASK     uint16 = 0x7000
+	scroll_HORIZONTAL_MASK        = scroll_COARSE_X_MASK | scroll_NAMETABLE_X
+	scroll_VERTICAL_MASK          = scroll_COARSE_Y_MASK | scroll_NAMETABLE_Y | scroll_FINE_Y_MASK
+)
+
+// renderingEnabled returns whether either the background or sprites are shown.
+// While rendering is disabled, the PPU leaves v alone and draws the backdrop.
+func (ppu *ppu) renderingEnabled() bool {
+	return (ppu.regs.ppumask & (SHOW_BG_MASK | SHOW_SPRITES_MASK)) != 0
+}
+
+// spriteHeight returns the height of sprites in the current PPUCTRL sprite size mode
+func (ppu *ppu) spriteHeight() int {
+	if (ppu.regs.ppuctrl & SPRITE_SIZE_MASK) != 0 {
+		return 2 * size_TILE
+	}
+	return size_TILE
+}
+
+// prepareLine fetches the background tiles and evaluates the sprites of visible
+// scanline y, filling the line buffers that outputPixel draws from. Pixels are
+// stored as palette RAM indices, with 0 meaning transparent.
+func (ppu *ppu) prepareLine(y uint16) error {
+	for i := 0; i < SCREEN_WIDTH; i++ {
+		ppu.bgLine[i] = 0
+		ppu.spriteLine[i] = 0
+		ppu.spriteBehind[i] = false
+		ppu.spriteZero[i] = false
+	}
+	if !ppu.renderingEnabled() {
+		return nil
+	}
+
+	err := ppu.fetchBackground()
+	if err != nil {
+		return err
+	}
+	return ppu.evaluateSprites(y)
+}
+
+// fetchBackground fetches the background pixels of the scanline starting at v.
+// v itself is left alone; its horizontal bits are reloaded from t at the end of
+// the scanline anyway.
+func (ppu *ppu) fetchBackground() error {
+	var table uint16 = addr_PATTERN_TABLE_0
+	if (ppu.regs.ppuctrl & BG_PATTERN_TABLE_MASK) != 0 {
+		table = addr_PATTERN_TABLE_1
+	}
+
+	v := ppu.v
+	fineY := (v & scroll_FINE_Y_MASK) >> 12
+	for tile := 0; tile < num_LINE_TILES; tile++ {
+		id, err := ppu.read(addr_NAMETABLE_0 | (v & 0x0FFF))
+		if err != nil {
+			return err
+		}
+		attr, err := ppu.read((addr_NAMETABLE_0 + offset_ATTRIBUTES) | (v & 0x0C00) | ((v >> 4) & 0x38) | ((v >> 2) & 0x07))
+		if err != nil {
+			return err
+		}
+		shift := ((v >> 4) & 0x4) | (v & 0x2)
+		palette := (attr >> shift) & 0x3
+
+		lo, hi, err := ppu.tileRow(table, id, fineY)
+		if err != nil {
+			return err
+		}
+		for col := 0; col < size_TILE; col++ {
+			x := tile*size_TILE + col - int(ppu.x)
+			if x < 0 || x >= SCREEN_WIDTH {
+				continue
+			}
+			bit := uint(7 - col)
+			index := ((lo >> bit) & 1) | (((hi >> bit) & 1) << 1)
+			if index != 0 {
+				ppu.bgLine[x] = palette<<2 | index
+			}
+		}
+
+		// Move to the next tile, wrapping into the horizontally adjacent nametable
+		if (v & scroll_COARSE_X_MASK) == scroll_COARSE_X_MASK {
+			v &^= scroll_COARSE_X_MASK
+			v ^= scroll_NAMETABLE_X
+		} else {
+			v++
+		}
+	}
+	return nil
+}
+
+// evaluateSprites finds the sprites in range of scanline y and draws them into
+// the sprite line buffer. Sprites are drawn one scanline below their OAM Y
+// coordinate, and earlier sprites in OAM take priority over later ones.
+func (ppu *ppu) evaluateSprites(y uint16) error {
+	height := ppu.spriteHeight()
+	found := 0
+	for i := 0; i < num_SPRITES; i++ {
+		entry := ppu.oam[i*4 : i*4+4]
+		row := int(y) - 1 - int(entry[0])
+		if row < 0 || row >= height {
+			continue
+		}
+
+		found++
+		if found > num_LINE_SPRITES {
+			// The overflow flag is always set, so games that rely on it behave
+			// the same with the sprite limit removed.
+			ppu.regs.ppustatus |= SPRITE_OVERFLOW_BIT_MASK
+			if !ppu.options.NoSpriteLimit {
+				break
+			}
+		}
+
+		err := ppu.drawSpriteRow(i, entry, row, height)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drawSpriteRow draws row 'row' of sprite i into the sprite line buffer,
+// underneath any sprites already drawn there.
+func (ppu *ppu) drawSpriteRow(i int, entry []uint8, row, height int) error {
+	tile, attr, x := entry[1], entry[2], entry[3]
+	if (attr & SPRITE_FLIP_V_MASK) != 0 {
+		row = height - 1 - row
+	}
+
+	var table uint16 = addr_PATTERN_TABLE_0
+	if height == 2*size_TILE {
+		// 8x16 sprites take their pattern table from bit 0 of the tile number
+		table = uint16(tile&0x1) * addr_PATTERN_TABLE_1
+		tile &= 0xFE
+		if row >= size_TILE {
+			tile++
+			row -= size_TILE
+		}
+	} else if (ppu.regs.ppuctrl & SPRITE_PATTERN_TABLE_MASK) != 0 {
+		table = addr_PATTERN_TABLE_1
+	}
+
+	lo, hi, err := ppu.tileRow(table, tile, uint16(row))
+	if err != nil {
+		return err
+	}
+	for col := 0; col < size_TILE; col++ {
+		px := int(x) + col
+		if px >= SCREEN_WIDTH {
+			break
+		}
+		bit := uint(7 - col)
+		if (attr & SPRITE_FLIP_H_MASK) != 0 {
+			bit = uint(col)
+		}
+		index := ((lo >> bit) & 1) | (((hi >> bit) & 1) << 1)
+		if index == 0 || ppu.spriteLine[px] != 0 {
+			continue
+		}
+		ppu.spriteLine[px] = offset_SPRITE_PALETTES | (attr&SPRITE_PALETTE_MASK)<<2 | index
+		ppu.spriteBehind[px] = (attr & SPRITE_PRIORITY_MASK) != 0
+		ppu.spriteZero[px] = i == 0
+	}
+	return nil
+}
+
+// stepScroll updates v the way the PPU's scroll counters do on the current dot
+// of a visible or pre-render scanline.
+func (ppu *ppu) stepScroll() {
+	if !ppu.renderingEnabled() {
+		return
+	}
+	dot := ppu.currentScanlineCycle
+	if dot == SCREEN_WIDTH {
+		ppu.incrementY()
+	} else if dot == SCREEN_WIDTH+1 {
+		ppu.v = (ppu.v &^ scroll_HORIZONTAL_MASK) | (ppu.t & scroll_HORIZONTAL_MASK)
+	} else if ppu.currentScanline == 261 && dot >= 280 && dot <= 304 {
+		ppu.v = (ppu.v &^ scroll_VERTICAL_MASK) | (ppu.t & scroll_VERTICAL_MASK)
+	}
+}
+
+// incrementY moves v down one pixel, wrapping into the vertically adjacent nametable
+// after the last row of tiles.
+func (ppu *ppu) incrementY() {
+	if (ppu.v & scroll_FINE_Y_MASK) != scroll_FINE_Y_MASK {
+		ppu.v += 0x1000
+		return
+	}
+	ppu.v &^= scroll_FINE_Y_MASK
+	coarseY := (ppu.v & scroll_COARSE_Y_MASK) >> 5
+	if coarseY == 29 {
+		coarseY = 0
+		ppu.v ^= scroll_NAMETABLE_Y
+	} else if coarseY == 31 {
+		// Coarse Y can be set out of range through PPUSCROLL; it wraps without
+		// switching nametables
+		coarseY = 0
+	} else {
+		coarseY++
+	}
+	ppu.v = (ppu.v &^ scroll_COARSE_Y_MASK) | (coarseY << 5)
+}
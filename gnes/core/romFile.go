@@ -0,0 +1,144 @@
+package gnes
+
+import "archive/zip"
+import "bytes"
+import "compress/gzip"
+import "io"
+import "io/ioutil"
+import "path"
+import "strings"
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+	fdsMagic  = []byte("FDS\x1a")
+	inesMagic = []byte("NES\x1a")
+)
+
+// romFile_MAX_SIZE caps how much is read of a ROM, or unpacked from an archive.
+// It's well above the largest NES 2.0 ROM that isn't a placeholder, so only
+// a broken file or a decompression bomb gets near it.
+const romFile_MAX_SIZE = 128 << 20
+
+// romExtensions are the entries picked out of zip files
+var romExtensions = []string{".nes", ".fds", ".nsf", ".nsfe"}
+
+// isRomName returns whether a file name has one of romExtensions
+func isRomName(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, romExt := range romExtensions {
+		if ext == romExt {
+			return true
+		}
+	}
+	return false
+}
+
+// readRom reads all of r, failing if it's more than romFile_MAX_SIZE
+func readRom(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, romFile_MAX_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > romFile_MAX_SIZE {
+		return nil, gError1New(err_ROM_TOO_LARGE, romFile_MAX_SIZE)
+	}
+	return data, nil
+}
+
+// unpackRom returns the ROM inside a zip or gzip file, and its name. Anything
+// else is returned as it is.
+func unpackRom(data []byte, name, entry string) ([]byte, string, error) {
+	if bytes.HasPrefix(data, zipMagic) {
+		return unzipRom(data, entry)
+	}
+	if bytes.HasPrefix(data, gzipMagic) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", err
+		}
+		defer reader.Close()
+		rom, err := readRom(reader)
+		if err != nil {
+			return nil, "", err
+		}
+		// The gzip header may know the original name, otherwise "game.nes.gz"
+		// held "game.nes"
+		inner := reader.Name
+		if inner == "" {
+			inner = strings.TrimSuffix(name, path.Ext(name))
+		}
+		return rom, inner, nil
+	}
+	return data, name, nil
+}
+
+// unzipRom returns the named entry of a zip file, or the first ROM if entry is
+// empty
+func unzipRom(data []byte, entry string) ([]byte, string, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, "", err
+	}
+	for _, file := range reader.File {
+		if entry == "" && !isRomName(file.Name) || entry != "" && file.Name != entry {
+			continue
+		}
+		contents, err := file.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		defer contents.Close()
+		rom, err := readRom(contents)
+		if err != nil {
+			return nil, "", err
+		}
+		return rom, file.Name, nil
+	}
+	if entry != "" {
+		return nil, "", &gError{err_ARCHIVE_ENTRY_NOT_FOUND}
+	}
+	return nil, "", &gError{err_NO_ROM_IN_ARCHIVE}
+}
+
+// ArchiveEntries lists the files in a zip file, for choosing one to load with
+// LoadOptions.ArchiveEntry.
+func ArchiveEntries(data []byte) ([]string, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	return names, nil
+}
+
+// NewEmulatorFromBytes loads a ROM held in memory. The name is used like a
+// path would be, for the movie ROM name and to name a gzipped ROM, and can be
+// empty. Zip and gzip files are unpacked: from a zip file, the entry named
+// in options.ArchiveEntry is loaded, or the first .nes, .fds, .nsf or .nsfe file.
+// A ROM unpacked from an archive can't be more than 128 MiB.
+func NewEmulatorFromBytes(data []byte, name string, options LoadOptions) (*Emulator, error) {
+	rom, name, err := unpackRom(data, name, options.ArchiveEntry)
+	if err != nil {
+		return nil, err
+	}
+	emu := newEmulator()
+	err = emu.loadRom(rom, name, options)
+	if err != nil {
+		return nil, err
+	}
+	return emu, nil
+}
+
+// NewEmulatorFromReader loads a ROM read from r, like NewEmulatorFromBytes.
+// What r holds can't be more than 128 MiB either.
+func NewEmulatorFromReader(r io.Reader, name string, options LoadOptions) (*Emulator, error) {
+	data, err := readRom(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewEmulatorFromBytes(data, name, options)
+}
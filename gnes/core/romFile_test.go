@@ -0,0 +1,90 @@
+package gnes
+
+import "archive/zip"
+import "bytes"
+import "compress/gzip"
+import "io"
+import "testing"
+
+// writeZeros writes 'size' zero bytes to w
+func writeZeros(t *testing.T, w io.Writer, size int) {
+	zeros := make([]byte, 1<<20)
+	for size > 0 {
+		n := len(zeros)
+		if size < n {
+			n = size
+		}
+		if _, err := w.Write(zeros[:n]); err != nil {
+			t.Fatal(err)
+		}
+		size -= n
+	}
+}
+
+func gzipRom(t *testing.T, rom []byte, padding int) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Name = "inner.nes"
+	w.Write(rom)
+	writeZeros(t, w, padding)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipRom(t *testing.T, rom []byte, padding int) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	readme, _ := w.Create("readme.txt")
+	readme.Write([]byte("not a ROM"))
+	f, err := w.Create("game.nes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(rom)
+	writeZeros(t, f, padding)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUnpackRom(t *testing.T) {
+	rom := testNrom()
+	tests := []struct {
+		name, wantName string
+		data           []byte
+	}{
+		{"game.nes", "game.nes", rom},
+		{"game.nes.gz", "inner.nes", gzipRom(t, rom, 0)},
+		{"game.zip", "game.nes", zipRom(t, rom, 0)},
+	}
+	for _, test := range tests {
+		unpacked, name, err := unpackRom(test.data, test.name, "")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if name != test.wantName || !bytes.Equal(unpacked, rom) {
+			t.Errorf("%s: unpacked %d bytes named %q", test.name, len(unpacked), name)
+		}
+	}
+	if _, _, err := unpackRom(tests[2].data, "game.zip", "missing.nes"); err == nil {
+		t.Error("unpacked a missing zip entry")
+	}
+}
+
+func TestUnpackRomTooLarge(t *testing.T) {
+	rom := testNrom()
+	padding := romFile_MAX_SIZE + 1 - len(rom)
+	archives := map[string][]byte{
+		"game.nes.gz": gzipRom(t, rom, padding),
+		"game.zip":    zipRom(t, rom, padding),
+	}
+	for name, data := range archives {
+		if _, _, err := unpackRom(data, name, ""); err == nil {
+			t.Errorf("%s: unpacked a ROM past the size limit", name)
+		}
+	}
+}
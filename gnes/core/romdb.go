@@ -0,0 +1,308 @@
+package gnes
+
+import "bufio"
+import "crypto/sha1"
+import "encoding/hex"
+import "fmt"
+import "hash/crc32"
+import "io"
+import "os"
+import "strconv"
+import "strings"
+import "sync"
+
+// Header fields a ROM database entry can override
+const (
+	romdb_MAPPER = 1 << iota
+	romdb_SUBMAPPER
+	romdb_MIRROR
+	romdb_FOUR_SCREEN
+	romdb_PRG_RAM
+	romdb_PRG_NVRAM
+	romdb_CHR_RAM
+	romdb_CHR_NVRAM
+	romdb_BATTERY
+	romdb_REGION
+)
+
+var systemNames = map[uint32]string{
+	SYS_NTSC:     "NTSC",
+	SYS_PAL:      "PAL",
+	SYS_NTSC_PAL: "NTSC/PAL",
+}
+
+// romDbEntry describes a game identified by the hash of its PRG and CHR ROM,
+// and the header it should have.
+type romDbEntry struct {
+	title  string
+	sha1   string
+	crc    uint32
+	hasCrc bool
+
+	// fields is a mask of the romdb_ fields the entry overrides
+	fields uint32
+	mapper,
+	submapper,
+	prgRamSize,
+	prgNvramSize,
+	chrRamSize,
+	chrNvramSize,
+	timing uint32
+	mirror,
+	fourScreen,
+	battery bool
+}
+
+// romDb holds the database, indexed both ways. It starts out with the
+// embedded entries, and LoadRomDatabase adds to it.
+var romDb struct {
+	once   sync.Once
+	lock   sync.Mutex
+	bySha1 map[string]*romDbEntry
+	byCrc  map[uint32]*romDbEntry
+}
+
+// initRomDb loads the embedded entries, which are checked into the source, so
+// any failure is a bug
+func initRomDb() {
+	romDb.bySha1 = make(map[string]*romDbEntry)
+	romDb.byCrc = make(map[uint32]*romDbEntry)
+	if err := addRomDbEntries(strings.NewReader(romDbData)); err != nil {
+		panic(err)
+	}
+}
+
+// addRomDbEntries parses a database and adds its entries, replacing any for
+// the same ROMs. Nothing is added if any line is malformed.
+func addRomDbEntries(r io.Reader) error {
+	var entries []*romDbEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry, err := parseRomDbEntry(text)
+		if err != nil {
+			return gError1New(err_BAD_ROMDB_ENTRY, uint64(line))
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	romDb.lock.Lock()
+	defer romDb.lock.Unlock()
+	for _, entry := range entries {
+		if entry.sha1 != "" {
+			romDb.bySha1[entry.sha1] = entry
+		}
+		if entry.hasCrc {
+			romDb.byCrc[entry.crc] = entry
+		}
+	}
+	return nil
+}
+
+// parseRomDbEntry parses one line of a database: key=value fields separated by
+// '|'. See romDbData for the keys.
+func parseRomDbEntry(text string) (*romDbEntry, error) {
+	entry := &romDbEntry{}
+	for _, field := range strings.Split(text, "|") {
+		i := strings.IndexByte(field, '=')
+		if i < 0 {
+			return nil, &gError{err_BAD_ROMDB_ENTRY}
+		}
+		key := strings.ToLower(strings.TrimSpace(field[:i]))
+		val := strings.TrimSpace(field[i+1:])
+
+		var err error
+		switch key {
+		case "title":
+			entry.title = val
+		case "sha1":
+			var sum []byte
+			sum, err = hex.DecodeString(val)
+			if err == nil && len(sum) != sha1.Size {
+				err = &gError{err_BAD_ROMDB_ENTRY}
+			}
+			entry.sha1 = hex.EncodeToString(sum)
+		case "crc":
+			var crc uint64
+			crc, err = strconv.ParseUint(val, 16, 32)
+			entry.crc = uint32(crc)
+			entry.hasCrc = true
+		case "mapper":
+			entry.mapper, err = parseRomDbNumber(val)
+			entry.fields |= romdb_MAPPER
+		case "submapper":
+			entry.submapper, err = parseRomDbNumber(val)
+			entry.fields |= romdb_SUBMAPPER
+		case "prgram":
+			entry.prgRamSize, err = parseRomDbNumber(val)
+			entry.fields |= romdb_PRG_RAM
+		case "prgnvram":
+			entry.prgNvramSize, err = parseRomDbNumber(val)
+			entry.fields |= romdb_PRG_NVRAM
+		case "chrram":
+			entry.chrRamSize, err = parseRomDbNumber(val)
+			entry.fields |= romdb_CHR_RAM
+		case "chrnvram":
+			entry.chrNvramSize, err = parseRomDbNumber(val)
+			entry.fields |= romdb_CHR_NVRAM
+		case "mirror":
+			switch strings.ToLower(val) {
+			case "horizontal":
+			case "vertical":
+				entry.mirror = true
+			case "four":
+				entry.fourScreen = true
+			default:
+				err = &gError{err_BAD_ROMDB_ENTRY}
+			}
+			entry.fields |= romdb_MIRROR | romdb_FOUR_SCREEN
+		case "battery":
+			entry.battery, err = strconv.ParseBool(val)
+			entry.fields |= romdb_BATTERY
+		case "region":
+			switch strings.ToLower(val) {
+			case "ntsc":
+				entry.timing = TIMING_NTSC
+			case "pal":
+				entry.timing = TIMING_PAL
+			case "multi":
+				entry.timing = TIMING_MULTI
+			case "dendy":
+				entry.timing = TIMING_DENDY
+			default:
+				err = &gError{err_BAD_ROMDB_ENTRY}
+			}
+			entry.fields |= romdb_REGION
+		default:
+			err = &gError{err_BAD_ROMDB_ENTRY}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if entry.sha1 == "" && !entry.hasCrc {
+		return nil, &gError{err_BAD_ROMDB_ENTRY}
+	}
+	return entry, nil
+}
+
+func parseRomDbNumber(val string) (uint32, error) {
+	n, err := strconv.ParseUint(val, 0, 32)
+	return uint32(n), err
+}
+
+// lookupRomDb finds the entry for some PRG and CHR ROM. SHA-1 matches win over
+// CRC32 matches.
+func lookupRomDb(prgRom, chrRom []byte) *romDbEntry {
+	romDb.once.Do(initRomDb)
+
+	sha := sha1.New()
+	sha.Write(prgRom)
+	sha.Write(chrRom)
+	crc := crc32.NewIEEE()
+	crc.Write(prgRom)
+	crc.Write(chrRom)
+
+	romDb.lock.Lock()
+	defer romDb.lock.Unlock()
+	if entry, ok := romDb.bySha1[hex.EncodeToString(sha.Sum(nil))]; ok {
+		return entry
+	}
+	return romDb.byCrc[crc.Sum32()]
+}
+
+// applyRomDb identifies the cartridge in the database. If it's found and has an
+// iNES header, the database's fields override the header's, and every change
+// is noted in info.overrides.
+func (info *cartInfo) applyRomDb() {
+	entry := lookupRomDb(info.data.prgRom, info.data.chrRom)
+	if entry == nil {
+		return
+	}
+	info.title = entry.title
+	info.identified = true
+	// NES 2.0 headers are trusted over the database
+	if info.nes2 {
+		return
+	}
+
+	override := func(field uint32, name string, header *uint32, val uint32) {
+		if (entry.fields&field) != 0 && *header != val {
+			info.overrides = append(info.overrides, fmt.Sprintf("%s %d -> %d", name, *header, val))
+			*header = val
+		}
+	}
+	overrideBool := func(field uint32, name string, header *bool, val bool) {
+		if (entry.fields&field) != 0 && *header != val {
+			info.overrides = append(info.overrides, fmt.Sprintf("%s %t -> %t", name, *header, val))
+			*header = val
+		}
+	}
+	override(romdb_MAPPER, "mapper", &info.mapper, entry.mapper)
+	override(romdb_SUBMAPPER, "submapper", &info.submapper, entry.submapper)
+	override(romdb_PRG_RAM, "PRG RAM", &info.prgRamSize, entry.prgRamSize)
+	override(romdb_PRG_NVRAM, "PRG NVRAM", &info.prgNvramSize, entry.prgNvramSize)
+	override(romdb_CHR_RAM, "CHR RAM", &info.chrRamSize, entry.chrRamSize)
+	override(romdb_CHR_NVRAM, "CHR NVRAM", &info.chrNvramSize, entry.chrNvramSize)
+	overrideBool(romdb_MIRROR, "vertical mirroring", &info.mirror, entry.mirror)
+	overrideBool(romdb_FOUR_SCREEN, "four screen", &info.mirrorOverride, entry.fourScreen)
+	overrideBool(romdb_BATTERY, "battery", &info.prgRamBatBacked, entry.battery)
+	if (entry.fields & romdb_REGION) != 0 {
+		system := uint32(SYS_NTSC)
+		switch entry.timing {
+		case TIMING_MULTI:
+			system = SYS_NTSC_PAL
+		case TIMING_PAL, TIMING_DENDY:
+			system = SYS_PAL
+		}
+		if info.system != system {
+			info.overrides = append(info.overrides, fmt.Sprintf("system %s -> %s",
+				systemNames[info.system], systemNames[system]))
+			info.system = system
+		}
+		info.timing = entry.timing
+	}
+	if (entry.fields & (romdb_PRG_RAM | romdb_PRG_NVRAM)) != 0 {
+		info.prgRamPresent = info.prgRamSize+info.prgNvramSize > 0
+	}
+}
+
+/***********************************************/
+/*                ROM database API             */
+/***********************************************/
+
+// LoadRomDatabase adds the entries of a ROM database to the embedded one, for
+// every emulator loaded afterwards. Entries replace any for the same ROM. The
+// format is described in romDbData.
+func LoadRomDatabase(r io.Reader) error {
+	romDb.once.Do(initRomDb)
+	return addRomDbEntries(r)
+}
+
+// LoadRomDatabaseFile adds the entries of a ROM database file, like
+// LoadRomDatabase.
+func LoadRomDatabaseFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return LoadRomDatabase(file)
+}
+
+// GameTitle returns the title of the game, if the ROM database identified it.
+func (emu *Emulator) GameTitle() (string, bool) {
+	return emu.info.title, emu.info.identified
+}
+
+// HeaderOverrides describes each header field the ROM database corrected, e.g.
+// "mapper 4 -> 1". It's empty if nothing was changed.
+func (emu *Emulator) HeaderOverrides() []string {
+	return emu.info.overrides
+}
@@ -0,0 +1,32 @@
+package gnes
+
+// romDbData is the embedded ROM database. Each line describes one game, as
+// key=value fields separated by '|', e.g.
+//
+//	sha1=<40 hex digits> | crc=<8 hex digits> | title=Name | mapper=1 | mirror=vertical
+//
+// Games are identified by the SHA-1 or CRC32 of their PRG ROM followed by
+// their CHR ROM, without the header. An entry needs at least one of the two.
+// Every other field is optional, and overrides the iNES header when present:
+//
+//	title      the game's title
+//	mapper     the iNES mapper number
+//	submapper  the NES 2.0 submapper
+//	mirror     horizontal, vertical or four
+//	prgram     volatile PRG RAM, in bytes
+//	prgnvram   battery backed PRG RAM, in bytes
+//	chrram     volatile CHR RAM, in bytes
+//	chrnvram   battery backed CHR RAM, in bytes
+//	battery    true or false
+//	region     ntsc, pal, multi or dendy
+//
+// Blank lines and lines starting with '#' are ignored. Local databases in the
+// same format can be added with LoadRomDatabase. Only add hashes checked
+// against a real dump.
+//
+// No entries have been verified yet, so until they are, games are only
+// identified, and their headers corrected, by a database loaded with
+// LoadRomDatabase.
+const romDbData = `
+# Verified entries go here
+`
@@ -0,0 +1,144 @@
+package gnes
+
+import "reflect"
+import "strings"
+import "testing"
+
+// testDbRom builds a 16K NROM whose PRG and CHR bytes are i*prg and i*chr, to
+// match the entries in testdata/romdb.txt
+func testDbRom(prg, chr int) []byte {
+	rom := testNrom()
+	for i := 0; i < PRG_ROM_SIZE; i++ {
+		rom[HEADER_SIZE+i] = uint8(i * prg)
+	}
+	for i := 0; i < CHR_ROM_SIZE; i++ {
+		rom[HEADER_SIZE+PRG_ROM_SIZE+i] = uint8(i * chr)
+	}
+	return rom
+}
+
+func loadTestRomDb(t *testing.T) {
+	if err := LoadRomDatabaseFile("testdata/romdb.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseRomDbEntry(t *testing.T) {
+	const sha = "sha1=a687d3f25d0fd4c40f0cba99df359f3d50c2e494"
+	entry, err := parseRomDbEntry(sha + " | CRC=17c55f22 | title=A | mapper=0x10 | submapper=2 | mirror=four | prgram=8192 | chrnvram=0 | battery=1 | region=dendy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &romDbEntry{
+		title:      "A",
+		sha1:       "a687d3f25d0fd4c40f0cba99df359f3d50c2e494",
+		crc:        0x17C55F22,
+		hasCrc:     true,
+		fields:     romdb_MAPPER | romdb_SUBMAPPER | romdb_MIRROR | romdb_FOUR_SCREEN | romdb_PRG_RAM | romdb_CHR_NVRAM | romdb_BATTERY | romdb_REGION,
+		mapper:     16,
+		submapper:  2,
+		prgRamSize: 8192,
+		timing:     TIMING_DENDY,
+		fourScreen: true,
+		battery:    true,
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("parsed %+v, want %+v", entry, want)
+	}
+
+	bad := []string{
+		"title=No hash",
+		"sha1=a687d3f25d0fd4c40f0cba99df359f3d50c2e4",
+		"sha1=z687d3f25d0fd4c40f0cba99df359f3d50c2e494",
+		"crc=17C55F2G",
+		"crc=117C55F22",
+		sha + " | mirror=diagonal",
+		sha + " | region=secam",
+		sha + " | mapper=two",
+		sha + " | battery=maybe",
+		sha + " | colour=red",
+		sha + " | mapper",
+	}
+	for _, text := range bad {
+		if _, err := parseRomDbEntry(text); err == nil {
+			t.Errorf("parsed %q", text)
+		}
+	}
+
+	// A bad line stops the whole database from loading
+	err = LoadRomDatabase(strings.NewReader("# comment\n\ncrc=00000001 | title=Fine\ncrc=nothex\n"))
+	if err == nil {
+		t.Error("loaded a database with a bad line")
+	}
+	romDb.lock.Lock()
+	_, added := romDb.byCrc[1]
+	romDb.lock.Unlock()
+	if added {
+		t.Error("a database with a bad line was partly added")
+	}
+}
+
+func TestApplyRomDb(t *testing.T) {
+	loadTestRomDb(t)
+	emu, err := NewEmulatorFromBytes(testDbRom(7, 3), "test.nes", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title, ok := emu.GameTitle(); !ok || title != "Test Cart" {
+		t.Errorf("identified as %q, %t", title, ok)
+	}
+	overrides := []string{
+		"mapper 0 -> 2",
+		"PRG NVRAM 0 -> 8192",
+		"vertical mirroring false -> true",
+		"battery false -> true",
+		"system NTSC -> PAL",
+	}
+	if !reflect.DeepEqual(emu.HeaderOverrides(), overrides) {
+		t.Errorf("overrides %q, want %q", emu.HeaderOverrides(), overrides)
+	}
+	info := emu.info
+	if info.mapper != 2 || !info.mirror || !info.prgRamBatBacked || info.prgNvramSize != 8192 ||
+		!info.prgRamPresent || info.system != SYS_PAL || info.timing != TIMING_PAL {
+		t.Errorf("loaded %+v", *info)
+	}
+
+	emu, err = NewEmulatorFromBytes(testDbRom(5, 1), "test.nes", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title, ok := emu.GameTitle(); !ok || title != "CRC Cart" {
+		t.Errorf("CRC32 match identified as %q, %t", title, ok)
+	}
+	if emu.info.system != SYS_NTSC_PAL || len(emu.HeaderOverrides()) != 1 {
+		t.Errorf("CRC32 match has system %d and overrides %q", emu.info.system, emu.HeaderOverrides())
+	}
+
+	emu, err = NewEmulatorFromBytes(testDbRom(1, 1), "test.nes", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := emu.GameTitle(); ok || len(emu.HeaderOverrides()) != 0 {
+		t.Error("an unknown ROM was identified")
+	}
+}
+
+func TestRomDbNES2PassThrough(t *testing.T) {
+	loadTestRomDb(t)
+	rom := testDbRom(7, 3)
+	rom[7] |= NES2_FLAG
+	emu, err := NewEmulatorFromBytes(rom, "test.nes", LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title, ok := emu.GameTitle(); !ok || title != "Test Cart" {
+		t.Errorf("identified as %q, %t", title, ok)
+	}
+	if len(emu.HeaderOverrides()) != 0 {
+		t.Errorf("NES 2.0 header overridden: %q", emu.HeaderOverrides())
+	}
+	info := emu.info
+	if info.mapper != 0 || info.mirror || info.prgRamBatBacked || info.system != SYS_NTSC {
+		t.Errorf("loaded %+v", *info)
+	}
+}
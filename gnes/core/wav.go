@@ -0,0 +1,87 @@
+package gnes
+
+import "encoding/binary"
+import "os"
+
+const (
+	wav_HEADER_SIZE     = 44
+	wav_BITS_PER_SAMPLE = 16
+)
+
+// wavWriter writes 16-bit PCM WAV files. The sizes in the header are filled
+// in when the writer is closed.
+type wavWriter struct {
+	file *os.File
+
+	sampleRate,
+	channels uint32
+
+	dataSize uint32
+}
+
+func newWavWriter(path string, sampleRate, channels int) (*wavWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	wav := &wavWriter{}
+	wav.file = file
+	wav.sampleRate = uint32(sampleRate)
+	wav.channels = uint32(channels)
+
+	err = wav.writeHeader()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return wav, nil
+}
+
+func (wav *wavWriter) writeHeader() error {
+	blockAlign := wav.channels * wav_BITS_PER_SAMPLE / 8
+	header := make([]byte, wav_HEADER_SIZE)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], 36+wav.dataSize)
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], uint16(wav.channels))
+	binary.LittleEndian.PutUint32(header[24:], wav.sampleRate)
+	binary.LittleEndian.PutUint32(header[28:], wav.sampleRate*blockAlign)
+	binary.LittleEndian.PutUint16(header[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:], wav_BITS_PER_SAMPLE)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], wav.dataSize)
+
+	_, err := wav.file.WriteAt(header, 0)
+	return err
+}
+
+// writeSamples writes interleaved samples in the range [-1, 1].
+func (wav *wavWriter) writeSamples(samples []float32) error {
+	buf := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		if sample > 1 {
+			sample = 1
+		} else if sample < -1 {
+			sample = -1
+		}
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(int16(sample*32767)))
+	}
+	_, err := wav.file.WriteAt(buf, int64(wav_HEADER_SIZE+wav.dataSize))
+	if err != nil {
+		return err
+	}
+	wav.dataSize += uint32(len(buf))
+	return nil
+}
+
+func (wav *wavWriter) close() error {
+	err := wav.writeHeader()
+	if err != nil {
+		wav.file.Close()
+		return err
+	}
+	return wav.file.Close()
+}
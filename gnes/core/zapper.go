@@ -0,0 +1,142 @@
+package gnes
+
+const (
+	// Bits the Zapper drives when its port is read
+	ZAPPER_NO_LIGHT_MASK uint8 = 0x08
+	ZAPPER_TRIGGER_MASK  uint8 = 0x10
+
+	// The photodiode sees pixels within this many pixels of the aim point
+	zapper_RADIUS = 3
+
+	// A pixel stops registering once the beam is this many scanlines past it,
+	// as the phosphor and the diode's response fade
+	zapper_SENSE_LINES = 20
+
+	// Minimum brightness of a pixel, out of 255, to register as light
+	zapper_LIGHT_THRESHOLD = 0xC0
+)
+
+// Zapper is the NES light gun. It reports its trigger, and whether the pixels
+// it's aimed at were lit by the beam just now, which games use to find out
+// what's being pointed at.
+type Zapper struct {
+	// The emulator's PPU is looked up on every read, since it's replaced when
+	// the console is power cycled
+	emu *Emulator
+
+	// The aim point, in the full 256x240 frame. It's off screen if either is
+	// negative.
+	x,
+	y int
+	trigger bool
+}
+
+// NewZapper creates a Zapper that watches the emulator's picture, aimed off
+// screen.
+func (emu *Emulator) NewZapper() *Zapper {
+	return &Zapper{emu: emu, x: -1, y: -1}
+}
+
+// Aim points the Zapper at (x, y) in the full 256x240 frame, before any
+// overscan is cropped. Negative coordinates point it away from the screen.
+func (zapper *Zapper) Aim(x, y int) {
+	zapper.x = x
+	zapper.y = y
+}
+
+// SetTrigger pulls or releases the trigger.
+func (zapper *Zapper) SetTrigger(pulled bool) {
+	zapper.trigger = pulled
+}
+
+// The Zapper ignores the strobe
+func (zapper *Zapper) Strobe(high bool) {}
+
+func (zapper *Zapper) Read() uint8 {
+	var val uint8
+	if !zapper.senseLight() {
+		val |= ZAPPER_NO_LIGHT_MASK
+	}
+	if zapper.trigger {
+		val |= ZAPPER_TRIGGER_MASK
+	}
+	return val
+}
+
+// senseLight returns whether any bright pixel near the aim point has been
+// drawn in the last few scanlines
+func (zapper *Zapper) senseLight() bool {
+	if zapper.x < 0 || zapper.y < 0 || zapper.x >= SCREEN_WIDTH || zapper.y >= SCREEN_HEIGHT {
+		return false
+	}
+	for y := zapper.y - zapper_RADIUS; y <= zapper.y+zapper_RADIUS; y++ {
+		for x := zapper.x - zapper_RADIUS; x <= zapper.x+zapper_RADIUS; x++ {
+			if x < 0 || y < 0 || x >= SCREEN_WIDTH || y >= SCREEN_HEIGHT {
+				continue
+			}
+			pixel, ok := zapper.emu.ppu.recentPixel(x, y, zapper_SENSE_LINES)
+			if ok && pixelBrightness(pixel) >= zapper_LIGHT_THRESHOLD {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recentPixel returns the pixel at (x, y) if the beam drew it within the last
+// 'lines' scanlines.
+func (ppu *ppu) recentPixel(x, y, lines int) (uint16, bool) {
+	now := int(ppu.currentScanline)*num_SCANLINE_DOTS + int(ppu.currentScanlineCycle)
+	// Pixel x is output on dot x+1
+	drawn := y*num_SCANLINE_DOTS + x + 1
+	if ppu.currentScanline == num_SCANLINES-1 || drawn >= now || now-drawn > lines*num_SCANLINE_DOTS {
+		return 0, false
+	}
+	// Once the post-render line starts, the frame has moved to lastFrame
+	frame := ppu.frame
+	if now > SCREEN_HEIGHT*num_SCANLINE_DOTS {
+		frame = ppu.lastFrame
+	}
+	return frame[y*SCREEN_WIDTH+x], true
+}
+
+// pixelBrightness returns the luma of a 9-bit pixel, from 0 to 255
+func pixelBrightness(pixel uint16) int {
+	c := pixelToRGBA(pixel)
+	return (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+}
+
+/***********************************************/
+/*                 Zapper API                  */
+/***********************************************/
+
+func (emu *Emulator) zapper(port int) (*Zapper, error) {
+	if err := checkPort(port); err != nil {
+		return nil, err
+	}
+	zapper, ok := emu.mmu.ports[port].(*Zapper)
+	if !ok {
+		return nil, gError1New(err_NOT_ZAPPER, uint64(port))
+	}
+	return zapper, nil
+}
+
+// AimZapper aims the Zapper in 'port' at (x, y), see Zapper.Aim.
+func (emu *Emulator) AimZapper(port, x, y int) error {
+	zapper, err := emu.zapper(port)
+	if err != nil {
+		return err
+	}
+	zapper.Aim(x, y)
+	return nil
+}
+
+// SetZapperTrigger pulls or releases the trigger of the Zapper in 'port'.
+func (emu *Emulator) SetZapperTrigger(port int, pulled bool) error {
+	zapper, err := emu.zapper(port)
+	if err != nil {
+		return err
+	}
+	zapper.SetTrigger(pulled)
+	return nil
+}
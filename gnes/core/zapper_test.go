@@ -0,0 +1,96 @@
+package gnes
+
+import "testing"
+
+// zapperSeesLight draws a white frame, puts the beam a few lines below the aim
+// point and returns whether the Zapper in 'port' senses light. The frame is
+// blanked again afterwards, so a Zapper still watching this PPU later sees
+// nothing.
+func zapperSeesLight(t *testing.T, emu *Emulator, port int) bool {
+	ppu := emu.ppu
+	for i := range ppu.frame {
+		ppu.frame[i] = 0x30
+	}
+	ppu.currentScanline = 110
+	ppu.currentScanlineCycle = 0
+	if err := emu.AimZapper(port, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	device, err := emu.GetInputDevice(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := device.Read()&ZAPPER_NO_LIGHT_MASK == 0
+	for i := range ppu.frame {
+		ppu.frame[i] = 0x0F
+	}
+	return seen
+}
+
+func TestZapperAfterPowerCycle(t *testing.T) {
+	emu := testEmulator(t)
+	if err := emu.SetInputDevice(PORT_2, emu.NewZapper()); err != nil {
+		t.Fatal(err)
+	}
+	if !zapperSeesLight(t, emu, PORT_2) {
+		t.Fatal("Zapper doesn't see a white screen")
+	}
+	if err := emu.Power(); err != nil {
+		t.Fatal(err)
+	}
+	if !zapperSeesLight(t, emu, PORT_2) {
+		t.Error("Zapper doesn't see a white screen after a power cycle")
+	}
+	if err := emu.StartMovieRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if !zapperSeesLight(t, emu, PORT_2) {
+		t.Error("Zapper doesn't see a white screen while recording a movie")
+	}
+}
+
+func TestZapperRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		x, y    int
+		trigger bool
+		want    uint8
+	}{
+		{"aimed at the screen", 100, 100, false, 0},
+		{"trigger pulled", 100, 100, true, ZAPPER_TRIGGER_MASK},
+		{"aimed away", -1, -1, false, ZAPPER_NO_LIGHT_MASK},
+		{"aimed away, trigger pulled", -1, -1, true, ZAPPER_NO_LIGHT_MASK | ZAPPER_TRIGGER_MASK},
+		{"past the right edge", SCREEN_WIDTH, 100, false, ZAPPER_NO_LIGHT_MASK},
+		{"past the bottom edge", 100, SCREEN_HEIGHT, true, ZAPPER_NO_LIGHT_MASK | ZAPPER_TRIGGER_MASK},
+		{"below the beam", 100, 120, false, ZAPPER_NO_LIGHT_MASK},
+		{"faded", 100, 110 - zapper_SENSE_LINES - zapper_RADIUS - 1, false, ZAPPER_NO_LIGHT_MASK},
+	}
+	emu := testEmulator(t)
+	if err := emu.SetInputDevice(PORT_2, emu.NewZapper()); err != nil {
+		t.Fatal(err)
+	}
+	ppu := emu.ppu
+	for i := range ppu.frame {
+		ppu.frame[i] = 0x30
+	}
+	ppu.currentScanline = 110
+	for _, test := range tests {
+		if err := emu.AimZapper(PORT_2, test.x, test.y); err != nil {
+			t.Fatal(err)
+		}
+		if err := emu.SetZapperTrigger(PORT_2, test.trigger); err != nil {
+			t.Fatal(err)
+		}
+		val, err := emu.mmu.read(JOY2_ADDR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val&JOY_DATA_MASK != test.want {
+			t.Errorf("%s: read $%02X, want $%02X", test.name, val&JOY_DATA_MASK, test.want)
+		}
+	}
+
+	if err := emu.AimZapper(PORT_1, 0, 0); err == nil {
+		t.Error("aimed a standard controller")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/chzyer/readline"
+	"image"
 	"strconv"
 	"strings"
 )
@@ -52,6 +53,15 @@ func newDebugger(path string) (*debugger, error) {
 	if err != nil {
 		return nil, err
 	}
+	if title, ok := emu.GameTitle(); ok {
+		fmt.Printf("Identified %s\n", title)
+	}
+	for _, override := range emu.HeaderOverrides() {
+		fmt.Printf("ROM database corrected the header: %s\n", override)
+	}
+	for _, problem := range emu.LoadReport().Problems {
+		fmt.Println(problem)
+	}
 	dbg.emu = emu
 	return dbg, nil
 }
@@ -99,6 +109,51 @@ func (dbg *debugger) createCmdMap() error {
 	dbg.cmdFuncMap["c"] = continueExecution
 	dbg.cmdHelpMap["c"] = "Continue execution until reaching a breakpoint"
 
+	dbg.cmdFuncMap["fd"] = cmdDumpFrame
+	dbg.cmdHelpMap["fd"] = "Dump the last completed frame to a PNG file 'path' (fd [path])"
+
+	dbg.cmdFuncMap["dpt"] = cmdDumpPatternTables
+	dbg.cmdHelpMap["dpt"] = "Dump both pattern tables using palette 'pal' (0-7) to a PNG file (dpt path [pal])"
+
+	dbg.cmdFuncMap["dnt"] = cmdDumpNametables
+	dbg.cmdHelpMap["dnt"] = "Dump all four nametables with the scroll area outlined to a PNG file (dnt path)"
+
+	dbg.cmdFuncMap["doam"] = cmdDumpOAM
+	dbg.cmdHelpMap["doam"] = "List all sprites in OAM, and dump their previews to a PNG file (doam [path])"
+
+	dbg.cmdFuncMap["dpal"] = cmdDumpPalette
+	dbg.cmdHelpMap["dpal"] = "Dump palette RAM as swatches to a PNG file (dpal path)"
+
+	dbg.cmdFuncMap["rec"] = cmdStartRecording
+	dbg.cmdHelpMap["rec"] = "Record every nth frame to an animated .gif or .png file (rec path [n])"
+
+	dbg.cmdFuncMap["recstop"] = cmdStopRecording
+	dbg.cmdHelpMap["recstop"] = "Stop recording and write the animation to disk"
+
+	dbg.cmdFuncMap["arec"] = cmdStartAudioRecording
+	dbg.cmdHelpMap["arec"] = "Record audio to a WAV file for 'frames' frames, or until stopped, optionally one file per channel (arec path [frames] [stems])"
+
+	dbg.cmdFuncMap["arecstop"] = cmdStopAudioRecording
+	dbg.cmdHelpMap["arecstop"] = "Stop recording audio and close the WAV file(s)"
+
+	dbg.cmdFuncMap["mute"] = cmdMuteChannels
+	dbg.cmdHelpMap["mute"] = "Mute the named channels, or unmute all if none are named (mute [pulse1|pulse2|triangle|noise|dmc ...])"
+
+	dbg.cmdFuncMap["solo"] = cmdSoloChannels
+	dbg.cmdHelpMap["solo"] = "Solo the named channels, or turn solo off if none are named (solo [pulse1|pulse2|triangle|noise|dmc ...])"
+
+	dbg.cmdFuncMap["macrodef"] = cmdDefineMacro
+	dbg.cmdHelpMap["macrodef"] = "Define a macro as steps of buttons held for some frames, e.g. 'macrodef menu down:2 -:2 a:1' (macrodef name buttons:frames ...)"
+
+	dbg.cmdFuncMap["macro"] = cmdRunMacro
+	dbg.cmdHelpMap["macro"] = "Play a macro on a controller, port 1 by default (macro name [port])"
+
+	dbg.cmdFuncMap["turbo"] = cmdSetTurbo
+	dbg.cmdHelpMap["turbo"] = "Hold turbo buttons on a controller, or release them if none are given (turbo port [buttons])"
+
+	dbg.cmdFuncMap["turboperiod"] = cmdSetTurboPeriod
+	dbg.cmdHelpMap["turboperiod"] = "Set the number of frames a turbo press and release take (turboperiod frames)"
+
 	return nil
 }
 
@@ -330,6 +385,291 @@ func cmdReadN(dbg *debugger, input string) error {
 	return nil
 }
 
+func cmdDumpFrame(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) > 1 {
+		return errors.New("Command takes at most a single path argument")
+	}
+	path := fmt.Sprintf("frame_%d.png", dbg.emu.GetFrameNumber())
+	if len(args) == 1 {
+		path = args[0]
+	}
+	err := dbg.emu.Screenshot(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote frame %d to %s\n", dbg.emu.GetFrameNumber(), path)
+	return nil
+}
+
+func cmdDumpPatternTables(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("Command requires path and optional integer palette args")
+	}
+	palette := uint64(0)
+	if len(args) == 2 {
+		var err error
+		palette, err = strconv.ParseUint(args[1], 10, 8)
+		if err != nil {
+			return errors.New("Second argument must be integer")
+		}
+	}
+	img, err := dbg.emu.PatternTablesImage(int(palette))
+	if err != nil {
+		return err
+	}
+	return writeDebugImage(args[0], img)
+}
+
+func cmdDumpNametables(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) != 1 {
+		return errors.New("Command requires single path argument")
+	}
+	img, err := dbg.emu.NametablesImage()
+	if err != nil {
+		return err
+	}
+	return writeDebugImage(args[0], img)
+}
+
+func cmdDumpOAM(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) > 1 {
+		return errors.New("Command takes at most a single path argument")
+	}
+	for _, sprite := range dbg.emu.GetSprites() {
+		fmt.Printf("    [%02d] X: %3d, Y: %3d, Tile: %#02x, Palette: %d, Behind: %t, FlipH: %t, FlipV: %t\n",
+			sprite.Index, sprite.X, sprite.Y, sprite.Tile, sprite.Palette,
+			sprite.BehindBackground, sprite.FlipHorizontal, sprite.FlipVertical)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	img, err := dbg.emu.SpritesImage()
+	if err != nil {
+		return err
+	}
+	return writeDebugImage(args[0], img)
+}
+
+func cmdDumpPalette(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) != 1 {
+		return errors.New("Command requires single path argument")
+	}
+	return writeDebugImage(args[0], dbg.emu.PaletteImage())
+}
+
+func cmdStartRecording(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("Command requires path and optional integer args")
+	}
+	every := uint64(1)
+	if len(args) == 2 {
+		var err error
+		every, err = strconv.ParseUint(args[1], 10, 16)
+		if err != nil {
+			return errors.New("Second argument must be integer")
+		}
+	}
+	err := dbg.emu.StartRecording(args[0], int(every))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Recording every %d frame(s) to %s\n", every, args[0])
+	return nil
+}
+
+func cmdStopRecording(dbg *debugger, input string) error {
+	err := dbg.emu.StopRecording()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Recording stopped")
+	return nil
+}
+
+func cmdStartAudioRecording(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) < 1 || len(args) > 3 {
+		return errors.New("Command requires path, and optional integer and 'stems' args")
+	}
+	frames := uint64(0)
+	if len(args) >= 2 {
+		var err error
+		frames, err = strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return errors.New("Second argument must be integer")
+		}
+	}
+	stems := false
+	if len(args) == 3 {
+		if args[2] != "stems" {
+			return errors.New("Third argument must be 'stems'")
+		}
+		stems = true
+	}
+	err := dbg.emu.StartAudioRecording(args[0], int(frames), stems)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Recording audio to %s\n", args[0])
+	return nil
+}
+
+func cmdStopAudioRecording(dbg *debugger, input string) error {
+	err := dbg.emu.StopAudioRecording()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Audio recording stopped")
+	return nil
+}
+
+// parseChannels turns channel names into a mask of gnes.CHANNEL_ bits
+func parseChannels(args []string) (uint8, error) {
+	mask := uint8(0)
+	for _, arg := range args {
+		found := false
+		for i, name := range gnes.ChannelNames() {
+			if arg == name {
+				mask |= 1 << uint(i)
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("Unknown channel %s", arg)
+		}
+	}
+	return mask, nil
+}
+
+func cmdMuteChannels(dbg *debugger, input string) error {
+	mask, err := parseChannels(getArgs(input))
+	if err != nil {
+		return err
+	}
+	err = dbg.emu.SetMutedChannels(mask)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Muted channels: %#02x\n", mask)
+	return nil
+}
+
+func cmdSoloChannels(dbg *debugger, input string) error {
+	mask, err := parseChannels(getArgs(input))
+	if err != nil {
+		return err
+	}
+	err = dbg.emu.SetSoloChannels(mask)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Soloed channels: %#02x\n", mask)
+	return nil
+}
+
+func cmdDefineMacro(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) < 2 {
+		return errors.New("Command requires name and at least one step")
+	}
+	steps, err := gnes.ParseMacro(strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+	err = dbg.emu.DefineMacro(args[0], steps)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Defined macro %s with %d steps\n", args[0], len(steps))
+	return nil
+}
+
+// parsePort turns a port counted from 1 into a gnes port
+func parsePort(arg string) (int, error) {
+	port, err := strconv.ParseUint(arg, 10, 8)
+	if err != nil || port < 1 {
+		return 0, errors.New("Port must be an integer from 1")
+	}
+	return int(port) - 1, nil
+}
+
+func cmdRunMacro(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("Command requires name, and optional port args")
+	}
+	port := gnes.PORT_1
+	if len(args) == 2 {
+		var err error
+		port, err = parsePort(args[1])
+		if err != nil {
+			return err
+		}
+	}
+	err := dbg.emu.RunMacro(args[0], port)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Playing macro %s on port %d\n", args[0], port+1)
+	return nil
+}
+
+func cmdSetTurbo(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("Command requires port, and optional buttons args")
+	}
+	port, err := parsePort(args[0])
+	if err != nil {
+		return err
+	}
+	buttons := gnes.Buttons(0)
+	if len(args) == 2 {
+		buttons, err = gnes.ParseButtons(args[1])
+		if err != nil {
+			return err
+		}
+	}
+	err = dbg.emu.SetTurbo(port, buttons)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Turbo buttons on port %d: %#02x\n", port+1, buttons)
+	return nil
+}
+
+func cmdSetTurboPeriod(dbg *debugger, input string) error {
+	args := getArgs(input)
+	if len(args) != 1 {
+		return errors.New("Command requires 1 arg")
+	}
+	frames, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return errors.New("Argument must be integer")
+	}
+	err = dbg.emu.SetTurboPeriod(int(frames))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Turbo period: %d frames\n", frames)
+	return nil
+}
+
+func writeDebugImage(path string, img image.Image) error {
+	err := gnes.WritePNG(path, img)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", path)
+	return nil
+}
+
 func cmdShowRegisters(dbg *debugger, input string) error {
 	regs := dbg.emu.GetCPUState()
 	fmt.Printf("    PC: %#04x\n", regs.PC)
@@ -0,0 +1,51 @@
+package gneslib
+
+import "../core"
+import (
+	"errors"
+	"fmt"
+)
+
+// RenderNSF plays a track of an NSF or NSFe file for the given number of
+// seconds, and writes the audio to a WAV file at outPath. A track of 0 plays
+// the file's starting track.
+func RenderNSF(path, outPath string, track, seconds int) error {
+	emu, err := gnes.NewEmulator(path)
+	if err != nil {
+		return err
+	}
+	if !emu.IsNSF() {
+		return errors.New(path + " is not an NSF file")
+	}
+	for _, problem := range emu.LoadReport().Problems {
+		fmt.Println(problem)
+	}
+	if seconds <= 0 {
+		return errors.New("Length must be at least a second")
+	}
+	info, _ := emu.NSFInfo()
+	if track == 0 {
+		track = info.StartSong
+	}
+	err = emu.PlayTrack(track)
+	if err != nil {
+		return err
+	}
+
+	// One frame is one call to the play routine
+	num, den := emu.FrameRateFraction()
+	frames := int(uint64(seconds) * num / den)
+	err = emu.StartAudioRecording(outPath, frames, false)
+	if err != nil {
+		return err
+	}
+	for emu.IsRecordingAudio() {
+		err = emu.StepFrame()
+		if err != nil {
+			emu.StopAudioRecording()
+			return err
+		}
+	}
+	fmt.Printf("Wrote %d seconds of track %d of %q to %s\n", seconds, track, info.Title, outPath)
+	return nil
+}
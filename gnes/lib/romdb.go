@@ -0,0 +1,9 @@
+package gneslib
+
+import "../core"
+
+// LoadRomDatabase adds a local ROM database file to the embedded one, for
+// every ROM loaded afterwards.
+func LoadRomDatabase(path string) error {
+	return gnes.LoadRomDatabaseFile(path)
+}
@@ -0,0 +1,290 @@
+package gneslib
+
+import "../core"
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	termFRAME_PERIOD = time.Second / 60
+	// Terminals only report key presses, never releases, so a press holds its
+	// button for a while, and key repeats keep it held.
+	termKEY_HOLD_FRAMES   = 15
+	termKEY_REPEAT_FRAMES = 5
+	// How often the terminal size is checked, in frames
+	termRESIZE_CHECK_FRAMES = 30
+)
+
+const (
+	ansiCLEAR       = "\x1b[2J"
+	ansiHOME        = "\x1b[H"
+	ansiHIDE_CURSOR = "\x1b[?25l"
+	ansiSHOW_CURSOR = "\x1b[?25h"
+	ansiRESET       = "\x1b[0m"
+	halfBlock       = "▀" // upper half block; foreground is the top pixel
+)
+
+// keyBindings maps keys to controller 1 buttons
+var keyBindings = map[string]gnes.Buttons{
+	"\x1b[A": gnes.BUTTON_UP,
+	"\x1b[B": gnes.BUTTON_DOWN,
+	"\x1b[C": gnes.BUTTON_RIGHT,
+	"\x1b[D": gnes.BUTTON_LEFT,
+	"w":      gnes.BUTTON_UP,
+	"s":      gnes.BUTTON_DOWN,
+	"d":      gnes.BUTTON_RIGHT,
+	"a":      gnes.BUTTON_LEFT,
+	"x":      gnes.BUTTON_A,
+	"k":      gnes.BUTTON_A,
+	"z":      gnes.BUTTON_B,
+	"j":      gnes.BUTTON_B,
+	"\r":     gnes.BUTTON_START,
+	"\t":     gnes.BUTTON_SELECT,
+}
+
+var quitKeys = []string{"q", "\x03"}
+
+type terminal struct {
+	emu *gnes.Emulator
+	out *bufio.Writer
+
+	keys chan string
+
+	sttyState string
+
+	cols,
+	rows int
+
+	// Frames left until each button is released
+	held map[gnes.Buttons]int
+}
+
+// RunTerminal plays the ROM at path in the terminal, drawing frames with
+// half-block characters in 24-bit colour, and reading controller 1 from the keyboard.
+func RunTerminal(path string) error {
+	emu, err := gnes.NewEmulator(path)
+	if err != nil {
+		return err
+	}
+
+	term := &terminal{}
+	term.emu = emu
+	term.out = bufio.NewWriterSize(os.Stdout, 1<<16)
+	term.keys = make(chan string, 16)
+	term.held = make(map[gnes.Buttons]int)
+
+	err = term.enterRawMode()
+	if err != nil {
+		return err
+	}
+	defer term.restore()
+
+	go term.readKeys()
+	return term.run()
+}
+
+func (term *terminal) run() error {
+	ticker := time.NewTicker(termFRAME_PERIOD)
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		if frame%termRESIZE_CHECK_FRAMES == 0 {
+			err := term.updateSize()
+			if err != nil {
+				return err
+			}
+		}
+
+		quit := term.pollKeys()
+		if quit {
+			return nil
+		}
+		err := term.emu.SetButtons(gnes.PORT_1, term.heldButtons())
+		if err != nil {
+			return err
+		}
+
+		err = term.emu.StepFrame()
+		if err != nil {
+			return err
+		}
+		term.draw(term.emu.Frame())
+
+		<-ticker.C
+	}
+}
+
+// pollKeys applies all pending key presses, and returns true if a quit key
+// was pressed.
+func (term *terminal) pollKeys() bool {
+	for button := range term.held {
+		term.held[button]--
+		if term.held[button] <= 0 {
+			delete(term.held, button)
+		}
+	}
+
+	for {
+		select {
+		case key, ok := <-term.keys:
+			if !ok {
+				// stdin was closed, so no more keys will arrive
+				term.keys = nil
+				return false
+			}
+			for _, quitKey := range quitKeys {
+				if key == quitKey {
+					return true
+				}
+			}
+			button, ok := keyBindings[key]
+			if !ok {
+				continue
+			}
+			if _, held := term.held[button]; held {
+				if term.held[button] < termKEY_REPEAT_FRAMES {
+					term.held[button] = termKEY_REPEAT_FRAMES
+				}
+			} else {
+				term.held[button] = termKEY_HOLD_FRAMES
+			}
+		default:
+			return false
+		}
+	}
+}
+
+func (term *terminal) heldButtons() gnes.Buttons {
+	var buttons gnes.Buttons
+	for button := range term.held {
+		buttons |= button
+	}
+	return buttons
+}
+
+// readKeys reads key presses from stdin, splitting escape sequences out so
+// that each arrow key arrives as a single key.
+func (term *terminal) readKeys() {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(term.keys)
+			return
+		}
+		input := string(buf[:n])
+		for len(input) > 0 {
+			length := 1
+			if strings.HasPrefix(input, "\x1b[") && len(input) >= 3 {
+				length = 3
+			}
+			term.keys <- input[:length]
+			input = input[length:]
+		}
+	}
+}
+
+// draw scales the frame to fit the terminal and draws it, two pixels per
+// character cell.
+func (term *terminal) draw(img *image.RGBA) {
+	srcWidth := img.Bounds().Dx()
+	srcHeight := img.Bounds().Dy()
+
+	// Character cells are about twice as tall as they are wide, so a half block
+	// is roughly square.
+	width := term.cols
+	height := width * srcHeight / srcWidth
+	if height > 2*(term.rows-1) {
+		height = 2 * (term.rows - 1)
+		width = height * srcWidth / srcHeight
+	}
+	height &^= 1
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	term.out.WriteString(ansiHOME)
+	var lastTop, lastBottom [3]uint8
+	first := true
+	for y := 0; y < height; y += 2 {
+		for x := 0; x < width; x++ {
+			srcX := x * srcWidth / width
+			top := rgbAt(img, srcX, y*srcHeight/height)
+			bottom := rgbAt(img, srcX, (y+1)*srcHeight/height)
+			if first || top != lastTop {
+				fmt.Fprintf(term.out, "\x1b[38;2;%d;%d;%dm", top[0], top[1], top[2])
+			}
+			if first || bottom != lastBottom {
+				fmt.Fprintf(term.out, "\x1b[48;2;%d;%d;%dm", bottom[0], bottom[1], bottom[2])
+			}
+			lastTop, lastBottom = top, bottom
+			first = false
+			term.out.WriteString(halfBlock)
+		}
+		term.out.WriteString(ansiRESET + "\x1b[K\r\n")
+		first = true
+	}
+	term.out.Flush()
+}
+
+func rgbAt(img *image.RGBA, x, y int) [3]uint8 {
+	i := img.PixOffset(x, y)
+	return [3]uint8{img.Pix[i], img.Pix[i+1], img.Pix[i+2]}
+}
+
+// updateSize queries the terminal size, and clears the screen if it changed.
+func (term *terminal) updateSize() error {
+	size, err := stty("size")
+	if err != nil {
+		return err
+	}
+	var rows, cols int
+	_, err = fmt.Sscan(size, &rows, &cols)
+	if err != nil {
+		return err
+	}
+	if rows != term.rows || cols != term.cols {
+		term.rows = rows
+		term.cols = cols
+		term.out.WriteString(ansiCLEAR)
+	}
+	return nil
+}
+
+func (term *terminal) enterRawMode() error {
+	state, err := stty("-g")
+	if err != nil {
+		return err
+	}
+	term.sttyState = strings.TrimSpace(state)
+	_, err = stty("raw", "-echo")
+	if err != nil {
+		return err
+	}
+	term.out.WriteString(ansiHIDE_CURSOR + ansiCLEAR)
+	return term.out.Flush()
+}
+
+func (term *terminal) restore() {
+	term.out.WriteString(ansiRESET + ansiSHOW_CURSOR + "\r\n")
+	term.out.Flush()
+	stty(term.sttyState)
+}
+
+// stty runs stty on the controlling terminal. Using stty keeps the frontend
+// free of any terminal libraries.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %s failed: %v", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
@@ -1,10 +1,37 @@
 package main
 
 import "./gnes/lib"
+import "flag"
 import "fmt"
 
 func main() {
-	err := gneslib.RunCLIDebugger("roms/cpu.nes")
+	term := flag.Bool("term", false, "Play the ROM in the terminal instead of starting the debugger")
+	nsfWav := flag.String("nsfwav", "", "Render a track of an NSF file to this WAV file instead of starting the debugger")
+	track := flag.Int("track", 0, "Track to render with -nsfwav, counting from 1 (default the file's starting track)")
+	seconds := flag.Int("seconds", 120, "Number of seconds to render with -nsfwav")
+	romDb := flag.String("romdb", "", "Load a local ROM database file (the embedded one has no entries yet)")
+	flag.Parse()
+
+	path := "roms/cpu.nes"
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+
+	var err error
+	if *romDb != "" {
+		err = gneslib.LoadRomDatabase(*romDb)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if *nsfWav != "" {
+		err = gneslib.RenderNSF(path, *nsfWav, *track, *seconds)
+	} else if *term {
+		err = gneslib.RunTerminal(path)
+	} else {
+		err = gneslib.RunCLIDebugger(path)
+	}
 	if err != nil {
 		fmt.Println(err)
 	}